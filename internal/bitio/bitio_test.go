@@ -162,3 +162,213 @@ func TestWriteBitsSpansBuffer(t *testing.T) {
 		t.Fatalf("Unexpected round trip values: %x %x", first, second)
 	}
 }
+
+func TestLSBReadWrite(t *testing.T) {
+	r := rand.New(rand.NewSource(10))
+	var (
+		buf    = new(bytes.Buffer)
+		bw     = NewLSBBitWriter(buf)
+		values []uint64
+		widths []int
+	)
+	for range 1000 {
+		width := r.Intn(65)
+		value := r.Uint64()
+		if width < 64 {
+			value &= 1<<width - 1
+		}
+		if err := bw.WriteBits(value, width); err != nil {
+			t.Fatalf("Failed to write %d bits: %v", width, err)
+		}
+		values = append(values, value)
+		widths = append(widths, width)
+	}
+	if _, err := bw.Flush(); err != nil {
+		t.Fatalf("Flush error: %v", err)
+	}
+	br := NewLSBBitReader(bytes.NewReader(buf.Bytes()))
+	for i := range values {
+		value, err := br.ReadBits(widths[i])
+		if err != nil {
+			t.Fatalf("Failed to read %d bits: %v", widths[i], err)
+		}
+		if value != values[i] {
+			t.Fatalf("Value %d mismatch: got %x - expected %x", i, value, values[i])
+		}
+	}
+}
+
+func TestLSBBitOrder(t *testing.T) {
+	// deflate's fixed block header: final bit 1, then block type 01, lowest bits first
+	buf := new(bytes.Buffer)
+	bw := NewLSBBitWriter(buf)
+	if err := bw.WriteBits(1, 1); err != nil {
+		t.Fatalf("Failed to write final bit: %v", err)
+	}
+	if err := bw.WriteBits(0b01, 2); err != nil {
+		t.Fatalf("Failed to write block type: %v", err)
+	}
+	if err := bw.WriteBits(0x1FF, 9); err != nil {
+		t.Fatalf("Failed to write 9 bits: %v", err)
+	}
+	n, err := bw.Flush()
+	if err != nil {
+		t.Fatalf("Flush error: %v", err)
+	}
+	if n != 4 || !bytes.Equal(buf.Bytes(), []byte{0b11111011, 0b00001111}) {
+		t.Fatalf("Unexpected lsb first bytes %08b with %d padding bits", buf.Bytes(), n)
+	}
+}
+
+func TestLSBReadLeavesRest(t *testing.T) {
+	reader := strings.NewReader("AB")
+	br := NewLSBBitReader(reader)
+	if _, err := br.ReadBits(3); err != nil {
+		t.Fatalf("Failed to read 3 bits: %v", err)
+	}
+	if reader.Len() != 1 {
+		t.Fatalf("Reader consumed %d bytes for 3 bits", 2-reader.Len())
+	}
+}
+
+func TestPeekSkipAlign(t *testing.T) {
+	input := []byte{0b10110011, 0b01011100, 0xFF, 0x00}
+	readers := map[string]*BitReader{
+		"reader": NewBitReader(bytes.NewReader(input)),
+		"bytes":  NewBitReaderBytes(input),
+	}
+	for name, br := range readers {
+		peeked, err := br.PeekBits(12)
+		if err != nil || peeked != 0b101100110101 {
+			t.Fatalf("%s: unexpected peek %b: %v", name, peeked, err)
+		}
+		if err = br.SkipBits(3); err != nil {
+			t.Fatalf("%s: failed to skip: %v", name, err)
+		}
+		value, err := br.ReadBits(4)
+		if err != nil || value != 0b1001 {
+			t.Fatalf("%s: unexpected read after skip %b: %v", name, value, err)
+		}
+		br.AlignToByte()
+		value, err = br.ReadBits(8)
+		if err != nil || value != 0b01011100 {
+			t.Fatalf("%s: unexpected read after align %b: %v", name, value, err)
+		}
+		br.AlignToByte() // already aligned, nothing to drop
+		value, err = br.ReadBits(16)
+		if err != nil || value != 0xFF00 {
+			t.Fatalf("%s: unexpected final read %x: %v", name, value, err)
+		}
+		if _, err = br.PeekBits(1); !errors.Is(err, io.EOF) {
+			t.Fatalf("%s: expected EOF after the last bit, got %v", name, err)
+		}
+	}
+}
+
+func TestLSBPeekSkipAlign(t *testing.T) {
+	input := []byte{0b10110011, 0b01011100, 0xFF, 0x00}
+	readers := map[string]*LSBBitReader{
+		"reader": NewLSBBitReader(bytes.NewReader(input)),
+		"bytes":  NewLSBBitReaderBytes(input),
+	}
+	for name, br := range readers {
+		peeked, err := br.PeekBits(12)
+		if err != nil || peeked != 0b110010110011 {
+			t.Fatalf("%s: unexpected peek %b: %v", name, peeked, err)
+		}
+		if err = br.SkipBits(3); err != nil {
+			t.Fatalf("%s: failed to skip: %v", name, err)
+		}
+		value, err := br.ReadBits(4)
+		if err != nil || value != 0b0110 {
+			t.Fatalf("%s: unexpected read after skip %b: %v", name, value, err)
+		}
+		br.AlignToByte()
+		value, err = br.ReadBits(8)
+		if err != nil || value != 0b01011100 {
+			t.Fatalf("%s: unexpected read after align %b: %v", name, value, err)
+		}
+		value, err = br.ReadBits(16)
+		if err != nil || value != 0x00FF {
+			t.Fatalf("%s: unexpected final read %x: %v", name, value, err)
+		}
+		if _, err = br.PeekBits(1); !errors.Is(err, io.EOF) {
+			t.Fatalf("%s: expected EOF after the last bit, got %v", name, err)
+		}
+	}
+}
+
+func TestPeekPastEnd(t *testing.T) {
+	br := NewLSBBitReaderBytes([]byte{0b101})
+	peeked, err := br.PeekBits(15)
+	if !errors.Is(err, io.ErrUnexpectedEOF) || peeked != 0b101 {
+		t.Fatalf("Expected the remaining bits zero padded with an unexpected EOF, got %b: %v", peeked, err)
+	}
+	if err = br.SkipBits(8); err != nil {
+		t.Fatalf("Failed to skip the remaining bits: %v", err)
+	}
+	if err = br.SkipBits(1); err == nil {
+		t.Fatalf("Skipped past the end of the stream")
+	}
+	msb := NewBitReaderBytes([]byte{0b101})
+	if peeked, err = msb.PeekBits(10); !errors.Is(err, io.ErrUnexpectedEOF) || peeked != 0b0000010100 {
+		t.Fatalf("Expected the remaining bits zero padded with an unexpected EOF, got %b: %v", peeked, err)
+	}
+}
+
+func TestReadBytesMatchesReader(t *testing.T) {
+	r := rand.New(rand.NewSource(10))
+	input := make([]byte, 4096)
+	r.Read(input)
+	var (
+		streamed = NewBitReader(bytes.NewReader(input))
+		direct   = NewBitReaderBytes(input)
+	)
+	for bitsLeft := 8 * len(input); bitsLeft > 0; {
+		width := min(r.Intn(65), bitsLeft)
+		a, errA := streamed.ReadBits(width)
+		b, errB := direct.ReadBits(width)
+		if errA != nil || errB != nil || a != b {
+			t.Fatalf("Readers disagree on %d bits: %x (%v) and %x (%v)", width, a, errA, b, errB)
+		}
+		bitsLeft -= width
+	}
+}
+
+func TestWriterAlignToByte(t *testing.T) {
+	buf := new(bytes.Buffer)
+	bw := NewLSBBitWriter(buf)
+	bw.WriteBits(0b101, 3)
+	n, err := bw.AlignToByte()
+	if err != nil || n != 5 {
+		t.Fatalf("Unexpected alignment of %d bits: %v", n, err)
+	}
+	bw.WriteBits(0xAB, 8)
+	bw.Flush()
+	if !bytes.Equal(buf.Bytes(), []byte{0b101, 0xAB}) {
+		t.Fatalf("Unexpected aligned bytes %x", buf.Bytes())
+	}
+}
+
+func BenchmarkReadBits(b *testing.B) {
+	input := make([]byte, 1<<16)
+	rand.New(rand.NewSource(10)).Read(input)
+	b.Run("reader", func(b *testing.B) {
+		b.SetBytes(int64(len(input)))
+		for b.Loop() {
+			br := NewLSBBitReader(bytes.NewReader(input))
+			for range 8 * len(input) / 13 {
+				br.ReadBits(13)
+			}
+		}
+	})
+	b.Run("bytes", func(b *testing.B) {
+		b.SetBytes(int64(len(input)))
+		for b.Loop() {
+			br := NewLSBBitReaderBytes(input)
+			for range 8 * len(input) / 13 {
+				br.ReadBits(13)
+			}
+		}
+	})
+}
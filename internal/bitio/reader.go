@@ -5,32 +5,84 @@ import (
 	"io"
 )
 
-type bitReader struct {
-	reader       io.Reader // io.reader for reading a stream
-	buffer       uint64    // buffer holding current streamed bits
-	nBits        int       // number of bits currently not read from buffer (cursor)
-	readBuffer   [8]byte   // bytes to be read when filling in the buffer
-	sBytesToRead int       // scratch
+const maxPeekBits = 56 // most bits PeekBits can return, a whole byte always fits above them
+
+// BitReader reads bits msb first: the first bit read is the highest bit of the
+// first byte, and multi-bit values come out with their first bit highest.
+type BitReader struct {
+	reader     io.Reader // io.reader for reading a stream, nil when reading src
+	src        []byte    // in memory stream, read without going through a reader
+	srcIdx     int       // next byte of src to load
+	buffer     uint64    // buffer holding current streamed bits
+	nBits      int       // number of bits currently not read from buffer (cursor)
+	readBuffer [8]byte   // bytes to be read when filling in the buffer
+}
+
+func NewBitReader(r io.Reader) *BitReader {
+	return &BitReader{reader: r}
 }
 
-func NewBitReader(r io.Reader) *bitReader {
-	return &bitReader{reader: r}
+// NewBitReaderBytes reads from b directly, refilling the buffer several bytes
+// at a time instead of calling an io.Reader for the bytes each read needs.
+func NewBitReaderBytes(b []byte) *BitReader {
+	return &BitReader{src: b}
 }
 
-func (br *bitReader) ReadBits(nbits int) (uint64, error) {
-	if br.nBits < nbits { // read more bytes to have enough bits
-		br.sBytesToRead = (int(nbits) - int(br.nBits) + 7) / 8 // calculate the number of bytes needed
-		if int(br.nBits)+br.sBytesToRead*8 > 64 {              // return if reading too many bytes at once
-			return 0, fmt.Errorf("bitreader error when reading %d bytes: %w", br.sBytesToRead, io.ErrShortBuffer)
+// fill tops the buffer up to at least nbits bits (at most 57). Streams only
+// have as many bytes read as needed, so whatever follows the bits is left in
+// the reader. The error wraps io.EOF if no bits are left at all, and
+// io.ErrUnexpectedEOF if some are but fewer than nbits.
+func (br *BitReader) fill(nbits int) error {
+	if br.src != nil {
+		for br.nBits <= 56 && br.srcIdx < len(br.src) { // load as much as fits
+			br.buffer = (br.buffer << 8) | uint64(br.src[br.srcIdx])
+			br.srcIdx++
+			br.nBits += 8
 		}
-		_, err := io.ReadFull(br.reader, br.readBuffer[:br.sBytesToRead]) // read in the new data
-		if err != nil {
-			return 0, fmt.Errorf("bitreader error when reading %d bytes: %w", br.sBytesToRead, err)
+		if br.nBits < nbits {
+			return fmt.Errorf("bitreader error when reading %d bits: %w", nbits, endOfStream(br.nBits))
 		}
-		for i := range br.sBytesToRead { // add in the new data to the buffer
-			br.buffer = (br.buffer << 8) | uint64(br.readBuffer[i]) // shift buffer and add the new byte
-			br.nBits += 8                                           // add to total bits in the buffer
+		return nil
+	}
+	if br.nBits >= nbits {
+		return nil
+	}
+	bytesToRead := (nbits - br.nBits + 7) / 8                     // calculate the number of bytes needed
+	n, err := io.ReadFull(br.reader, br.readBuffer[:bytesToRead]) // read in the new data
+	for i := range n {                                            // add in the new data to the buffer
+		br.buffer = (br.buffer << 8) | uint64(br.readBuffer[i]) // shift buffer and add the new byte
+		br.nBits += 8                                           // add to total bits in the buffer
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = endOfStream(br.nBits)
+	}
+	if err != nil {
+		return fmt.Errorf("bitreader error when reading %d bytes: %w", bytesToRead, err)
+	}
+	return nil
+}
+
+func endOfStream(bitsLeft int) error {
+	if bitsLeft == 0 {
+		return io.EOF
+	}
+	return io.ErrUnexpectedEOF
+}
+
+func (br *BitReader) ReadBits(nbits int) (uint64, error) {
+	if nbits > 64 {
+		return 0, fmt.Errorf("bitreader can only read up to 64 bits per call: %w", io.ErrShortBuffer)
+	}
+	if nbits > maxPeekBits+1 { // more than the buffer can be sure to hold, so read it in two halves
+		high, err := br.ReadBits(nbits - 32)
+		if err != nil {
+			return 0, err
 		}
+		low, err := br.ReadBits(32)
+		return high<<32 | low, err
+	}
+	if err := br.fill(nbits); err != nil {
+		return 0, err
 	}
 	// you want 6 bits
 	// nBits  = 10
@@ -39,15 +91,150 @@ func (br *bitReader) ReadBits(nbits int) (uint64, error) {
 	// right shift the buffer by unread bits - desired bits (10 - 6 = 4)
 	// shifted buffer = 0000101100
 	// and with mask  =     111111 (prevent high bits from leaking through)
-	// result         =     101100var mask uint64
-	var mask uint64
-	if nbits == 64 {
-		mask = ^uint64(0)
-	} else {
-		mask = (uint64(1) << nbits) - 1
-	}
-	out := (br.buffer >> (br.nBits - nbits)) & mask
-	br.nBits -= nbits                // count down to not re-read bits
-	br.buffer &= (1 << br.nBits) - 1 // mask it down to prevent overflow
+	// result         =     101100
+	out := (br.buffer >> (br.nBits - nbits)) & mask64(nbits)
+	br.nBits -= nbits             // count down to not re-read bits
+	br.buffer &= mask64(br.nBits) // mask it down to prevent overflow
 	return out, nil
 }
+
+// PeekBits returns the next nbits bits (at most 56) without consuming them.
+// Near the end of the stream the missing bits read as zero, alongside an error
+// wrapping io.ErrUnexpectedEOF, so a decoder can peek a full code's worth and
+// SkipBits fails only if it goes past the end.
+func (br *BitReader) PeekBits(nbits int) (uint64, error) {
+	if nbits > maxPeekBits {
+		return 0, fmt.Errorf("bitreader can only peek up to %d bits: %w", maxPeekBits, io.ErrShortBuffer)
+	}
+	err := br.fill(nbits)
+	if br.nBits < nbits {
+		return (br.buffer << (nbits - br.nBits)) & mask64(nbits), err
+	}
+	return (br.buffer >> (br.nBits - nbits)) & mask64(nbits), err
+}
+
+// SkipBits consumes nbits bits, typically after PeekBits.
+func (br *BitReader) SkipBits(nbits int) error {
+	for nbits > 0 {
+		n := min(nbits, maxPeekBits)
+		if err := br.fill(n); err != nil {
+			return err
+		}
+		br.nBits -= n
+		br.buffer &= mask64(br.nBits)
+		nbits -= n
+	}
+	return nil
+}
+
+// AlignToByte drops the bits left in the current byte, so the next read starts
+// on a byte boundary.
+func (br *BitReader) AlignToByte() {
+	br.nBits -= br.nBits % 8 // bytes are loaded whole, so the partly read one is what's left over
+	br.buffer &= mask64(br.nBits)
+}
+
+// LSBBitReader reads bits lsb first, the order deflate (RFC 1951) packs them:
+// the first bit read is the lowest bit of the first byte, and multi-bit values
+// come out with their first bit in the lowest position.
+type LSBBitReader struct {
+	reader     io.Reader // io.reader for reading a stream, nil when reading src
+	src        []byte    // in memory stream, read without going through a reader
+	srcIdx     int       // next byte of src to load
+	buffer     uint64    // buffer holding current streamed bits, next bit lowest
+	nBits      int       // number of bits currently not read from buffer
+	readBuffer [8]byte   // bytes to be read when filling in the buffer
+}
+
+func NewLSBBitReader(r io.Reader) *LSBBitReader {
+	return &LSBBitReader{reader: r}
+}
+
+// NewLSBBitReaderBytes reads from b directly, refilling the buffer several
+// bytes at a time instead of calling an io.Reader for the bytes each read needs.
+func NewLSBBitReaderBytes(b []byte) *LSBBitReader {
+	return &LSBBitReader{src: b}
+}
+
+// fill works as BitReader.fill does, with new bytes going above the buffered bits.
+func (br *LSBBitReader) fill(nbits int) error {
+	if br.src != nil {
+		for br.nBits <= 56 && br.srcIdx < len(br.src) { // load as much as fits
+			br.buffer |= uint64(br.src[br.srcIdx]) << br.nBits
+			br.srcIdx++
+			br.nBits += 8
+		}
+		if br.nBits < nbits {
+			return fmt.Errorf("bitreader error when reading %d bits: %w", nbits, endOfStream(br.nBits))
+		}
+		return nil
+	}
+	if br.nBits >= nbits {
+		return nil
+	}
+	bytesToRead := (nbits - br.nBits + 7) / 8
+	n, err := io.ReadFull(br.reader, br.readBuffer[:bytesToRead])
+	for i := range n {
+		br.buffer |= uint64(br.readBuffer[i]) << br.nBits
+		br.nBits += 8
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = endOfStream(br.nBits)
+	}
+	if err != nil {
+		return fmt.Errorf("bitreader error when reading %d bytes: %w", bytesToRead, err)
+	}
+	return nil
+}
+
+func (br *LSBBitReader) ReadBits(nbits int) (uint64, error) {
+	if nbits > 64 {
+		return 0, fmt.Errorf("bitreader can only read up to 64 bits per call: %w", io.ErrShortBuffer)
+	}
+	if nbits > maxPeekBits+1 { // more than the buffer can be sure to hold, so read it in two halves
+		low, err := br.ReadBits(32)
+		if err != nil {
+			return 0, err
+		}
+		high, err := br.ReadBits(nbits - 32)
+		return low | high<<32, err
+	}
+	if err := br.fill(nbits); err != nil {
+		return 0, err
+	}
+	out := br.buffer & mask64(nbits)
+	br.buffer >>= nbits // shifting out all 64 bits leaves zero
+	br.nBits -= nbits
+	return out, nil
+}
+
+// PeekBits returns the next nbits bits (at most 56) without consuming them,
+// see BitReader.PeekBits for how the end of the stream is handled.
+func (br *LSBBitReader) PeekBits(nbits int) (uint64, error) {
+	if nbits > maxPeekBits {
+		return 0, fmt.Errorf("bitreader can only peek up to %d bits: %w", maxPeekBits, io.ErrShortBuffer)
+	}
+	err := br.fill(nbits)
+	return br.buffer & mask64(nbits), err // the bits past the end are already zero
+}
+
+// SkipBits consumes nbits bits, typically after PeekBits.
+func (br *LSBBitReader) SkipBits(nbits int) error {
+	for nbits > 0 {
+		n := min(nbits, maxPeekBits)
+		if err := br.fill(n); err != nil {
+			return err
+		}
+		br.buffer >>= n
+		br.nBits -= n
+		nbits -= n
+	}
+	return nil
+}
+
+// AlignToByte drops the bits left in the current byte, so the next read starts
+// on a byte boundary.
+func (br *LSBBitReader) AlignToByte() {
+	br.buffer >>= br.nBits % 8 // bytes are loaded whole, so the partly read one is what's left over
+	br.nBits -= br.nBits % 8
+}
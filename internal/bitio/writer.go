@@ -5,7 +5,8 @@ import (
 	"io"
 )
 
-type bitWriter struct {
+// BitWriter writes bits msb first, the counterpart of BitReader.
+type BitWriter struct {
 	writer      io.Writer // io.reader for reading a stream
 	buffer      uint64    // buffer holding current streamed bits
 	nBits       int       // number of bits currently not written to file
@@ -17,8 +18,8 @@ type bitWriter struct {
 	sByte       byte      // scratch
 }
 
-func NewBitWriter(w io.Writer) *bitWriter {
-	return &bitWriter{writer: w}
+func NewBitWriter(w io.Writer) *BitWriter {
+	return &BitWriter{writer: w}
 }
 
 func mask64(n int) uint64 {
@@ -28,7 +29,7 @@ func mask64(n int) uint64 {
 	return (1 << n) - 1
 }
 
-func (bw *bitWriter) clearBuffer() error {
+func (bw *BitWriter) clearBuffer() error {
 	bytesToWrite := bw.nBits / 8 // how many bites need to be written
 	for i := range bytesToWrite {
 		bw.sByte = byte((bw.buffer >> (bw.nBits - 8)) & ((1 << 8) - 1)) // same math explained in BitReader
@@ -43,7 +44,7 @@ func (bw *bitWriter) clearBuffer() error {
 	return nil
 }
 
-func (bw *bitWriter) WriteBits(bits uint64, nbits int) error {
+func (bw *BitWriter) WriteBits(bits uint64, nbits int) error {
 	if nbits < 1 {
 		return nil
 	}
@@ -73,7 +74,14 @@ func (bw *bitWriter) WriteBits(bits uint64, nbits int) error {
 	return nil
 }
 
-func (bw *bitWriter) Flush() (int, error) {
+// AlignToByte pads the stream with zero bits up to the next byte boundary
+// and returns the number of bits added.
+func (bw *BitWriter) AlignToByte() (int, error) {
+	padding := (8 - bw.nBits%8) % 8
+	return padding, bw.WriteBits(0, padding)
+}
+
+func (bw *BitWriter) Flush() (int, error) {
 	padding := (8 - bw.nBits%8) % 8 // pad the bit stream to acheive valid byte length
 	if padding != 0 {
 		err := bw.WriteBits(0, padding)
@@ -87,3 +95,71 @@ func (bw *bitWriter) Flush() (int, error) {
 	}
 	return padding, nil
 }
+
+// LSBBitWriter writes bits lsb first, the order deflate (RFC 1951) packs them:
+// the lowest bit of a value is written first, filling bytes from their lowest
+// bit up.
+type LSBBitWriter struct {
+	writer      io.Writer // io.writer for writing a stream
+	buffer      uint64    // buffer holding bits not yet written, oldest lowest
+	nBits       int       // number of bits currently not written to file
+	writeBuffer [8]byte   // bytes to be written when clearing the buffer
+}
+
+func NewLSBBitWriter(w io.Writer) *LSBBitWriter {
+	return &LSBBitWriter{writer: w}
+}
+
+func (bw *LSBBitWriter) clearBuffer() error {
+	bytesToWrite := bw.nBits / 8
+	for i := range bytesToWrite {
+		bw.writeBuffer[i] = byte(bw.buffer) // the oldest bits sit at the bottom
+		bw.buffer >>= 8
+		bw.nBits -= 8
+	}
+	_, err := bw.writer.Write(bw.writeBuffer[:bytesToWrite])
+	if err != nil {
+		return fmt.Errorf("bitwriter error when writing %d bytes: %w", bytesToWrite, err)
+	}
+	return nil
+}
+
+func (bw *LSBBitWriter) WriteBits(bits uint64, nbits int) error {
+	if nbits < 1 {
+		return nil
+	}
+	if nbits > 64 {
+		return fmt.Errorf("bitwriter can only write up to 64 bits per call: %w", io.ErrShortBuffer)
+	}
+	bits &= mask64(nbits)
+	for nbits > 0 {
+		n := min(nbits, 64-bw.nBits) // as many bits as fit the buffer
+		bw.buffer |= (bits & mask64(n)) << bw.nBits
+		bw.nBits += n
+		bits >>= n // shifting out all 64 bits leaves zero
+		nbits -= n
+		if bw.nBits == 64 {
+			if err := bw.clearBuffer(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AlignToByte pads the stream with zero bits up to the next byte boundary
+// and returns the number of bits added.
+func (bw *LSBBitWriter) AlignToByte() (int, error) {
+	padding := (8 - bw.nBits%8) % 8
+	return padding, bw.WriteBits(0, padding)
+}
+
+func (bw *LSBBitWriter) Flush() (int, error) {
+	padding := (8 - bw.nBits%8) % 8 // pad the bit stream to acheive valid byte length
+	bw.nBits += padding             // the padding bits above the buffered ones are already zero
+	err := bw.clearBuffer()
+	if err != nil {
+		return padding, fmt.Errorf("bitwriter error when flushing: %w", err)
+	}
+	return padding, nil
+}
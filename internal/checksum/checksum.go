@@ -0,0 +1,91 @@
+package checksum
+
+import (
+	"hash"
+	"hash/crc32"
+	"strings"
+)
+
+// Checksum algorithm IDs, as stored in stream headers. Streams from before
+// selectable algorithms always use CRC32.
+const (
+	CRC32  = iota // CRC-32 IEEE, 4 bytes
+	CRC64         // CRC-64 ECMA-182 as used by xz, 8 bytes
+	XXH64         // xxHash64 with a zero seed, 8 bytes
+	SHA256        // SHA-256, 32 bytes
+)
+
+const MaxSize = 32 // largest digest of any algorithm
+
+var names = [...]string{
+	CRC32:  "crc32",
+	CRC64:  "crc64",
+	XXH64:  "xxh64",
+	SHA256: "sha256",
+}
+
+var sizes = [...]int{
+	CRC32:  crc32.Size,
+	CRC64:  8,
+	XXH64:  8,
+	SHA256: 32,
+}
+
+// Valid reports whether alg is a known algorithm.
+func Valid(alg uint8) bool {
+	return int(alg) < len(names)
+}
+
+// Name returns the name of an algorithm as accepted by ID, or "" if unknown.
+func Name(alg uint8) string {
+	if !Valid(alg) {
+		return ""
+	}
+	return names[alg]
+}
+
+// ID looks up an algorithm by its case-insensitive name.
+func ID(name string) (uint8, bool) {
+	for alg, n := range names {
+		if strings.EqualFold(n, name) {
+			return uint8(alg), true
+		}
+	}
+	return 0, false
+}
+
+// Names lists every algorithm name in ID order.
+func Names() []string {
+	return names[:]
+}
+
+// Size returns the digest length of an algorithm in bytes, or 0 if unknown.
+func Size(alg uint8) int {
+	if !Valid(alg) {
+		return 0
+	}
+	return sizes[alg]
+}
+
+// New returns a hash computing the digest of an algorithm, or nil if unknown.
+// Digests are big-endian, so CRC32 matches the checksums of older streams.
+func New(alg uint8) hash.Hash {
+	switch alg {
+	case CRC32:
+		return crc32.NewIEEE()
+	case CRC64:
+		return newCRC64()
+	case XXH64:
+		return newXXH64()
+	case SHA256:
+		return newSHA256()
+	}
+	return nil
+}
+
+// Sum appends the digest of data to dst.
+func Sum(alg uint8, dst []byte, data []byte) []byte {
+	h := New(alg)
+	h.Write(data)
+	return h.Sum(dst)
+}
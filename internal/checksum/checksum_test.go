@@ -0,0 +1,83 @@
+package checksum
+
+import (
+	"bytes"
+	stdsha256 "crypto/sha256"
+	"encoding/binary"
+	"hash/crc32"
+	stdcrc64 "hash/crc64"
+	"math/rand"
+	"testing"
+)
+
+// reference digests from the standard library, xxHash64 has none
+var reference = map[uint8]func([]byte) []byte{
+	CRC32: func(p []byte) []byte { return binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(p)) },
+	CRC64: func(p []byte) []byte {
+		return binary.BigEndian.AppendUint64(nil, stdcrc64.Checksum(p, stdcrc64.MakeTable(stdcrc64.ECMA)))
+	},
+	SHA256: func(p []byte) []byte { s := stdsha256.Sum256(p); return s[:] },
+}
+
+func TestReference(t *testing.T) {
+	r := rand.New(rand.NewSource(24))
+	data := make([]byte, 1000)
+	r.Read(data)
+	for alg, ref := range reference {
+		for n := range len(data) {
+			expected := ref(data[:n])
+			if got := Sum(alg, nil, data[:n]); !bytes.Equal(got, expected) {
+				t.Fatalf("%s of %d bytes is %x, expected %x", Name(alg), n, got, expected)
+			}
+		}
+	}
+}
+
+func TestXXH64(t *testing.T) {
+	for input, expected := range map[string]uint64{
+		"":    0xEF46DB3751D8E999,
+		"a":   0xD24EC4F1A98C6E5B,
+		"abc": 0x44BC2CF5AD770999,
+		"Nobody inspects the spammish repetition": 0xFBCEA83C8A378BF1,
+	} {
+		d := newXXH64()
+		d.Write([]byte(input))
+		if d.Sum64() != expected {
+			t.Fatalf("XXH64 of %q is %016x, expected %016x", input, d.Sum64(), expected)
+		}
+	}
+}
+
+func TestSplitWrites(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	data := make([]byte, 777)
+	r.Read(data)
+	for _, name := range Names() {
+		alg, _ := ID(name)
+		expected := Sum(alg, nil, data)
+		if len(expected) != Size(alg) || New(alg).Size() != Size(alg) {
+			t.Fatalf("%s digest is %d bytes, expected %d", name, len(expected), Size(alg))
+		}
+		h := New(alg)
+		for p := data; len(p) > 0; {
+			n := min(r.Intn(100), len(p))
+			h.Write(p[:n])
+			p = p[n:]
+			h.Sum(nil) // summing midway must not disturb the state
+		}
+		if got := h.Sum(nil); !bytes.Equal(got, expected) {
+			t.Fatalf("%s of split writes is %x, expected %x", name, got, expected)
+		}
+		h.Reset()
+		h.Write(data)
+		if got := h.Sum(nil); !bytes.Equal(got, expected) {
+			t.Fatalf("%s after reset is %x, expected %x", name, got, expected)
+		}
+	}
+	if _, ok := ID("XXH64"); !ok {
+		t.Fatalf("Algorithm names are not case-insensitive")
+	}
+	if _, ok := ID("md5"); ok || Valid(SHA256+1) || New(SHA256+1) != nil {
+		t.Fatalf("Unknown algorithm accepted")
+	}
+}
@@ -0,0 +1,77 @@
+package checksum
+
+import "encoding/binary"
+
+const crc64Poly = 0xC96C5795D7870F42 // ECMA-182 polynomial, bit reversed
+
+// crc64Tables holds slicing-by-8 tables: crc64Tables[0] is the usual byte at a
+// time table, crc64Tables[k] advances a byte through k more zero bytes.
+var crc64Tables = func() *[8][256]uint64 {
+	t := new([8][256]uint64)
+	for i := range 256 {
+		crc := uint64(i)
+		for range 8 {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ crc64Poly
+			} else {
+				crc >>= 1
+			}
+		}
+		t[0][i] = crc
+	}
+	for i := range 256 {
+		crc := t[0][i]
+		for k := 1; k < 8; k++ {
+			crc = t[0][crc&0xFF] ^ crc>>8
+			t[k][i] = crc
+		}
+	}
+	return t
+}()
+
+// crc64 is the CRC-64 of xz: reflected, starting from and finished with all
+// bits set.
+type crc64 struct {
+	crc uint64 // running remainder, without the final inversion
+}
+
+func newCRC64() *crc64 {
+	return &crc64{crc: ^uint64(0)}
+}
+
+func (d *crc64) Write(p []byte) (int, error) {
+	n := len(p)
+	t := crc64Tables
+	crc := d.crc
+	for len(p) >= 8 {
+		crc ^= binary.LittleEndian.Uint64(p)
+		crc = t[7][crc&0xFF] ^ t[6][crc>>8&0xFF] ^ t[5][crc>>16&0xFF] ^ t[4][crc>>24&0xFF] ^
+			t[3][crc>>32&0xFF] ^ t[2][crc>>40&0xFF] ^ t[1][crc>>48&0xFF] ^ t[0][crc>>56]
+		p = p[8:]
+	}
+	for _, b := range p {
+		crc = t[0][byte(crc)^b] ^ crc>>8
+	}
+	d.crc = crc
+	return n, nil
+}
+
+func (d *crc64) Sum64() uint64 {
+	return ^d.crc
+}
+
+func (d *crc64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, d.Sum64())
+}
+
+func (d *crc64) Reset() {
+	d.crc = ^uint64(0)
+}
+
+func (d *crc64) Size() int {
+	return 8
+}
+
+func (d *crc64) BlockSize() int {
+	return 1
+}
@@ -0,0 +1,120 @@
+package checksum
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const sha256Block = 64 // bytes compressed at a time
+
+var sha256Init = [8]uint32{
+	0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A, 0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19,
+}
+
+var sha256K = [64]uint32{
+	0x428A2F98, 0x71374491, 0xB5C0FBCF, 0xE9B5DBA5, 0x3956C25B, 0x59F111F1, 0x923F82A4, 0xAB1C5ED5,
+	0xD807AA98, 0x12835B01, 0x243185BE, 0x550C7DC3, 0x72BE5D74, 0x80DEB1FE, 0x9BDC06A7, 0xC19BF174,
+	0xE49B69C1, 0xEFBE4786, 0x0FC19DC6, 0x240CA1CC, 0x2DE92C6F, 0x4A7484AA, 0x5CB0A9DC, 0x76F988DA,
+	0x983E5152, 0xA831C66D, 0xB00327C8, 0xBF597FC7, 0xC6E00BF3, 0xD5A79147, 0x06CA6351, 0x14292967,
+	0x27B70A85, 0x2E1B2138, 0x4D2C6DFC, 0x53380D13, 0x650A7354, 0x766A0ABB, 0x81C2C92E, 0x92722C85,
+	0xA2BFE8A1, 0xA81A664B, 0xC24B8B70, 0xC76C51A3, 0xD192E819, 0xD6990624, 0xF40E3585, 0x106AA070,
+	0x19A4C116, 0x1E376C08, 0x2748774C, 0x34B0BCB5, 0x391C0CB3, 0x4ED8AA4A, 0x5B9CCA4F, 0x682E6FF3,
+	0x748F82EE, 0x78A5636F, 0x84C87814, 0x8CC70208, 0x90BEFFFA, 0xA4506CEB, 0xBEF9A3F7, 0xC67178F2,
+}
+
+// sha256 is SHA-256 as specified in FIPS 180-4.
+type sha256 struct {
+	h     [8]uint32         // chaining state
+	total uint64            // bytes written so far
+	mem   [sha256Block]byte // partial block
+	n     int               // bytes held in mem
+}
+
+func newSHA256() *sha256 {
+	d := &sha256{}
+	d.Reset()
+	return d
+}
+
+func (d *sha256) Reset() {
+	d.h = sha256Init
+	d.total = 0
+	d.n = 0
+}
+
+// compress folds whole 64 byte blocks of p into the state.
+func (d *sha256) compress(p []byte) {
+	var w [64]uint32
+	for len(p) >= sha256Block {
+		for i := range 16 {
+			w[i] = binary.BigEndian.Uint32(p[4*i:])
+		}
+		for i := 16; i < 64; i++ {
+			s0 := bits.RotateLeft32(w[i-15], -7) ^ bits.RotateLeft32(w[i-15], -18) ^ w[i-15]>>3
+			s1 := bits.RotateLeft32(w[i-2], -17) ^ bits.RotateLeft32(w[i-2], -19) ^ w[i-2]>>10
+			w[i] = w[i-16] + s0 + w[i-7] + s1
+		}
+		a, b, c, e, f, g, h := d.h[0], d.h[1], d.h[2], d.h[4], d.h[5], d.h[6], d.h[7]
+		dd := d.h[3]
+		for i := range 64 {
+			s1 := bits.RotateLeft32(e, -6) ^ bits.RotateLeft32(e, -11) ^ bits.RotateLeft32(e, -25)
+			ch := e&f ^ ^e&g
+			t1 := h + s1 + ch + sha256K[i] + w[i]
+			s0 := bits.RotateLeft32(a, -2) ^ bits.RotateLeft32(a, -13) ^ bits.RotateLeft32(a, -22)
+			maj := a&b ^ a&c ^ b&c
+			t2 := s0 + maj
+			h, g, f, e = g, f, e, dd+t1
+			dd, c, b, a = c, b, a, t1+t2
+		}
+		d.h[0] += a
+		d.h[1] += b
+		d.h[2] += c
+		d.h[3] += dd
+		d.h[4] += e
+		d.h[5] += f
+		d.h[6] += g
+		d.h[7] += h
+		p = p[sha256Block:]
+	}
+}
+
+func (d *sha256) Write(p []byte) (int, error) {
+	n := len(p)
+	d.total += uint64(n)
+	if d.n > 0 { // top up the held back block first
+		c := copy(d.mem[d.n:], p)
+		d.n += c
+		p = p[c:]
+		if d.n < sha256Block {
+			return n, nil
+		}
+		d.compress(d.mem[:])
+		d.n = 0
+	}
+	whole := len(p) &^ (sha256Block - 1)
+	d.compress(p[:whole])
+	d.n = copy(d.mem[:], p[whole:])
+	return n, nil
+}
+
+// Sum pads a copy of the state, so writing can continue afterwards.
+func (d *sha256) Sum(b []byte) []byte {
+	c := *d
+	var pad [sha256Block + 8]byte
+	pad[0] = 0x80
+	padLen := sha256Block - (int(c.total%sha256Block)+8)%sha256Block // 0x80 and zeros up to the bit length
+	binary.BigEndian.PutUint64(pad[padLen:], c.total*8)
+	c.Write(pad[:padLen+8])
+	for _, v := range c.h {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+func (d *sha256) Size() int {
+	return 32
+}
+
+func (d *sha256) BlockSize() int {
+	return sha256Block
+}
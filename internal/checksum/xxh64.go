@@ -0,0 +1,121 @@
+package checksum
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// variables rather than constants so sums like prime1+prime2 wrap around
+var (
+	xxhPrime1 uint64 = 0x9E3779B185EBCA87
+	xxhPrime2 uint64 = 0xC2B2AE3D27D4EB4F
+	xxhPrime3 uint64 = 0x165667B19E3779F9
+	xxhPrime4 uint64 = 0x85EBCA77C2B2AE63
+	xxhPrime5 uint64 = 0x27D4EB2F165667C5
+)
+
+// xxh64 is xxHash64 with a zero seed. Input is consumed in 32 byte stripes
+// across four lanes, with any partial stripe held back in mem.
+type xxh64 struct {
+	v     [4]uint64 // lane accumulators
+	total uint64    // bytes written so far
+	mem   [32]byte  // partial stripe
+	n     int       // bytes held in mem
+}
+
+func newXXH64() *xxh64 {
+	d := &xxh64{}
+	d.Reset()
+	return d
+}
+
+func (d *xxh64) Reset() {
+	d.v = [4]uint64{xxhPrime1 + xxhPrime2, xxhPrime2, 0, -xxhPrime1}
+	d.total = 0
+	d.n = 0
+}
+
+func xxhRound(acc, input uint64) uint64 {
+	acc += input * xxhPrime2
+	return bits.RotateLeft64(acc, 31) * xxhPrime1
+}
+
+func xxhMerge(acc, v uint64) uint64 {
+	acc ^= xxhRound(0, v)
+	return acc*xxhPrime1 + xxhPrime4
+}
+
+func (d *xxh64) stripe(p []byte) {
+	d.v[0] = xxhRound(d.v[0], binary.LittleEndian.Uint64(p))
+	d.v[1] = xxhRound(d.v[1], binary.LittleEndian.Uint64(p[8:]))
+	d.v[2] = xxhRound(d.v[2], binary.LittleEndian.Uint64(p[16:]))
+	d.v[3] = xxhRound(d.v[3], binary.LittleEndian.Uint64(p[24:]))
+}
+
+func (d *xxh64) Write(p []byte) (int, error) {
+	n := len(p)
+	d.total += uint64(n)
+	if d.n > 0 { // top up the held back stripe first
+		c := copy(d.mem[d.n:], p)
+		d.n += c
+		p = p[c:]
+		if d.n < len(d.mem) {
+			return n, nil
+		}
+		d.stripe(d.mem[:])
+		d.n = 0
+	}
+	for len(p) >= 32 {
+		d.stripe(p)
+		p = p[32:]
+	}
+	d.n = copy(d.mem[:], p)
+	return n, nil
+}
+
+func (d *xxh64) Sum64() uint64 {
+	var h uint64
+	if d.total >= 32 {
+		v := d.v
+		h = bits.RotateLeft64(v[0], 1) + bits.RotateLeft64(v[1], 7) + bits.RotateLeft64(v[2], 12) + bits.RotateLeft64(v[3], 18)
+		for _, lane := range v {
+			h = xxhMerge(h, lane)
+		}
+	} else {
+		h = xxhPrime5
+	}
+	h += d.total
+	p := d.mem[:d.n]
+	for len(p) >= 8 {
+		h ^= xxhRound(0, binary.LittleEndian.Uint64(p))
+		h = bits.RotateLeft64(h, 27)*xxhPrime1 + xxhPrime4
+		p = p[8:]
+	}
+	if len(p) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(p)) * xxhPrime1
+		h = bits.RotateLeft64(h, 23)*xxhPrime2 + xxhPrime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		h ^= uint64(b) * xxhPrime5
+		h = bits.RotateLeft64(h, 11) * xxhPrime1
+	}
+	h ^= h >> 33 // avalanche
+	h *= xxhPrime2
+	h ^= h >> 29
+	h *= xxhPrime3
+	h ^= h >> 32
+	return h
+}
+
+func (d *xxh64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, d.Sum64())
+}
+
+func (d *xxh64) Size() int {
+	return 8
+}
+
+func (d *xxh64) BlockSize() int {
+	return 32
+}
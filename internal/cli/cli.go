@@ -26,6 +26,8 @@ func Run(args []string) sqerr.Code {
 		fmt.Fprintf(os.Stdout, "COMMANDS:\n")
 		fmt.Fprintf(os.Stdout, "enc     Compress input into a .sqz stream\n")
 		fmt.Fprintf(os.Stdout, "dec     Decompress a .sqz stream into original bytes\n")
+		fmt.Fprintf(os.Stdout, "info    Show the header and per-block statistics of .sqz streams\n")
+		fmt.Fprintf(os.Stdout, "test    Verify .sqz streams by decoding them without writing output\n")
 		fmt.Fprintf(os.Stdout, "\n")
 		fmt.Fprintf(os.Stdout, "INPUT/OUTPUT:\n")
 		fmt.Fprintf(os.Stdout, "input defaults to stdin if omitted\n")
@@ -39,6 +41,8 @@ func Run(args []string) sqerr.Code {
 		fmt.Fprintf(os.Stdout, "squish enc -codec RLE -blocksize 256KiB -o ./out.sqz\n")
 		fmt.Fprintf(os.Stdout, "squish dec -o ./input.txt ./output.sqz \n")
 		fmt.Fprintf(os.Stdout, "squish dec ./compressed.sqz \n")
+		fmt.Fprintf(os.Stdout, "squish info -json ./compressed.sqz \n")
+		fmt.Fprintf(os.Stdout, "squish test ./compressed.sqz ./other.sqz \n")
 		fmt.Fprintf(os.Stdout, "\n")
 		fmt.Fprintf(os.Stdout, "Run 'squish <command> -h' for command specific help.\n")
 	}
@@ -64,6 +68,10 @@ func Run(args []string) sqerr.Code {
 		return runEnc(args[1:])
 	case "dec":
 		return runDec(args[1:])
+	case "info":
+		return runInfo(args[1:])
+	case "test":
+		return runTest(args[1:])
 	default:
 		fmt.Printf("unknown command: %q", args[0])
 		flagSet.Usage()
@@ -1,9 +1,12 @@
 package cli
 
 import (
+	"bufio"
+	"bytes"
 	"flag"
 	"fmt"
 	"os"
+	"runtime"
 	"squish/internal/pipeline"
 	"squish/internal/sqerr"
 )
@@ -14,10 +17,11 @@ func runDec(args []string) sqerr.Code {
 	var (
 		outPath  = flagSet.String("o", "", "output file path (default stdout)")
 		outPath2 = flagSet.String("output", "", "output file path (default stdout)")
+		threads  = flagSet.Int("threads", 1, "number of blocks to decode concurrently (0 uses every core)")
 	)
 
 	flagSet.Usage = func() {
-		fmt.Fprintf(os.Stdout, "squish dec - deccompress a .sqz stream into original bytes\n")
+		fmt.Fprintf(os.Stdout, "squish dec - deccompress a .sqz or gzip stream into original bytes\n")
 		fmt.Fprintf(os.Stdout, "\n")
 		fmt.Fprintf(os.Stdout, "USAGE:\n")
 		fmt.Fprintf(os.Stdout, "  squish dec [flags] [input]\n")
@@ -28,6 +32,8 @@ func runDec(args []string) sqerr.Code {
 		fmt.Fprintf(os.Stdout, "EXAMPLES:\n")
 		fmt.Fprintf(os.Stdout, "  squish dec -o ./file ./file.sqz\n")
 		fmt.Fprintf(os.Stdout, "  squish dec ./file.sqz \n")
+		fmt.Fprintf(os.Stdout, "  squish dec -threads 8 -o ./file ./file.sqz\n")
+		fmt.Fprintf(os.Stdout, "  squish dec -o ./file ./file.gz\n")
 		fmt.Fprintf(os.Stdout, "  squish enc -codec RAW ./data.bin > data.sqz\n")
 	}
 
@@ -38,6 +44,15 @@ func runDec(args []string) sqerr.Code {
 		return sqerr.Usage
 	}
 
+	// parse the thread count
+	if *threads < 0 {
+		fmt.Fprintf(os.Stderr, "dec: invalid thread count %d", *threads)
+		return sqerr.Usage
+	}
+	if *threads == 0 {
+		*threads = runtime.NumCPU()
+	}
+
 	// parse output file
 	output := *outPath
 	if *outPath2 != "" {
@@ -89,8 +104,17 @@ func runDec(args []string) sqerr.Code {
 		defer inFile.Close()
 	}
 
-	// call the business
-	if err := pipeline.Decode(inFile, outFile); err != nil {
+	// call the business, gzip streams are recognised by their magic bytes
+	br := bufio.NewReader(inFile)
+	if magic, _ := br.Peek(len(pipeline.GzipMagic)); bytes.Equal(magic, pipeline.GzipMagic[:]) {
+		if err := pipeline.DecodeGzip(br, outFile); err != nil {
+			fmt.Fprintf(os.Stderr, "dec: decode failed %v", err)
+			return sqerr.ErrorCode(err)
+		}
+		return sqerr.Success
+	}
+	opts := pipeline.DecodeOptions{Threads: *threads}
+	if err := pipeline.DecodeWithOptions(br, outFile, opts); err != nil {
 		fmt.Fprintf(os.Stderr, "dec: decode failed %v", err)
 		return sqerr.ErrorCode(err)
 	}
@@ -5,8 +5,9 @@ import (
 	"fmt"
 	"maps"
 	"os"
+	"runtime"
 	"slices"
-	"sort"
+	"squish/internal/checksum"
 	"squish/internal/codec"
 	"squish/internal/frame"
 	"squish/internal/pipeline"
@@ -24,8 +25,15 @@ func runEnc(args []string) sqerr.Code {
 		outPath2   = flagSet.String("output", "", "output file path (default stdout)")
 		codecPipe  = flagSet.String("codec", "DEFLATE", "codec pipeline, e.g. RLE-HUFFMAN")
 		blockSize  = flagSet.String("blocksize", "128KiB", "block size (e.g. 256KiB, 1MiB)")
-		checksum   = flagSet.String("checksum", "", "checksum mode: u|c|uc")
+		csMode     = flagSet.String("checksum", "", "checksum mode: u|c|uc")
+		csAlg      = flagSet.String("checksum-alg", "crc32", "checksum algorithm: "+strings.Join(checksum.Names(), "|"))
 		listCodecs = flagSet.Bool("list-codecs", false, "list supported codecs and exit")
+		threads    = flagSet.Int("threads", 1, "number of blocks to encode concurrently (0 uses every core)")
+		index      = flagSet.Bool("index", false, "append a block index so the stream supports random access")
+		trailer    = flagSet.Bool("trailer", false, "end the stream with its total size, block count and a digest of the whole content")
+		trAlg      = flagSet.String("trailer-alg", "", "trailer digest algorithm, defaults to -checksum-alg: "+strings.Join(checksum.Names(), "|"))
+		level      = flagSet.Int("level", codec.DefaultLevel, "compression level from 1 (fastest) to 9 (smallest)")
+		format     = flagSet.String("format", "sqz", "output format: sqz|gzip")
 	)
 
 	flagSet.Usage = func() {
@@ -51,6 +59,12 @@ func runEnc(args []string) sqerr.Code {
 		fmt.Fprintf(os.Stdout, "  squish enc ./input.txt -codec RLE-HUFFMAN -o ./output.sqz\n")
 		fmt.Fprintf(os.Stdout, "  squish enc -codec RLE -blocksize 128KiB -o ./out.sqz\n")
 		fmt.Fprintf(os.Stdout, "  squish enc ./data.bin -o > data.sqz\n")
+		fmt.Fprintf(os.Stdout, "  squish enc -codec AUTO -threads 8 -o ./out.sqz ./dump.bin\n")
+		fmt.Fprintf(os.Stdout, "  squish enc -codec LZSS-HUFFMAN -level 9 -o ./archive.sqz ./logs.txt\n")
+		fmt.Fprintf(os.Stdout, "  squish enc -checksum uc -checksum-alg xxh64 -o ./archive.sqz ./logs.txt\n")
+		fmt.Fprintf(os.Stdout, "  squish enc -trailer -checksum-alg sha256 -o ./archive.sqz ./logs.txt\n")
+		fmt.Fprintf(os.Stdout, "  squish enc -checksum uc -checksum-alg xxh64 -trailer -trailer-alg sha256 -o ./archive.sqz ./logs.txt\n")
+		fmt.Fprintf(os.Stdout, "  squish enc -format gzip -o ./logs.txt.gz ./logs.txt\n")
 	}
 
 	if err := flagSet.Parse(args); err != nil {
@@ -62,34 +76,48 @@ func runEnc(args []string) sqerr.Code {
 
 	// parse and display "listCodec"
 	if *listCodecs {
-		codecNames := slices.Collect(maps.Keys(codec.StringToCodecIDMap))
-		codecNames = append(codecNames, slices.Collect(maps.Keys(codec.CodecAliases))...)
-		sort.Strings(codecNames)
-		fmt.Fprintf(os.Stdout, "%s\n", strings.Join(codecNames, ", "))
+		for _, r := range codec.Registered() {
+			kind := "lossless"
+			if !r.Lossless {
+				kind = "lossy"
+			}
+			fmt.Fprintf(os.Stdout, "%-10s 0x%02X  %-8s  %s\n", r.Name, r.ID, kind, r.Description)
+		}
+		aliases := slices.Sorted(maps.Keys(codec.CodecAliases))
+		for _, alias := range aliases {
+			fmt.Fprintf(os.Stdout, "%-10s alias for %s\n", alias, codec.CodecAliases[alias])
+		}
 		return sqerr.Success
 	}
 
-	// parse codec pipeline
-	*codecPipe = strings.ToUpper(*codecPipe)
-	for alias, expandedCodecs := range codec.CodecAliases {
-		*codecPipe = strings.ReplaceAll(*codecPipe, alias, expandedCodecs)
-	}
-	codecStrings := strings.Split(*codecPipe, "-")
-	codecList := make([]uint8, 0, len(codecStrings))
-	for _, cString := range codecStrings {
-		if cString == "" {
-			fmt.Fprintf(os.Stderr, "enc: empty codec in pipeline")
+	// parse the output format, gzip streams have no pipeline, blocks or checksum options
+	switch *format {
+	case "sqz":
+	case "gzip":
+		var sqzOnly []string
+		flagSet.Visit(func(f *flag.Flag) {
+			if slices.Contains([]string{"codec", "blocksize", "checksum", "checksum-alg", "threads", "index", "trailer", "trailer-alg"}, f.Name) {
+				sqzOnly = append(sqzOnly, "-"+f.Name)
+			}
+		})
+		if len(sqzOnly) > 0 {
+			fmt.Fprintf(os.Stderr, "enc: %s only apply to -format sqz", strings.Join(sqzOnly, ", "))
 			return sqerr.Usage
 		}
-		codecID, ok := codec.StringToCodecIDMap[strings.ToUpper(cString)]
-		if !ok {
-			fmt.Fprintf(os.Stderr, "enc: unknown codec %q (try: squish enc -list-codecs)", cString)
-			return sqerr.Unsupported
-		}
-		codecList = append(codecList, codecID)
+	default:
+		fmt.Fprintf(os.Stderr, "enc: unknown format %q (expected sqz or gzip)", *format)
+		return sqerr.Usage
 	}
-	if slices.Contains(codecList, codec.AUTO) {
-		codecList = []uint8{codec.AUTO}
+
+	// parse codec pipeline
+	codecList, codecParams, err := codec.ParsePipeline(*codecPipe)
+	if err != nil {
+		if sqerr.ErrorCode(err) == sqerr.Unsupported {
+			fmt.Fprintf(os.Stderr, "enc: %v (try: squish enc -list-codecs)", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "enc: %v", err)
+		}
+		return sqerr.ErrorCode(err)
 	}
 
 	// parse output file
@@ -116,7 +144,7 @@ func runEnc(args []string) sqerr.Code {
 
 	// parse the checksum flags
 	var checksumFlag byte
-	switch *checksum {
+	switch *csMode {
 	case "":
 		checksumFlag = frame.NoChecksum
 	case "u":
@@ -126,7 +154,28 @@ func runEnc(args []string) sqerr.Code {
 	case "uc":
 		checksumFlag = frame.UncompressedChecksum | frame.CompressedChecksum
 	default:
-		fmt.Fprintf(os.Stderr, "enc: unknown checksum value %q", *checksum)
+		fmt.Fprintf(os.Stderr, "enc: unknown checksum value %q", *csMode)
+		return sqerr.Usage
+	}
+	checksumAlg, ok := checksum.ID(*csAlg)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "enc: unknown checksum algorithm %q (expected %s)", *csAlg, strings.Join(checksum.Names(), ", "))
+		return sqerr.Usage
+	}
+	trailerAlg := checksumAlg // the trailer shares the checksum algorithm unless given its own
+	if *trAlg != "" {
+		if !*trailer {
+			fmt.Fprintf(os.Stderr, "enc: -trailer-alg needs -trailer")
+			return sqerr.Usage
+		}
+		trailerAlg, ok = checksum.ID(*trAlg)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "enc: unknown trailer algorithm %q (expected %s)", *trAlg, strings.Join(checksum.Names(), ", "))
+			return sqerr.Usage
+		}
+	}
+	if checksumFlag == frame.NoChecksum && (!*trailer || *trAlg != "") && checksumAlg != checksum.CRC32 {
+		fmt.Fprintf(os.Stderr, "enc: -checksum-alg needs a -checksum mode or -trailer without -trailer-alg")
 		return sqerr.Usage
 	}
 
@@ -155,6 +204,21 @@ func runEnc(args []string) sqerr.Code {
 		return sqerr.Usage
 	}
 
+	// parse the compression level
+	if *level < codec.MinLevel || *level > codec.MaxLevel {
+		fmt.Fprintf(os.Stderr, "enc: invalid level %d (expected %d-%d)", *level, codec.MinLevel, codec.MaxLevel)
+		return sqerr.Usage
+	}
+
+	// parse the thread count
+	if *threads < 0 {
+		fmt.Fprintf(os.Stderr, "enc: invalid thread count %d", *threads)
+		return sqerr.Usage
+	}
+	if *threads == 0 {
+		*threads = runtime.NumCPU()
+	}
+
 	// get positional arguments
 	remainingArgs := flagSet.Args()
 	input := ""
@@ -185,7 +249,26 @@ func runEnc(args []string) sqerr.Code {
 	}
 
 	// call the business
-	if err := pipeline.Encode(inFile, outFile, codecList, blockByteSize, checksumFlag); err != nil {
+	if *format == "gzip" {
+		if err := pipeline.EncodeGzip(inFile, outFile, *level); err != nil {
+			fmt.Fprintf(os.Stderr, "enc: encode failed: %v", err)
+			return sqerr.ErrorCode(err)
+		}
+		return sqerr.Success
+	}
+	opts := pipeline.EncodeOptions{
+		Codec:        codecList,
+		CodecParams:  codecParams,
+		BlockSize:    blockByteSize,
+		ChecksumMode: checksumFlag,
+		ChecksumAlg:  checksumAlg,
+		Threads:      *threads,
+		Index:        *index,
+		Trailer:      *trailer,
+		TrailerAlg:   trailerAlg,
+		Level:        *level,
+	}
+	if err := pipeline.EncodeWithOptions(inFile, outFile, opts); err != nil {
 		fmt.Fprintf(os.Stderr, "enc: encode failed: %v", err)
 		return sqerr.ErrorCode(err)
 	}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"squish/internal/pipeline"
+	"squish/internal/sqerr"
+)
+
+func runInfo(args []string) sqerr.Code {
+	flagSet := flag.NewFlagSet("info", flag.ContinueOnError)
+	flagSet.SetOutput(os.Stdout)
+	var (
+		jsonOut = flagSet.Bool("json", false, "print one JSON object per input instead of a table")
+	)
+
+	flagSet.Usage = func() {
+		fmt.Fprintf(os.Stdout, "squish info - inspect the frame and blocks of .sqz streams without decoding them\n")
+		fmt.Fprintf(os.Stdout, "\n")
+		fmt.Fprintf(os.Stdout, "USAGE:\n")
+		fmt.Fprintf(os.Stdout, "  squish info [flags] [inputs...]\n")
+		fmt.Fprintf(os.Stdout, "\n")
+		fmt.Fprintf(os.Stdout, "FLAGS:\n")
+		flagSet.PrintDefaults()
+		fmt.Fprintf(os.Stdout, "\n")
+		fmt.Fprintf(os.Stdout, "EXAMPLES:\n")
+		fmt.Fprintf(os.Stdout, "  squish info ./file.sqz\n")
+		fmt.Fprintf(os.Stdout, "  squish info -json ./a.sqz ./b.sqz\n")
+		fmt.Fprintf(os.Stdout, "  cat ./file.sqz | squish info\n")
+	}
+
+	if err := flagSet.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return sqerr.Success
+		}
+		return sqerr.Usage
+	}
+
+	// get positional arguments
+	inputs := flagSet.Args()
+	if len(inputs) == 0 {
+		inputs = []string{""}
+	}
+
+	// inspect every input, remembering the first failure
+	code := sqerr.Success
+	for _, input := range inputs {
+		name := input
+		var inFile *os.File
+		if input == "" {
+			name = "<stdin>"
+			inFile = os.Stdin
+		} else {
+			f, err := os.Open(input)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "info: failed to open input file %q\n", input)
+				if code == sqerr.Success {
+					code = sqerr.IO
+				}
+				continue
+			}
+			inFile = f
+		}
+		info, err := pipeline.Inspect(inFile)
+		if inFile != os.Stdin {
+			inFile.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "info: %s: %v\n", name, err)
+			if code == sqerr.Success {
+				code = sqerr.ErrorCode(err)
+			}
+			continue
+		}
+		if *jsonOut {
+			err = json.NewEncoder(os.Stdout).Encode(struct {
+				File string `json:"file"`
+				pipeline.StreamInfo
+			}{name, info})
+		} else {
+			err = printInfo(os.Stdout, name, info)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "info: failed to write output: %v\n", err)
+			return sqerr.IO
+		}
+	}
+	return code
+}
+
+func printInfo(w io.Writer, name string, info pipeline.StreamInfo) error {
+	index := "no"
+	if info.Index {
+		index = "yes"
+	}
+	_, err := fmt.Fprintf(w, "File:        %s\n", name)
+	fmt.Fprintf(w, "Version:     %d\n", info.Version)
+	fmt.Fprintf(w, "Codec:       %s\n", info.Codec)
+	if info.Checksum != "none" {
+		fmt.Fprintf(w, "Checksum:    %s (%s)\n", info.Checksum, info.ChecksumAlg)
+	} else {
+		fmt.Fprintf(w, "Checksum:    %s\n", info.Checksum)
+	}
+	fmt.Fprintf(w, "Index:       %s\n", index)
+	fmt.Fprintf(w, "Blocks:      %d\n", len(info.Blocks))
+	fmt.Fprintf(w, "USize:       %d\n", info.USize)
+	fmt.Fprintf(w, "CSize:       %d\n", info.CSize)
+	if info.Trailer != nil {
+		fmt.Fprintf(w, "Trailer:     %d blocks, %d bytes, %s %s\n", info.Trailer.Blocks, info.Trailer.USize, info.Trailer.Alg, info.Trailer.Digest)
+	}
+	fmt.Fprintf(w, "Stream size: %d\n", info.StreamSize)
+	fmt.Fprintf(w, "Ratio:       %.3f\n", info.Ratio)
+	if len(info.Blocks) > 0 {
+		fmt.Fprintf(w, "\n%8s %12s %10s %10s %8s  %s\n", "BLOCK", "OFFSET", "USIZE", "CSIZE", "RATIO", "CODEC")
+	}
+	for _, b := range info.Blocks {
+		ratio := 0.0
+		if b.CSize > 0 {
+			ratio = float64(b.USize) / float64(b.CSize)
+		}
+		fmt.Fprintf(w, "%8d %12d %10d %10d %8.3f  %s\n", b.Index, b.Offset, b.USize, b.CSize, ratio, b.Codec)
+	}
+	_, err2 := fmt.Fprintf(w, "\n")
+	if err == nil {
+		err = err2
+	}
+	return err
+}
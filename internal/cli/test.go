@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"squish/internal/frame"
+	"squish/internal/pipeline"
+	"squish/internal/sqerr"
+)
+
+func runTest(args []string) sqerr.Code {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.SetOutput(os.Stdout)
+	var (
+		threads = flagSet.Int("threads", 1, "number of blocks to decode concurrently (0 uses every core)")
+	)
+
+	flagSet.Usage = func() {
+		fmt.Fprintf(os.Stdout, "squish test - verify .sqz streams by fully decoding them without writing output\n")
+		fmt.Fprintf(os.Stdout, "\n")
+		fmt.Fprintf(os.Stdout, "USAGE:\n")
+		fmt.Fprintf(os.Stdout, "  squish test [flags] [inputs...]\n")
+		fmt.Fprintf(os.Stdout, "\n")
+		fmt.Fprintf(os.Stdout, "FLAGS:\n")
+		flagSet.PrintDefaults()
+		fmt.Fprintf(os.Stdout, "\n")
+		fmt.Fprintf(os.Stdout, "EXAMPLES:\n")
+		fmt.Fprintf(os.Stdout, "  squish test ./file.sqz\n")
+		fmt.Fprintf(os.Stdout, "  squish test -threads 0 ./backups/*.sqz\n")
+		fmt.Fprintf(os.Stdout, "  cat ./file.sqz | squish test\n")
+	}
+
+	if err := flagSet.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return sqerr.Success
+		}
+		return sqerr.Usage
+	}
+
+	// parse the thread count
+	if *threads < 0 {
+		fmt.Fprintf(os.Stderr, "test: invalid thread count %d", *threads)
+		return sqerr.Usage
+	}
+	if *threads == 0 {
+		*threads = runtime.NumCPU()
+	}
+
+	// get positional arguments
+	inputs := flagSet.Args()
+	if len(inputs) == 0 {
+		inputs = []string{""}
+	}
+
+	// verify every input, remembering the first failure
+	code := sqerr.Success
+	for _, input := range inputs {
+		name := input
+		var inFile *os.File
+		if input == "" {
+			name = "<stdin>"
+			inFile = os.Stdin
+		} else {
+			f, err := os.Open(input)
+			if err != nil {
+				fmt.Fprintf(os.Stdout, "%s: FAILED to open input file\n", name)
+				if code == sqerr.Success {
+					code = sqerr.IO
+				}
+				continue
+			}
+			inFile = f
+		}
+		var header frame.Header
+		opts := pipeline.DecodeOptions{Threads: *threads, Header: &header}
+		err := pipeline.DecodeWithOptions(inFile, io.Discard, opts)
+		if inFile != os.Stdin {
+			inFile.Close()
+		}
+		if err != nil {
+			var blockErr *pipeline.BlockError
+			if errors.As(err, &blockErr) {
+				fmt.Fprintf(os.Stdout, "%s: FAILED at block %d (offset %d): %v\n", name, blockErr.Block, blockErr.Offset, blockErr.Err)
+			} else {
+				fmt.Fprintf(os.Stdout, "%s: FAILED: %v\n", name, err)
+			}
+			if code == sqerr.Success {
+				code = sqerr.ErrorCode(err)
+			}
+			continue
+		}
+		if header.ChecksumMode == frame.NoChecksum && header.Flags&frame.TrailerFlag == 0 {
+			fmt.Fprintf(os.Stderr, "test: %s has no checksums, only sizes and structure were verified\n", name)
+		}
+		fmt.Fprintf(os.Stdout, "%s: OK\n", name)
+	}
+	return code
+}
@@ -0,0 +1,179 @@
+package codec
+
+import (
+	"encoding/binary"
+	"squish/internal/sqerr"
+)
+
+const (
+	rcTop      uint32 = 1 << 24               // renormalize once the range drops below this
+	rcProbBits        = 11                    // precision of the bit probabilities
+	rcProbInit uint16 = 1 << (rcProbBits - 1) // even odds before anything is seen
+	rcMoveBits        = 5                     // adaptation speed of the bit probabilities
+)
+
+type ARITHCodec struct{}
+
+// byteModel is an adaptive order-0 model over bytes. Every byte is coded as 8
+// binary decisions walking a binary tree from the msb, and each tree node
+// keeps its own adaptive probability of the next bit being 0.
+type byteModel [256]uint16
+
+func newByteModel() *byteModel {
+	var m byteModel
+	for i := range len(m) {
+		m[i] = rcProbInit
+	}
+	return &m
+}
+
+type rangeEncoder struct {
+	low       uint64 // low end of the current interval (33 bits to catch carries)
+	rng       uint32 // width of the current interval
+	cache     byte   // last byte held back in case a carry ripples into it
+	cacheSize int    // number of bytes held back (cache + pending 0xFF bytes)
+	out       []byte // encoded output
+}
+
+func newRangeEncoder(out []byte) *rangeEncoder {
+	return &rangeEncoder{rng: 0xFFFFFFFF, cacheSize: 1, out: out}
+}
+
+func (re *rangeEncoder) shiftLow() {
+	if uint32(re.low) < 0xFF000000 || re.low>>32 != 0 { // the top byte is settled
+		carry := byte(re.low >> 32)
+		held := re.cache
+		for ; re.cacheSize > 0; re.cacheSize-- { // release held bytes, applying any carry
+			re.out = append(re.out, held+carry)
+			held = 0xFF
+		}
+		re.cache = byte(re.low >> 24)
+	}
+	re.cacheSize++
+	re.low = (re.low & 0x00FFFFFF) << 8
+}
+
+func (re *rangeEncoder) encodeBit(prob *uint16, bit int) {
+	bound := (re.rng >> rcProbBits) * uint32(*prob) // split the range by the probability of a 0
+	if bit == 0 {
+		re.rng = bound
+		*prob += ((1 << rcProbBits) - *prob) >> rcMoveBits
+	} else {
+		re.low += uint64(bound)
+		re.rng -= bound
+		*prob -= *prob >> rcMoveBits
+	}
+	for re.rng < rcTop { // renormalize
+		re.rng <<= 8
+		re.shiftLow()
+	}
+}
+
+func (re *rangeEncoder) encodeByte(m *byteModel, b byte) {
+	node := 1
+	for i := 7; i >= 0; i-- {
+		bit := int(b>>i) & 0x01
+		re.encodeBit(&m[node], bit)
+		node = node<<1 | bit
+	}
+}
+
+func (re *rangeEncoder) flush() []byte {
+	for range 5 {
+		re.shiftLow()
+	}
+	return re.out
+}
+
+type rangeDecoder struct {
+	code    uint32 // position of the encoded value within the range
+	rng     uint32 // width of the current interval
+	src     []byte // encoded input
+	srcIdx  int    // where you are in the input
+	overrun bool   // whether more bytes were needed than the input holds
+}
+
+func newRangeDecoder(src []byte) *rangeDecoder {
+	rd := &rangeDecoder{rng: 0xFFFFFFFF, src: src}
+	for range 5 {
+		rd.code = rd.code<<8 | uint32(rd.nextByte())
+	}
+	return rd
+}
+
+func (rd *rangeDecoder) nextByte() byte {
+	if rd.srcIdx >= len(rd.src) {
+		rd.overrun = true
+		return 0
+	}
+	rd.srcIdx++
+	return rd.src[rd.srcIdx-1]
+}
+
+func (rd *rangeDecoder) decodeBit(prob *uint16) int {
+	var bit int
+	bound := (rd.rng >> rcProbBits) * uint32(*prob)
+	if rd.code < bound {
+		rd.rng = bound
+		*prob += ((1 << rcProbBits) - *prob) >> rcMoveBits
+	} else {
+		rd.code -= bound
+		rd.rng -= bound
+		*prob -= *prob >> rcMoveBits
+		bit = 1
+	}
+	for rd.rng < rcTop {
+		rd.rng <<= 8
+		rd.code = rd.code<<8 | uint32(rd.nextByte())
+	}
+	return bit
+}
+
+func (rd *rangeDecoder) decodeByte(m *byteModel) byte {
+	node := 1
+	for node < 256 {
+		node = node<<1 | rd.decodeBit(&m[node])
+	}
+	return byte(node)
+}
+
+func (ARITHCodec) EncodeBlock(src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return src, nil
+	}
+	var (
+		model = newByteModel()
+		out   = binary.AppendUvarint(make([]byte, 0, len(src)+16), uint64(len(src))) // store the decoded length
+		re    = newRangeEncoder(out)
+	)
+	for i := range len(src) {
+		re.encodeByte(model, src[i])
+	}
+	return re.flush(), nil
+}
+
+func (ARITHCodec) DecodeBlock(src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return src, nil
+	}
+	outLen, n := binary.Uvarint(src) // read the decoded length
+	if n <= 0 || outLen > maxBlockSize {
+		return []byte{}, sqerr.New(sqerr.Corrupt, "invalid arithmetic coded length")
+	}
+	var (
+		model = newByteModel()
+		rd    = newRangeDecoder(src[n:])
+		out   = make([]byte, 0, min(outLen, 64*uint64(len(src)))) // grown as needed past that
+	)
+	for range outLen {
+		out = append(out, rd.decodeByte(model))
+		if rd.overrun { // stop before a corrupt length grows the output any further
+			return []byte{}, sqerr.New(sqerr.Corrupt, "arithmetic coded data ended early")
+		}
+	}
+	return out, nil
+}
+
+func (ARITHCodec) IsLossless() bool {
+	return true
+}
@@ -0,0 +1,96 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func ARITHEncodeDecode(message string, t *testing.T) {
+	ac := ARITHCodec{}
+	coded, err := ac.EncodeBlock([]byte(message))
+	if err != nil {
+		t.Fatalf("ARITH encoding failed: %v", err)
+	}
+	decoded, err := ac.DecodeBlock(coded)
+	if err != nil {
+		t.Fatalf("ARITH decoding failed: %v", err)
+	}
+	if message != string(decoded) {
+		t.Fatalf("ARITH encoding mismatch: got %s - expected %s", string(decoded), message)
+	}
+}
+
+func TestARITHEncodeDecode(t *testing.T) {
+	message := "The mellow yellow fellow says hello world!"
+	ARITHEncodeDecode(message, t)
+}
+
+func TestARITHRunLength(t *testing.T) {
+	message := []byte{0, 1}
+	a, b := 1, 1
+	for i := range 30 {
+		a, b = b, a+b
+		message = append(message, bytes.Repeat([]byte{byte(i)}, b)...)
+	}
+	ARITHEncodeDecode(string(message), t)
+}
+
+func TestARITHAllBytes(t *testing.T) {
+	message := make([]byte, 0, 256*3)
+	for i := range 256 * 3 {
+		message = append(message, byte(i*7))
+	}
+	ARITHEncodeDecode(string(message), t)
+}
+
+func TestARITHSkewed(t *testing.T) {
+	message := bytes.Repeat([]byte{0}, 100000)
+	message[500] = 1
+	message[90000] = 0xFF
+	ac := ARITHCodec{}
+	coded, err := ac.EncodeBlock(message)
+	if err != nil {
+		t.Fatalf("ARITH encoding failed: %v", err)
+	}
+	if len(coded) > len(message)/40 {
+		t.Fatalf("ARITH failed to code below 1 bit per symbol: %d bytes", len(coded))
+	}
+	ARITHEncodeDecode(string(message), t)
+}
+
+func TestARITHTruncated(t *testing.T) {
+	ac := ARITHCodec{}
+	coded, err := ac.EncodeBlock([]byte("The mellow yellow fellow says hello world!"))
+	if err != nil {
+		t.Fatalf("ARITH encoding failed: %v", err)
+	}
+	_, err = ac.DecodeBlock(coded[:len(coded)/2])
+	if err == nil {
+		t.Fatalf("Missed truncated input")
+	}
+	_, n := binary.Uvarint(coded)
+	for _, c := range []struct{ outLen, pad uint64 }{
+		{maxBlockSize, 0},
+		{maxBlockSize + 1, 0},
+		{1 << 30, 1 << 24}, // a full sized payload doesn't make room for a GiB of output
+	} {
+		corrupt := append(binary.AppendUvarint(nil, c.outLen), coded[n:]...)
+		corrupt = append(corrupt, make([]byte, c.pad)...)
+		if _, err = ac.DecodeBlock(corrupt); err == nil {
+			t.Fatalf("Missed corrupt length %d", c.outLen)
+		}
+	}
+}
+
+func TestARITHEmptyMessage(t *testing.T) {
+	message := ""
+	ARITHEncodeDecode(message, t)
+}
+
+func TestARITHLossless(t *testing.T) {
+	ac := ARITHCodec{}
+	if !ac.IsLossless() {
+		t.Fatalf("ARITH is lossless, but returned lossy")
+	}
+}
@@ -1,23 +1,19 @@
 package codec
 
 import (
+	"slices"
 	"sort"
 )
 
-const (
-	AutoDepth   int = 3       // how many iterations of encodings to test
-	keepAlong   int = 3       // how many "best" results to test from prev iteration
-	minProbeLen int = 1 << 14 // minimum size of payload chunk to test compression
-	maxProbeLen int = 1 << 16 // maximum size of payload chunk to test compression
-)
-
 var (
-	primaryRecipes    = []uint8{HUFFMAN, LZSS, RLE, RLE2, RLE3, RLE4}
-	subsequentRecipes = []uint8{HUFFMAN, LZSS}
+	primaryRecipes    = []uint8{HUFFMAN, ARITH, LZSS, LZ77, LZH, RLE, RLE2, RLE3, RLE4}
+	subsequentRecipes = []uint8{HUFFMAN, MHUFFMAN, ARITH, RANS, LZSS}
+	entropyRecipes    = []uint8{HUFFMAN, MHUFFMAN, ARITH, RANS, LZH} // final stages worth carrying into the next iteration
 )
 
 type AUTOCodec struct {
 	CodecIDs []uint8
+	Level    int // compression level, zero uses the default
 }
 
 type result struct {
@@ -25,13 +21,13 @@ type result struct {
 	payload  []byte
 }
 
-func getPayloadProbe(src []byte) []byte {
-	if len(src) < minProbeLen {
+func getPayloadProbe(src []byte, params levelParams) []byte {
+	if len(src) < params.minProbeLen {
 		return src
 	}
-	probeLength := len(src) / 8                 // default to 1/8th of the source payload
-	probeLength = max(probeLength, minProbeLen) // clamp it on the low end
-	probeLength = min(probeLength, maxProbeLen) // clamp it on the high end
+	probeLength := len(src) / 8                        // default to 1/8th of the source payload
+	probeLength = max(probeLength, params.minProbeLen) // clamp it on the low end
+	probeLength = min(probeLength, params.maxProbeLen) // clamp it on the high end
 	if probeLength == len(src) {
 		return src // compress the entire payload if it is small
 	}
@@ -40,11 +36,20 @@ func getPayloadProbe(src []byte) []byte {
 	return src[startIdx:endIdx]
 }
 
-func getFilteredResults(results []result) []result {
+func getFilteredResults(results []result, keepAlong int) []result {
 	sort.Slice(results, func(i, j int) bool {
 		return len(results[i].payload) < len(results[j].payload)
 	})
-	return results[:keepAlong] // keep the 'keepAlong' number of results into next iteration
+	return results[:min(keepAlong, len(results))] // keep the 'keepAlong' number of results into next iteration
+}
+
+func (AC *AUTOCodec) WithLevel(level int) Codec {
+	return &AUTOCodec{Level: level}
+}
+
+func (AC *AUTOCodec) encoder(codecID uint8) Codec {
+	c, _ := NewEncoder(codecID, nil, AC.Level) // recipes only hold registered codecs
+	return c
 }
 
 func (AC *AUTOCodec) EncodeBlock(src []byte) ([]byte, error) {
@@ -52,12 +57,13 @@ func (AC *AUTOCodec) EncodeBlock(src []byte) ([]byte, error) {
 		return src, nil
 	}
 	var (
-		probe   []byte   = getPayloadProbe(src)                   // get the payload test chunk
-		results []result = make([]result, 0, len(primaryRecipes)) // make a slice to store results
+		params  levelParams = getLevelParams(AC.Level)               // effort to spend searching
+		probe   []byte      = getPayloadProbe(src, params)           // get the payload test chunk
+		results []result    = make([]result, 0, len(primaryRecipes)) // make a slice to store results
 	)
 	for _, codecID := range primaryRecipes {
 		resID := []uint8{codecID} // make a results slice for each primary recipe
-		resPayload, err := CodecMap[codecID].EncodeBlock(probe)
+		resPayload, err := AC.encoder(codecID).EncodeBlock(probe)
 		if err != nil {
 			continue
 		}
@@ -66,14 +72,17 @@ func (AC *AUTOCodec) EncodeBlock(src []byte) ([]byte, error) {
 			payload:  resPayload,
 		})
 	}
-	for range AutoDepth - 1 { // loop through the iterations
+	if params.autoDepth <= 1 {
+		results = getFilteredResults(results, params.keepAlong) // no iterations, just rank the primaries
+	}
+	for range params.autoDepth - 1 { // loop through the iterations
 		newResults := make([]result, 0, len(subsequentRecipes)*len(results)) // new iteration results
 		for j := range len(results) {                                        // go through the old results
-			if results[j].codecIDs[len(results[j].codecIDs)-1] == HUFFMAN {
-				newResults = append(newResults, results[j]) // carry huffman results into next iteration
+			if slices.Contains(entropyRecipes, results[j].codecIDs[len(results[j].codecIDs)-1]) {
+				newResults = append(newResults, results[j]) // carry entropy coded results into next iteration
 			}
 			for _, codecID := range subsequentRecipes { // go through the next recipes
-				res, err := CodecMap[codecID].EncodeBlock(results[j].payload) // encode further
+				res, err := AC.encoder(codecID).EncodeBlock(results[j].payload) // encode further
 				if err != nil {
 					continue
 				}
@@ -82,7 +91,7 @@ func (AC *AUTOCodec) EncodeBlock(src []byte) ([]byte, error) {
 				newResults = append(newResults, result{codecIDs: newCodecIDs, payload: res}) // store the result
 			}
 		}
-		results = getFilteredResults(newResults) // get the 'keepAlong' best results
+		results = getFilteredResults(newResults, params.keepAlong) // get the 'keepAlong' best results
 	}
 	AC.CodecIDs = append([]uint8(nil), results[0].codecIDs...) // store the best of the best
 	if len(probe) == len(src) {
@@ -93,7 +102,7 @@ func (AC *AUTOCodec) EncodeBlock(src []byte) ([]byte, error) {
 		err  error
 	)
 	for _, codecID := range results[0].codecIDs {
-		data, err = CodecMap[codecID].EncodeBlock(data) // encode it with best codecs
+		data, err = AC.encoder(codecID).EncodeBlock(data) // encode it with best codecs
 		if err != nil {
 			return data, err
 		}
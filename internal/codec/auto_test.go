@@ -14,7 +14,8 @@ func AUTOEncodeDecode(message string, t *testing.T) {
 	}
 	decoded := coded
 	for i := len(ac.CodecIDs) - 1; i >= 0; i-- {
-		decoded, err = CodecMap[uint8(ac.CodecIDs[i])].DecodeBlock(decoded)
+		c, _ := New(ac.CodecIDs[i])
+		decoded, err = c.DecodeBlock(decoded)
 		if err != nil {
 			t.Fatalf("AUTO decoding failed on codec ID %d: %v", ac.CodecIDs[i], err)
 		}
@@ -50,3 +51,30 @@ func TestAUTOLossless(t *testing.T) {
 		t.Fatalf("AUTO is lossless, but returned lossy")
 	}
 }
+
+func TestAUTOLevels(t *testing.T) {
+	message := []byte{0, 1}
+	a, b := 1, 1
+	for i := range 25 {
+		a, b = b, a+b
+		message = append(message, bytes.Repeat([]byte{byte(i)}, b%1000)...)
+	}
+	for _, level := range []int{MinLevel, DefaultLevel, MaxLevel} {
+		ac := AUTOCodec{Level: level}
+		coded, err := ac.EncodeBlock(message)
+		if err != nil {
+			t.Fatalf("AUTO encoding failed at level %d: %v", level, err)
+		}
+		decoded := coded
+		for i := len(ac.CodecIDs) - 1; i >= 0; i-- {
+			c, _ := New(ac.CodecIDs[i])
+			decoded, err = c.DecodeBlock(decoded)
+			if err != nil {
+				t.Fatalf("AUTO decoding failed at level %d on codec ID %d: %v", level, ac.CodecIDs[i], err)
+			}
+		}
+		if !bytes.Equal(message, decoded) {
+			t.Fatalf("AUTO encoding mismatch at level %d", level)
+		}
+	}
+}
@@ -29,123 +29,29 @@ func cumSum(bytes []int) {
 	}
 }
 
-func initializeRank(s []uint8, rank, sa []int) int {
+// buildCircularSuffixArray returns the start of every rotation of s in sorted
+// order. Rotations are the suffixes of s doubled, cut to len(s) bytes, so they
+// sort as those suffixes do once a sentinel below every byte ends the doubled
+// string. Identical rotations (periodic input) may come in any order, which
+// doesn't change the BWT output.
+func buildCircularSuffixArray(s []byte) []int32 {
 	var (
-		b byte
-		i int
+		n  = len(s)
+		t  = make([]int32, 2*n+1) // s twice with bytes shifted up by one, then the zero sentinel
+		sa = make([]int32, 2*n+1)
 	)
-	count := histogram(s)  // get histogram
-	cumSum(count)          // get cumulative sum
-	for i = range len(s) { // build count-sorted array
-		b = s[i]         // for each letter
-		sa[count[b]] = i // place suffix start index i into SA bucket for byte b
-		count[b]++       // increment index for stability
-	}
-	rank[sa[0]] = 0
-	r := 1
-	for i = 1; i < len(s); i++ {
-		if s[sa[i]] != s[sa[i-1]] {
-			r++
-		}
-		rank[sa[i]] = r - 1
-	}
-	return r
-}
-
-func sortBySecondKey(inSA, outSA, rank []int, k int, count []int) {
-	var (
-		key int
-		i   int
-		j   int
-	)
-	for i = range len(count) {
-		count[i] = 0 // wipe your histogram
-	}
-	for i = range len(inSA) { // get histogram of ranks for second half of suffix prefix
-		j = inSA[i] + k
-		if j >= len(inSA) {
-			j -= len(inSA)
-		}
-		key = rank[j]
-		count[key]++
-	}
-	cumSum(count)             // get cumulative sum of histogram
-	for i = range len(inSA) { // count-sort suffix array by ranks
-		j = inSA[i] + k
-		if j >= len(inSA) {
-			j -= len(inSA)
-		}
-		key = rank[j]
-		outSA[count[key]] = inSA[i]
-		count[key]++
-	}
-}
-
-func sortByFirstKey(inSA, outSA, rank []int, count []int) {
-	var (
-		key int
-		i   int
-	)
-	for i = range len(count) {
-		count[i] = 0 // wipe your histogram
-	}
-	for i = range len(inSA) { // get histogram of ranks for first half of suffix prefex
-		count[rank[inSA[i]]]++
-	}
-	cumSum(count)             // get cumulative sum of histogram
-	for i = range len(inSA) { // count-sort suffix array by ranks
-		key = int(rank[inSA[i]])
-		outSA[count[key]] = inSA[i]
-		count[key]++
-	}
-}
-
-func buildCircularSuffixArray(s []byte) []int {
-	var (
-		count   = make([]int, len(s))         // scratch count sort slice to not re-allocate
-		sa      = make([]int, len(s))         // suffix array indexes
-		tmpsa   = make([]int, len(s))         // next iterations of radix sorted suffix array indexes
-		rank    = make([]int, len(s))         // sorted ranking of suffix array indexes
-		tmpRank = make([]int, len(s))         // next iteration of sorted ranking of suffix array indexes
-		maxRank = initializeRank(s, rank, sa) // highest rank achieved per sort
-		newr    int                           // next iteration highest rank achieved
-		prev    int                           // temp suffix
-		cur     int                           // temp suffix
-		prevA   int                           // temp ranks
-		curA    int                           // temp ranks
-		prevB   int                           // temp ranks
-		curB    int                           // temp ranks
-		k       = 1                           // suffix prefix length
-		i       int                           // iterator variable
-	)
-	for k < len(s) && maxRank < len(s) {
-		sortBySecondKey(sa, tmpsa, rank, k, count[:maxRank+1]) // radix sort suffix array by second key rank[i + k]
-		sa, tmpsa = tmpsa, sa                                  // save it off
-		sortByFirstKey(sa, tmpsa, rank, count[:maxRank+1])     // radix sort suffix array by first key rank[i]
-		sa, tmpsa = tmpsa, sa                                  // save it off
-		tmpRank[sa[0]] = 0
-		newr = 1
-		for i = 1; i < len(s); i++ { // loop through the suffixes
-			prev = sa[i-1]     // previous element
-			cur = sa[i]        // current element
-			prevA = rank[prev] // previous element ranking
-			curA = rank[cur]   // current element ranking
-			prev += k
-			if prev >= len(s) {
-				prev -= len(s)
-			}
-			prevB = rank[prev]
-			curB = rank[(cur+k)%len(s)]
-			if (prevA != curA) || (prevB != curB) { // if they are not equal in rank
-				newr += 1 // new max rank is increased
-			}
-			tmpRank[cur] = newr - 1
+	for i := range n {
+		t[i] = int32(s[i]) + 1
+		t[i+n] = t[i]
+	}
+	suffixArray(t, sa, 257)
+	rotations := sa[:0] // keep the suffixes starting in the first copy, reusing sa
+	for _, p := range sa {
+		if int(p) < n {
+			rotations = append(rotations, p)
 		}
-		rank, tmpRank = tmpRank, rank // save off the newly calculated ranks
-		maxRank = newr                // save off the new max rank
-		k *= 2                        // double the suffix prefix length
 	}
-	return sa
+	return rotations
 }
 
 func (BWTCodec) EncodeBlock(src []byte) ([]byte, error) {
@@ -159,14 +65,11 @@ func (BWTCodec) EncodeBlock(src []byte) ([]byte, error) {
 		p        int
 	)
 	for i := range len(src) {
-		p = sa[i] // get the current suffix
+		p = int(sa[i]) // get the current suffix
 		outBytes[i] = src[(p-1+len(src))%len(src)]
 		if p == 0 {
-			//outBytes[i] = src[len(src)-1] // element to add is index of suffix array - 1 (wrap around)
 			primary = uint64(i) // if you are at 0 in SA (whole input) you found your primary index
-		} //else {
-		//	outBytes[i] = src[p-1] // element to add is index of suffix array - 1
-		//}
+		}
 	}
 	outBytes = binary.BigEndian.AppendUint64(outBytes, primary) // save the 8 byte big-endian primary index to the tail of your data
 	return outBytes, nil
@@ -2,6 +2,9 @@ package codec
 
 import (
 	"bytes"
+	"math/rand"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -46,3 +49,66 @@ func TestBWTLossless(t *testing.T) {
 		t.Fatalf("BWT is lossless, but returned lossy")
 	}
 }
+
+func TestBWTMatchesRotationSort(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for trial := range 500 {
+		message := make([]byte, 1+rng.Intn(40))
+		for i := range message {
+			message[i] = "aab\x00\xff"[rng.Intn(5)] // few symbols, so plenty of repeats and periodic inputs
+		}
+		rotations := make([][]byte, len(message))
+		for i := range message {
+			rotations[i] = append(append([]byte{}, message[i:]...), message[:i]...)
+		}
+		slices.SortFunc(rotations, bytes.Compare)
+		expected := make([]byte, 0, len(message))
+		for _, r := range rotations {
+			expected = append(expected, r[len(r)-1])
+		}
+		coded, err := BWTCodec{}.EncodeBlock(message)
+		if err != nil {
+			t.Fatalf("BWT encoding failed: %v", err)
+		}
+		if !bytes.Equal(coded[:len(message)], expected) {
+			t.Fatalf("BWT of %q trial %d: got %q - expected %q", message, trial, coded[:len(message)], expected)
+		}
+		BWTEncodeDecode(string(message), t)
+	}
+}
+
+func TestBWTPeriodic(t *testing.T) {
+	BWTEncodeDecode(strings.Repeat("abc", 1000), t)
+	BWTEncodeDecode(strings.Repeat("\x00", 1000), t)
+}
+
+func bwtBenchmarkInputs() map[string][]byte {
+	const n = 1 << 22
+	var (
+		rng      = rand.New(rand.NewSource(1))
+		binary   = make([]byte, n) // two symbols, long repeated contexts
+		periodic = make([]byte, n) // one short period, the worst case for prefix doubling
+		text     bytes.Buffer      // repeated lines with small edits
+	)
+	for i := range n {
+		binary[i] = "ab"[rng.Intn(2)]
+		periodic[i] = byte(i % 7)
+	}
+	line := []byte("2026-10-18T12:00:00Z INFO squish encoded block with LZH at level 6\n")
+	for text.Len() < n {
+		line[rng.Intn(len(line)-1)] = byte('0' + rng.Intn(10))
+		text.Write(line)
+	}
+	return map[string][]byte{"binary": binary, "periodic": periodic, "logs": text.Bytes()[:n]}
+}
+
+func BenchmarkBWTEncode(b *testing.B) {
+	for name, input := range bwtBenchmarkInputs() {
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for b.Loop() {
+				BWTCodec{}.EncodeBlock(input)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package codec
+
+import (
+	"math/bits"
+	"slices"
+)
+
+// pmItem is a coin in the package-merge algorithm, either a single symbol or a
+// package of two items from the previous denomination.
+type pmItem struct {
+	weight int     // frequency of the symbol, or the sum of the packaged items
+	symbol int     // symbol of a leaf, -1 for packages
+	left   *pmItem // packaged items
+	right  *pmItem
+}
+
+// buildCodeLengths returns optimal prefix code lengths for the frequencies,
+// with no code longer than maxLen bits. Symbols with a zero frequency get no
+// code and a lone symbol gets a 1 bit code. maxLen is raised when it is too
+// short to give every used symbol a code.
+//
+// It uses the package-merge algorithm: every symbol is a coin worth 2^-maxLen
+// of each denomination, coins of a denomination are paired into packages for
+// the next larger one, and the cheapest 2n-2 items of the largest denomination
+// decide the lengths. A symbol's code length is how many times it was picked.
+func buildCodeLengths(freqs []int, maxLen int) []uint8 {
+	var (
+		lengths = make([]uint8, len(freqs)) // code length of each symbol
+		leaves  []*pmItem                   // used symbols, cheapest first
+	)
+	for i, f := range freqs {
+		if f > 0 {
+			leaves = append(leaves, &pmItem{weight: f, symbol: i})
+		}
+	}
+	switch len(leaves) {
+	case 0:
+		return lengths
+	case 1:
+		lengths[leaves[0].symbol] = 1
+		return lengths
+	}
+	slices.SortStableFunc(leaves, func(a, b *pmItem) int { return a.weight - b.weight })
+	maxLen = max(maxLen, bits.Len(uint(len(leaves)-1))) // n symbols need at least log2(n) bits
+	items := leaves
+	for range maxLen - 1 {
+		packages := make([]*pmItem, 0, len(items)/2)
+		for i := 0; i+1 < len(items); i += 2 {
+			packages = append(packages, &pmItem{weight: items[i].weight + items[i+1].weight, symbol: -1, left: items[i], right: items[i+1]})
+		}
+		items = mergeItems(leaves, packages)
+	}
+	var count func(item *pmItem)
+	count = func(item *pmItem) {
+		if item.symbol >= 0 {
+			lengths[item.symbol]++
+			return
+		}
+		count(item.left)
+		count(item.right)
+	}
+	for _, item := range items[:2*len(leaves)-2] {
+		count(item)
+	}
+	return lengths
+}
+
+// mergeItems merges two lists sorted by weight, leaves first on ties.
+func mergeItems(leaves []*pmItem, packages []*pmItem) []*pmItem {
+	merged := make([]*pmItem, 0, len(leaves)+len(packages))
+	i, j := 0, 0
+	for i < len(leaves) || j < len(packages) {
+		if j == len(packages) || (i < len(leaves) && leaves[i].weight <= packages[j].weight) {
+			merged = append(merged, leaves[i])
+			i++
+		} else {
+			merged = append(merged, packages[j])
+			j++
+		}
+	}
+	return merged
+}
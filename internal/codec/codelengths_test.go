@@ -0,0 +1,104 @@
+package codec
+
+import (
+	"slices"
+	"testing"
+)
+
+func fibonacciFrequencies(n int) []int {
+	freqs := make([]int, n)
+	a, b := 1, 1
+	for i := range n {
+		freqs[i] = a
+		a, b = b, a+b
+	}
+	return freqs
+}
+
+// huffmanCost is the number of bits an unlimited Huffman code needs, the sum
+// of the weights of every merged node.
+func huffmanCost(freqs []int) int {
+	var weights []int
+	for _, f := range freqs {
+		if f > 0 {
+			weights = append(weights, f)
+		}
+	}
+	cost := 0
+	for len(weights) > 1 {
+		slices.Sort(weights)
+		merged := weights[0] + weights[1]
+		cost += merged
+		weights = append(weights[2:], merged)
+	}
+	return cost
+}
+
+func codeCost(freqs []int, lengths []uint8) int {
+	cost := 0
+	for i, f := range freqs {
+		cost += f * int(lengths[i])
+	}
+	return cost
+}
+
+func CheckCodeLengths(freqs []int, maxLen int, t *testing.T) []uint8 {
+	lengths := buildCodeLengths(freqs, maxLen)
+	kraft := uint64(0) // sum of 2^(maxLen-length), a complete code sums to 2^maxLen
+	for i, l := range lengths {
+		if (freqs[i] > 0) != (l > 0) {
+			t.Fatalf("Code length %d for symbol %d with frequency %d", l, i, freqs[i])
+		}
+		if int(l) > maxLen {
+			t.Fatalf("Code length %d exceeds the limit %d", l, maxLen)
+		}
+		if l > 0 {
+			kraft += 1 << (maxLen - int(l))
+		}
+	}
+	if kraft != 1<<maxLen {
+		t.Fatalf("Code lengths with limit %d don't form a complete prefix code", maxLen)
+	}
+	return lengths
+}
+
+func TestCodeLengthsFibonacci(t *testing.T) {
+	freqs := fibonacciFrequencies(40) // unlimited, the code is 39 bits deep
+	unlimited := CheckCodeLengths(freqs, 63, t)
+	if slices.Max(unlimited) != 39 {
+		t.Fatalf("Unlimited Fibonacci code is %d bits deep, expected 39", slices.Max(unlimited))
+	}
+	if codeCost(freqs, unlimited) != huffmanCost(freqs) {
+		t.Fatalf("Unlimited code costs %d bits, Huffman costs %d", codeCost(freqs, unlimited), huffmanCost(freqs))
+	}
+	prev := codeCost(freqs, unlimited)
+	for maxLen := 38; maxLen >= 6; maxLen-- {
+		cost := codeCost(freqs, CheckCodeLengths(freqs, maxLen, t))
+		if cost < prev {
+			t.Fatalf("Code limited to %d bits costs %d, less than %d with a looser limit", maxLen, cost, prev)
+		}
+		prev = cost
+	}
+}
+
+func TestCodeLengthsLargeAlphabet(t *testing.T) {
+	freqs := make([]int, 286) // deflate's literal/length alphabet
+	for i := range freqs {
+		freqs[i] = 1 + (i*i)%97
+	}
+	freqs[100] = 0
+	CheckCodeLengths(freqs, 15, t)
+	CheckCodeLengths(freqs, 9, t) // the tightest limit that fits 285 symbols
+}
+
+func TestCodeLengthsEdgeCases(t *testing.T) {
+	if lengths := buildCodeLengths(make([]int, 4), 15); slices.Max(lengths) != 0 {
+		t.Fatalf("Unused symbols were given codes: %v", lengths)
+	}
+	if lengths := buildCodeLengths([]int{0, 5, 0}, 15); !slices.Equal(lengths, []uint8{0, 1, 0}) {
+		t.Fatalf("Lone symbol got lengths %v, expected a 1 bit code", lengths)
+	}
+	if lengths := buildCodeLengths(fibonacciFrequencies(8), 2); slices.Max(lengths) != 3 {
+		t.Fatalf("Too short a limit wasn't raised to fit every symbol: %v", lengths)
+	}
+}
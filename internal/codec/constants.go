@@ -1,5 +1,12 @@
 package codec
 
+import (
+	"fmt"
+	"slices"
+	"squish/internal/sqerr"
+	"strings"
+)
+
 // codec IDs
 const (
 	RAW = iota
@@ -17,49 +24,57 @@ const (
 	AUTO
 	MTF
 	BWT
+	ARITH
+	RANS
+	LZ77
+	MHUFFMAN
+	LZH
+	MTF1
+	MTF2
 )
 
-// codec key map
-var CodecMap = map[uint8]Codec{
-	RAW:     RAWCodec{},
-	RLE:     RLECodec{byteLength: 1, lossless: true},
-	RLE2:    RLECodec{byteLength: 2, lossless: true},
-	RLE3:    RLECodec{byteLength: 3, lossless: true},
-	RLE4:    RLECodec{byteLength: 4, lossless: true},
-	LRLE:    RLECodec{byteLength: 1, lossless: false},
-	LRLE2:   RLECodec{byteLength: 2, lossless: false},
-	LRLE3:   RLECodec{byteLength: 3, lossless: false},
-	LRLE4:   RLECodec{byteLength: 4, lossless: false},
-	ZRLE:    ZRLECodec{},
-	HUFFMAN: HUFFMANCodec{},
-	LZSS:    LZSSCodec{},
-	AUTO:    &AUTOCodec{},
-	MTF:     MTFCodec{},
-	BWT:     BWTCodec{},
-}
+// maxBlockSize is the largest block a stream holds (frame.MaxBlockSize), it
+// bounds the decoded length a corrupt payload can claim.
+const maxBlockSize = 1<<24 - 1
 
-// codec string to codec ID map
-var StringToCodecIDMap = map[string]uint8{
-	"RAW":     RAW,
-	"RLE":     RLE,
-	"RLE2":    RLE2,
-	"RLE3":    RLE3,
-	"RLE4":    RLE4,
-	"LRLE":    LRLE,
-	"LRLE2":   LRLE2,
-	"LRLE3":   LRLE3,
-	"LRLE4":   LRLE4,
-	"ZRLE":    ZRLE,
-	"HUFFMAN": HUFFMAN,
-	"LZSS":    LZSS,
-	"AUTO":    AUTO,
-	"MTF":     MTF,
-	"BWT":     BWT,
+// built-in codecs
+func init() {
+	for _, c := range []struct {
+		id      uint8
+		name    string
+		factory Factory
+		props   Properties
+	}{
+		{RAW, "RAW", func() Codec { return RAWCodec{} }, Properties{true, "stores data as is"}},
+		{RLE, "RLE", func() Codec { return RLECodec{byteLength: 1, lossless: true} }, Properties{true, "run-length coding of bytes"}},
+		{RLE2, "RLE2", func() Codec { return RLECodec{byteLength: 2, lossless: true} }, Properties{true, "run-length coding of 2 byte values"}},
+		{RLE3, "RLE3", func() Codec { return RLECodec{byteLength: 3, lossless: true} }, Properties{true, "run-length coding of 3 byte values"}},
+		{RLE4, "RLE4", func() Codec { return RLECodec{byteLength: 4, lossless: true} }, Properties{true, "run-length coding of 4 byte values"}},
+		{LRLE, "LRLE", func() Codec { return RLECodec{byteLength: 1, lossless: false} }, Properties{false, "run-length coding of nearly equal bytes"}},
+		{LRLE2, "LRLE2", func() Codec { return RLECodec{byteLength: 2, lossless: false} }, Properties{false, "run-length coding of nearly equal 2 byte values"}},
+		{LRLE3, "LRLE3", func() Codec { return RLECodec{byteLength: 3, lossless: false} }, Properties{false, "run-length coding of nearly equal 3 byte values"}},
+		{LRLE4, "LRLE4", func() Codec { return RLECodec{byteLength: 4, lossless: false} }, Properties{false, "run-length coding of nearly equal 4 byte values"}},
+		{ZRLE, "ZRLE", func() Codec { return ZRLECodec{} }, Properties{true, "run-length coding of zeros, for MTF output"}},
+		{HUFFMAN, "HUFFMAN", func() Codec { return HUFFMANCodec{} }, Properties{true, "canonical Huffman coding"}},
+		{LZSS, "LZSS", func() Codec { return LZSSCodec{} }, Properties{true, "dictionary coding in a 256 B to 16 KiB window"}},
+		{AUTO, "AUTO", func() Codec { return &AUTOCodec{} }, Properties{true, "searches for the best pipeline per block"}},
+		{MTF, "MTF", func() Codec { return MTFCodec{} }, Properties{true, "move-to-front transform"}},
+		{BWT, "BWT", func() Codec { return BWTCodec{} }, Properties{true, "Burrows-Wheeler transform"}},
+		{ARITH, "ARITH", func() Codec { return ARITHCodec{} }, Properties{true, "adaptive arithmetic coding"}},
+		{RANS, "RANS", func() Codec { return RANSCodec{} }, Properties{true, "static rANS entropy coding"}},
+		{LZ77, "LZ77", func() Codec { return LZ77Codec{} }, Properties{true, "dictionary coding across the whole block"}},
+		{MHUFFMAN, "MHUFFMAN", func() Codec { return MHUFFMANCodec{} }, Properties{true, "multi-table Huffman coding"}},
+		{LZH, "LZH", func() Codec { return LZHCodec{} }, Properties{true, "DEFLATE-style dictionary and Huffman coding"}},
+		{MTF1, "MTF1", func() Codec { return MTFCodec{variant: mtfOneFromFront} }, Properties{true, "move-to-front transform, moving to the second slot first"}},
+		{MTF2, "MTF2", func() Codec { return MTFCodec{variant: mtfTwoStep} }, Properties{true, "MTF1, but holding the second slot right after a repeated byte"}},
+	} {
+		mustRegister(c.id, c.name, c.factory, c.props)
+	}
 }
 
 // codec aliases
 var CodecAliases = map[string]string{
-	"DEFLATE": "LZSS-HUFFMAN",
+	"DEFLATE": "LZH",
 }
 
 // codec interface
@@ -68,3 +83,102 @@ type Codec interface {
 	DecodeBlock(src []byte) (dst []byte, err error)
 	IsLossless() bool
 }
+
+// CodecName returns the canonical name of a codec ID.
+func CodecName(id uint8) string {
+	if r, ok := Lookup(id); ok {
+		return r.Name
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", id)
+}
+
+// PipelineString formats a list of codec IDs, with the parameters stored
+// alongside them, in the pipeline syntax accepted by ParsePipeline, e.g.
+// "RLE(stride=3)-HUFFMAN".
+func PipelineString(codecIDs []uint8, params [][]byte) string {
+	names := make([]string, len(codecIDs))
+	for i, id := range codecIDs {
+		names[i] = CodecName(id)
+		if blob := ParamsAt(params, i); len(blob) > 0 {
+			p, err := UnmarshalParams(blob)
+			if err != nil {
+				names[i] += "(?)"
+			} else {
+				names[i] += "(" + p.String() + ")"
+			}
+		}
+	}
+	return strings.Join(names, "-")
+}
+
+// ParsePipeline converts a pipeline string such as "RLE(stride=3)-HUFFMAN"
+// into the list of codec IDs it names and their serialized parameters, nil
+// when no codec is given any. Names are case-insensitive and aliases are
+// expanded.
+func ParsePipeline(pipeline string) ([]uint8, [][]byte, error) {
+	var (
+		codecStrings []string
+		paramStrings []string // inside of the parentheses after each codec
+	)
+	for _, cString := range strings.Split(strings.ToUpper(pipeline), "-") {
+		pString := ""
+		if name, rest, ok := strings.Cut(cString, "("); ok {
+			if !strings.HasSuffix(rest, ")") {
+				return nil, nil, sqerr.New(sqerr.Usage, fmt.Sprintf("unclosed parameters in codec %q", cString))
+			}
+			cString, pString = name, strings.TrimSuffix(rest, ")")
+		}
+		if expandedCodecs, ok := CodecAliases[cString]; ok {
+			expanded := strings.Split(expandedCodecs, "-")
+			if pString != "" && len(expanded) > 1 {
+				return nil, nil, sqerr.New(sqerr.Usage, fmt.Sprintf("alias %s stands for several codecs and takes no parameters", cString))
+			}
+			for range expanded[1:] {
+				paramStrings = append(paramStrings, "")
+			}
+			codecStrings = append(codecStrings, expanded...)
+		} else {
+			codecStrings = append(codecStrings, cString)
+		}
+		paramStrings = append(paramStrings, pString)
+	}
+	var (
+		codecList = make([]uint8, 0, len(codecStrings))
+		params    = make([][]byte, len(codecStrings))
+		hasParams = false
+	)
+	for i, cString := range codecStrings {
+		if cString == "" {
+			return nil, nil, sqerr.New(sqerr.Usage, "empty codec in pipeline")
+		}
+		codecID, ok := CodecID(cString)
+		if !ok {
+			return nil, nil, sqerr.New(sqerr.Unsupported, fmt.Sprintf("unknown codec %q", cString))
+		}
+		codecList = append(codecList, codecID)
+		if paramStrings[i] == "" {
+			continue
+		}
+		c, _ := New(codecID)
+		conf, ok := c.(Configurable)
+		if !ok {
+			return nil, nil, sqerr.New(sqerr.Usage, fmt.Sprintf("codec %s takes no parameters", cString))
+		}
+		p, err := parseParams(paramStrings[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		if c, err = conf.WithParams(p); err != nil {
+			return nil, nil, err
+		}
+		params[i] = MarshalParams(codecID, c)
+		hasParams = hasParams || len(params[i]) > 0
+	}
+	if slices.Contains(codecList, AUTO) {
+		return []uint8{AUTO}, nil, nil // AUTO picks the whole pipeline itself
+	}
+	if !hasParams {
+		params = nil
+	}
+	return codecList, params, nil
+}
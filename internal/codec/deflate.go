@@ -0,0 +1,157 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"squish/internal/bitio"
+)
+
+const (
+	deflateBlockSize = 1 << 16   // input bytes coded per deflate block
+	deflateMaxStored = 1<<16 - 1 // most bytes a stored block holds
+	deflateStored    = 0         // block type of stored (uncompressed) blocks
+	deflateFixed     = 1         // block type of blocks using the fixed codes
+	deflateDynamic   = 2         // block type of blocks carrying their own codes
+	deflateHeaderLen = 3         // bits of the final flag and block type
+	deflateStoredLen = 2 + 2     // LEN and NLEN bytes of a stored block
+)
+
+// DeflateWriter compresses into a raw deflate (RFC 1951) stream, as read by
+// compress/flate, zlib and everything else speaking gzip. It shares LZH's
+// parser and code construction, the streams differ only in bit order: deflate
+// packs bits lsb first and so stores its Huffman codes bit-reversed. Input is
+// coded in 64KiB blocks that match back into the previous 32KiB, each block
+// stored as is when coding doesn't make it smaller.
+type DeflateWriter struct {
+	w      io.Writer
+	bw     *bitio.LSBBitWriter
+	params levelParams
+	buf    []byte // history followed by input not yet coded
+	start  int    // first byte of buf not yet coded
+	err    error
+	closed bool
+}
+
+// NewDeflateWriter returns a DeflateWriter writing to w at the given level,
+// zero uses the default level. Close must be called to finish the stream.
+func NewDeflateWriter(w io.Writer, level int) *DeflateWriter {
+	return &DeflateWriter{
+		w:      w,
+		bw:     bitio.NewLSBBitWriter(w),
+		params: getLevelParams(level),
+	}
+}
+
+func (dw *DeflateWriter) Write(p []byte) (int, error) {
+	if dw.err != nil {
+		return 0, dw.err
+	}
+	if dw.closed {
+		return 0, fmt.Errorf("deflate writer is closed")
+	}
+	dw.buf = append(dw.buf, p...)
+	for len(dw.buf)-dw.start > deflateBlockSize { // hold the last block back for Close to mark final
+		if dw.err = dw.writeBlock(dw.buf[:dw.start+deflateBlockSize], false); dw.err != nil {
+			return 0, dw.err
+		}
+		dw.start += deflateBlockSize
+		if dw.start > lzhWindow { // drop the history matches can no longer reach
+			n := copy(dw.buf, dw.buf[dw.start-lzhWindow:])
+			dw.buf, dw.start = dw.buf[:n], lzhWindow
+		}
+	}
+	return len(p), nil
+}
+
+// Close codes the remaining input as the final block and flushes the stream,
+// it does not close the underlying writer.
+func (dw *DeflateWriter) Close() error {
+	if dw.err != nil || dw.closed {
+		return dw.err
+	}
+	dw.closed = true
+	if dw.err = dw.writeBlock(dw.buf, true); dw.err != nil {
+		return dw.err
+	}
+	if _, dw.err = dw.bw.Flush(); dw.err != nil {
+		dw.err = fmt.Errorf("error while flushing bitwriter during deflate encoding: %w", dw.err)
+	}
+	return dw.err
+}
+
+// writeBlock codes src[dw.start:] as a dynamic block, or as stored blocks when
+// those come out smaller.
+func (dw *DeflateWriter) writeBlock(src []byte, final bool) error {
+	var (
+		data         = src[dw.start:]
+		tokens       []lzhToken
+		codes        *lzhCodes
+		storedBlocks = len(data)/deflateMaxStored + 1
+		storedLen    = 8 * (len(data) + storedBlocks*(deflateStoredLen+1)) // bits of the stored blocks, a byte covers each header and its padding
+		dynamicLen   = storedLen                                           // bits of the dynamic block, only used when smaller
+		err          error
+	)
+	if len(data) > 0 {
+		tokens = lzhParse(src, dw.start, dw.params)
+		codes = newLZHCodes(tokens)
+		reverseCodes(codes.litLenCodes, codes.litLenLengths)
+		reverseCodes(codes.distCodes, codes.distLengths)
+		reverseCodes(codes.clCodes, codes.clLengths)
+		dynamicLen = deflateHeaderLen
+		codes.write(tokens, func(_ uint64, n int) { dynamicLen += n })
+	}
+	put := func(bits uint64, n int) {
+		if err == nil {
+			err = dw.bw.WriteBits(bits, n)
+		}
+	}
+	if dynamicLen < storedLen {
+		put(boolBit(final), 1)
+		put(deflateDynamic, 2)
+		codes.write(tokens, put)
+		if err != nil {
+			return fmt.Errorf("error while writing deflate encoded bits: %w", err)
+		}
+		return nil
+	}
+	for {
+		n := min(len(data), deflateMaxStored)
+		put(boolBit(final && n == len(data)), 1)
+		put(deflateStored, 2)
+		if err == nil {
+			_, err = dw.bw.Flush() // stored data starts on a byte boundary
+		}
+		if err == nil {
+			_, err = dw.w.Write(binary.LittleEndian.AppendUint16(binary.LittleEndian.AppendUint16(nil, uint16(n)), ^uint16(n)))
+		}
+		if err == nil {
+			_, err = dw.w.Write(data[:n])
+		}
+		if err != nil {
+			return fmt.Errorf("error while writing deflate stored block: %w", err)
+		}
+		data = data[n:]
+		if len(data) == 0 {
+			return nil
+		}
+	}
+}
+
+func boolBit(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// reverseCodes flips the canonical codes so that writing them lsb first puts
+// their first bit out first.
+func reverseCodes(codes []uint64, lengths []uint8) {
+	for i, l := range lengths {
+		if l > 0 {
+			codes[i] = bits.Reverse64(codes[i]) >> (64 - l)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"math/rand"
+	"squish/internal/bitio"
+	"testing"
+)
+
+func deflateTestMessages() map[string][]byte {
+	var text bytes.Buffer
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"squish", "block", "codec", "huffman", "match", "window", "literal", "length", "distance"}
+	for text.Len() < 300000 { // spans several deflate blocks
+		fmt.Fprintf(&text, "%s %s %d, ", words[rng.Intn(len(words))], words[rng.Intn(len(words))], rng.Intn(1000))
+	}
+	random := make([]byte, 150000) // incompressible, so stored blocks
+	rng.Read(random)
+	return map[string][]byte{
+		"empty":  {},
+		"byte":   {'a'},
+		"hello":  []byte("The mellow yellow fellow says hello world!"),
+		"runs":   bytes.Repeat([]byte{0}, 100000),
+		"text":   text.Bytes(),
+		"random": random,
+	}
+}
+
+func TestDeflateStdlibInflates(t *testing.T) {
+	for name, message := range deflateTestMessages() {
+		for _, level := range []int{MinLevel, DefaultLevel, MaxLevel} {
+			var coded bytes.Buffer
+			dw := NewDeflateWriter(&coded, level)
+			if _, err := dw.Write(message); err != nil {
+				t.Fatalf("Deflate encoding of %s failed: %v", name, err)
+			}
+			if err := dw.Close(); err != nil {
+				t.Fatalf("Deflate close of %s failed: %v", name, err)
+			}
+			decoded, err := io.ReadAll(flate.NewReader(&coded))
+			if err != nil {
+				t.Fatalf("compress/flate failed to read %s at level %d: %v", name, level, err)
+			}
+			if !bytes.Equal(message, decoded) {
+				t.Fatalf("compress/flate decoded %s at level %d differently", name, level)
+			}
+		}
+	}
+}
+
+func TestDeflateInflatesStdlib(t *testing.T) {
+	for name, message := range deflateTestMessages() {
+		for _, level := range []int{flate.HuffmanOnly, flate.NoCompression, flate.BestSpeed, flate.BestCompression} {
+			var coded bytes.Buffer
+			fw, err := flate.NewWriter(&coded, level)
+			if err != nil {
+				t.Fatalf("compress/flate writer failed: %v", err)
+			}
+			fw.Write(message)
+			fw.Close()
+			decoded, err := io.ReadAll(NewDeflateReader(&coded))
+			if err != nil {
+				t.Fatalf("Deflate decoding of %s from compress/flate level %d failed: %v", name, level, err)
+			}
+			if !bytes.Equal(message, decoded) {
+				t.Fatalf("Deflate decoded %s from compress/flate level %d differently", name, level)
+			}
+		}
+	}
+}
+
+func TestDeflateFixedBlock(t *testing.T) {
+	var coded bytes.Buffer
+	fw, _ := flate.NewWriter(&coded, flate.BestCompression)
+	fw.Write([]byte("hello hello hello"))
+	fw.Close()
+	if coded.Bytes()[0]&0b110 != deflateFixed<<1 {
+		t.Fatalf("compress/flate did not write a fixed block")
+	}
+	decoded, err := io.ReadAll(NewDeflateReader(&coded))
+	if err != nil {
+		t.Fatalf("Deflate decoding of a fixed block failed: %v", err)
+	}
+	if string(decoded) != "hello hello hello" {
+		t.Fatalf("Deflate fixed block mismatch: got %s", decoded)
+	}
+}
+
+func TestDeflateReaderSharesBits(t *testing.T) {
+	var coded bytes.Buffer
+	dw := NewDeflateWriter(&coded, DefaultLevel)
+	dw.Write([]byte("The mellow yellow fellow says hello world!"))
+	dw.Close()
+	coded.WriteString("trailer")
+	br := bitio.NewLSBBitReader(&coded)
+	if _, err := io.ReadAll(NewDeflateReaderBits(br)); err != nil {
+		t.Fatalf("Deflate decoding failed: %v", err)
+	}
+	br.AlignToByte()
+	var trailer []byte
+	for range len("trailer") {
+		b, err := br.ReadBits(8)
+		if err != nil {
+			t.Fatalf("Failed to read the bytes after the stream: %v", err)
+		}
+		trailer = append(trailer, byte(b))
+	}
+	if string(trailer) != "trailer" {
+		t.Fatalf("Deflate reader left the bit reader at %q", trailer)
+	}
+}
+
+func TestDeflateCorrupt(t *testing.T) {
+	var coded bytes.Buffer
+	dw := NewDeflateWriter(&coded, DefaultLevel)
+	dw.Write(bytes.Repeat([]byte("hello "), 100))
+	dw.Close()
+	for i := range coded.Len() {
+		if _, err := io.ReadAll(NewDeflateReader(bytes.NewReader(coded.Bytes()[:i]))); err == nil {
+			t.Fatalf("Deflate decoded a truncated stream of %d bytes", i)
+		}
+	}
+}
@@ -2,47 +2,20 @@ package codec
 
 import (
 	"bytes"
-	"container/heap"
-	"errors"
 	"fmt"
 	"io"
-	"math/big"
+	"slices"
 	"squish/internal/bitio"
+	"squish/internal/sqerr"
 )
 
 const (
-	leaf   = 0
-	branch = 1
+	maxHuffmanCodeLen = 15 // longest code the encoder emits, so every code fits the decode tables
+	huffmanTableBits  = 10 // code bits resolved by the primary decode table
 )
 
 type HUFFMANCodec struct{}
 
-type node struct {
-	nodeType  int      // 0 is leaf, 1 is a node
-	value     byte     // value held by a leaf
-	frequency int      // frequency of value, or sum of frequencies of children
-	children  [2]*node // children if not a leaf
-}
-
-type hCode struct {
-	bits   *big.Int
-	length int
-}
-
-type huffmanHeap []*node
-
-// define function required to inherit the heap interface
-func (h huffmanHeap) Len() int           { return len(h) }
-func (h huffmanHeap) Less(i, j int) bool { return h[i].frequency < h[j].frequency }
-func (h huffmanHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
-func (h *huffmanHeap) Push(n any)        { *h = append(*h, n.(*node)) }
-func (h *huffmanHeap) Pop() any {
-	n := len(*h)
-	x := (*h)[n-1]
-	*h = (*h)[0 : n-1]
-	return x
-}
-
 func getFrequencyMap(src []byte) *[256]int {
 	freqMap := [256]int{}
 	for i := range len(src) {
@@ -51,101 +24,24 @@ func getFrequencyMap(src []byte) *[256]int {
 	return &freqMap
 }
 
-func getHuffmanTreeFromFreqMap(freqMap *[256]int) *node {
-	var (
-		leaves = &huffmanHeap{} // instantiate a heap
-		left   *node            // smallest left child node
-		right  *node            // second smallest right child node
-	)
-	//leaves := &huffmanHeap{}      // instantiate a heap
-	heap.Init(leaves)             // initialize it
-	for i := range len(freqMap) { // add nodes to the heap based on the freq map
-		if freqMap[i] > 0 {
-			heap.Push(leaves, &node{nodeType: leaf, value: byte(i), frequency: freqMap[i]})
-		}
-	}
-	for leaves.Len() > 1 {
-		left = heap.Pop(leaves).(*node)  // get the smallest left child node
-		right = heap.Pop(leaves).(*node) // get the second smalleset right child node
-		newNode := node{                 // create a new parent node for those children
-			nodeType:  branch,
-			frequency: left.frequency + right.frequency,
-			children:  [2]*node{left, right},
-		}
-		heap.Push(leaves, &newNode) // push that new parent back on to the heap
-	}
-	return heap.Pop(leaves).(*node)
-}
-
-func getHuffmanLengthsFromTree(tree *node) *[256]uint8 {
-	var (
-		lengths = [256]uint8{}         // store the bit lengths for each symbol at the index of that symbol
-		getCode func(n *node, l uint8) // define a func for recursive depth first search
-	)
-	getCode = func(n *node, l uint8) {
-		if n.nodeType == leaf {
-			if l == 0 {
-				l = 1 // protection from single symbol tree
-			}
-			lengths[n.value] = l // update the list of lengths when you arrive at a leaf
-		} else {
-			getCode(n.children[0], l+1) // recurse for children
-			getCode(n.children[1], l+1)
-		}
-	}
-	getCode(tree, 0)
-	return &lengths
-}
-
-func getHuffmanTreeFromDict(d *[256]hCode) *node {
-	var (
-		root      = node{nodeType: branch}                           // make an empty root node
-		buildTree func(n *node, val byte, bits *big.Int, bitPos int) // define recursive elements
-		bit       uint
-	)
-	buildTree = func(n *node, val byte, bits *big.Int, bitPos int) {
-		if bitPos >= 0 {
-			bit = bits.Bit(bitPos)
-			if n.children[bit] == nil {
-				n.children[bit] = &node{nodeType: branch} // create the child node if it doesn't exist
-			}
-			buildTree(n.children[bit], val, bits, bitPos-1) // recurse into the child node
-		} else {
-			n.nodeType = leaf // if you are at the end of your bit stream, you are at a leaf
-			n.value = val
-		}
-	}
-	for i := range len(d) {
-		if d[i].length > 0 {
-			buildTree(&root, byte(i), d[i].bits, d[i].length-1)
-		}
-	}
-	return &root
-}
-
-func getHuffmanDictFromLengths(l *[256]uint8) *[256]hCode {
-	// this functional builds the cononical huffman codes from the code lengths
+func getHuffmanCodesFromLengths(l []uint8) []uint64 {
+	// this function builds the canonical huffman codes from the code lengths,
+	// the codes of each length follow on from the shorter ones in symbol order,
+	// lengths past 64 bits don't fit a uint64 and are left without a code
 	var (
-		d           = [256]hCode{}  // the dictionary to store the data in
-		codeLengths = [256]int{}    // a code length counter for skipping unnecessary loops
-		curBits     = big.NewInt(0) // new big int to store bit streams
-		one         = big.NewInt(1) // big.Int value of one for big.Int incrementing
+		codes   = make([]uint64, len(l)) // the code for each symbol
+		curBits uint64                   // next code to hand out
 	)
-	for i := range len(l) {
-		codeLengths[l[i]]++ // count the lengths
-	}
-	for bitLen := 1; bitLen < 256; bitLen++ { // loop through all possible lengths
-		if codeLengths[bitLen] > 0 {
-			for i := range len(l) { // loop through the symbol - length pairs
-				if l[i] == uint8(bitLen) { // we only care about matching length symbols
-					d[i] = hCode{bits: big.NewInt(0).Set(curBits), length: bitLen}
-					curBits.Add(curBits, one)
-				}
+	for bitLen := 1; bitLen <= 64; bitLen++ {
+		for i := range len(l) {
+			if l[i] == uint8(bitLen) {
+				codes[i] = curBits
+				curBits++
 			}
 		}
-		curBits.Lsh(curBits, 1)
+		curBits <<= 1
 	}
-	return &d
+	return codes
 }
 
 func serializeHuffmanLengths(l *[256]uint8) []byte {
@@ -184,32 +80,215 @@ func deserializeHuffmanLengths(br io.Reader) (*[256]uint8, error) {
 	return &lengths, nil
 }
 
+// huffmanDecoder resolves canonical codes through lookup tables. The primary
+// table is indexed by the next huffmanTableBits bits of the stream; each entry
+// holds a symbol and its code length, or for longer codes a link to a second
+// level table indexed by the bits after the first huffmanTableBits.
+//
+// entry layout: symbol (bits 0-8), length (bits 9-12), link flag (bit 15) and
+// second level table offset (bits 16-31). Links keep the second level table's
+// index width in the length field. A zero entry is not a valid code.
+type huffmanDecoder struct {
+	table []uint32
+}
+
+const (
+	huffmanMaxSymbols = 1 << 9  // largest alphabet the tables hold
+	huffmanLink       = 1 << 15 // entry flag for second level tables
+)
+
+func huffmanEntry(symbol int, length int) uint32 {
+	return uint32(length)<<9 | uint32(symbol)
+}
+
+// newHuffmanDecoder builds the decode tables for an alphabet of up to
+// huffmanMaxSymbols symbols with codes no longer than maxHuffmanCodeLen bits.
+func newHuffmanDecoder(l []uint8) (*huffmanDecoder, error) {
+	var (
+		codes   = getHuffmanCodesFromLengths(l)
+		table   = make([]uint32, 1<<huffmanTableBits)
+		subBits = [1 << huffmanTableBits]int{} // second level index width per prefix
+	)
+	if len(l) > huffmanMaxSymbols || slices.Max(l) > maxHuffmanCodeLen || !huffmanLengthsValid(l) {
+		return nil, sqerr.New(sqerr.Corrupt, "invalid huffman code lengths")
+	}
+	for i := range len(l) { // size the second level tables
+		if n := int(l[i]); n > huffmanTableBits {
+			prefix := codes[i] >> (n - huffmanTableBits)
+			subBits[prefix] = max(subBits[prefix], n-huffmanTableBits)
+		}
+	}
+	for prefix, bits := range subBits { // lay them out after the primary table
+		if bits > 0 {
+			table[prefix] = uint32(len(table))<<16 | huffmanLink | huffmanEntry(0, bits)
+			table = append(table, make([]uint32, 1<<bits)...)
+		}
+	}
+	for i := range len(l) {
+		n := int(l[i])
+		if n == 0 {
+			continue
+		}
+		entry := huffmanEntry(i, n)
+		if n <= huffmanTableBits { // every index starting with the code decodes to it
+			start := int(codes[i]) << (huffmanTableBits - n)
+			for j := range 1 << (huffmanTableBits - n) {
+				table[start+j] = entry
+			}
+			continue
+		}
+		link := table[codes[i]>>(n-huffmanTableBits)]
+		bits := int(link>>9) & 0x0F
+		start := int(link>>16) + int(codes[i]&(1<<(n-huffmanTableBits)-1))<<(bits-(n-huffmanTableBits))
+		for j := range 1 << (bits - (n - huffmanTableBits)) {
+			table[start+j] = entry
+		}
+	}
+	return &huffmanDecoder{table: table}, nil
+}
+
+// huffmanLengthsValid reports whether the lengths describe a prefix code,
+// leaving codes unused is allowed (a single symbol still gets a 1 bit code).
+func huffmanLengthsValid(l []uint8) bool {
+	var count [256]int
+	for i := range len(l) {
+		count[l[i]]++
+	}
+	left := 1 // codes available at the current length
+	for bitLen := 1; bitLen < 256; bitLen++ {
+		left = min(left<<1, 2*len(l)) - count[bitLen] // more spare codes than symbols can never run out
+		if left < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// msbReader reads bits msb first from a byte slice. Reading past the end
+// yields zero bits, callers check consumed against the bits they expect.
+type msbReader struct {
+	src    []byte
+	bitBuf uint64 // upcoming bits, msb first
+	bitCnt int    // number of bits in bitBuf
+	srcIdx int    // next byte to load
+}
+
+// peek returns the upcoming bits aligned to the msb, at least 57 are valid.
+func (r *msbReader) peek() uint64 {
+	for r.bitCnt <= 56 { // top up the buffer
+		if r.srcIdx < len(r.src) {
+			r.bitBuf |= uint64(r.src[r.srcIdx]) << (56 - r.bitCnt)
+		}
+		r.srcIdx++
+		r.bitCnt += 8
+	}
+	return r.bitBuf
+}
+
+func (r *msbReader) skip(n int) {
+	r.bitBuf <<= n
+	r.bitCnt -= n
+}
+
+// read returns the next n bits, n at most 57.
+func (r *msbReader) read(n int) uint64 {
+	v := r.peek() >> (64 - n) // shifting by 64 leaves zero for n == 0
+	r.skip(n)
+	return v
+}
+
+func (r *msbReader) consumed() int {
+	return 8*r.srcIdx - r.bitCnt
+}
+
+// decodeSymbol decodes the code at the top of bits, a zero length means the
+// bits don't start with a valid code.
+func (hd *huffmanDecoder) decodeSymbol(bits uint64) (int, int) {
+	entry := hd.table[bits>>(64-huffmanTableBits)]
+	if entry&huffmanLink != 0 {
+		subBits := int(entry>>9) & 0x0F
+		entry = hd.table[int(entry>>16)+int(bits<<huffmanTableBits>>(64-subBits))]
+	}
+	return int(entry & (huffmanMaxSymbols - 1)), int(entry>>9) & 0x0F
+}
+
+// decode reads symbols until dataBits bits of src are used up.
+func (hd *huffmanDecoder) decode(src []byte, dataBits int, out []byte) ([]byte, error) {
+	r := msbReader{src: src}
+	for r.consumed() < dataBits {
+		symbol, n := hd.decodeSymbol(r.peek())
+		if n == 0 || r.consumed()+n > dataBits {
+			return out, sqerr.New(sqerr.Corrupt, "invalid huffman code")
+		}
+		out = append(out, byte(symbol))
+		r.skip(n)
+	}
+	return out, nil
+}
+
+// decodeHuffmanSlow decodes streams whose codes are longer than the tables
+// support, as older encoders could produce, one bit at a time by walking the
+// canonical code lengths.
+func decodeHuffmanSlow(l *[256]uint8, src []byte, dataBits int, out []byte) ([]byte, error) {
+	var (
+		count   [256]uint64 // number of codes of each length
+		symbols []byte      // symbols in canonical order
+	)
+	if !huffmanLengthsValid(l[:]) {
+		return out, sqerr.New(sqerr.Corrupt, "over-subscribed huffman code lengths")
+	}
+	for bitLen := 1; bitLen < 256; bitLen++ {
+		for i := range len(l) {
+			if l[i] == uint8(bitLen) {
+				count[bitLen]++
+				symbols = append(symbols, byte(i))
+			}
+		}
+	}
+	for bitIdx := 0; bitIdx < dataBits; {
+		var (
+			code  uint64 // bits read so far in this code
+			first uint64 // first code of the current length
+			index uint64 // symbols of the shorter lengths
+		)
+		for bitLen := 1; ; bitLen++ {
+			if bitLen > 255 || bitIdx >= dataBits {
+				return out, sqerr.New(sqerr.Corrupt, "invalid huffman code")
+			}
+			code |= uint64(src[bitIdx/8]>>(7-bitIdx%8)) & 1
+			bitIdx++
+			if code-first < count[bitLen] { // unsigned, so codes below first wrap around and fail too
+				out = append(out, symbols[index+code-first])
+				break
+			}
+			index += count[bitLen]
+			first = (first + count[bitLen]) << 1
+			code <<= 1
+		}
+	}
+	return out, nil
+}
+
 func (HUFFMANCodec) EncodeBlock(src []byte) ([]byte, error) {
 	if len(src) == 0 {
 		return src, nil
 	}
+	l := [256]uint8(buildCodeLengths(getFrequencyMap(src)[:], maxHuffmanCodeLen))
+	return encodeHuffman(src, &l)
+}
+
+func encodeHuffman(src []byte, l *[256]uint8) ([]byte, error) {
 	var (
-		outBuffer     = new(bytes.Buffer)             // create a new buffer to write to
-		bw            = bitio.NewBitWriter(outBuffer) // make a new bitwriter
-		tmpBig        = big.NewInt(0)                 // big.Int for nibble of bit.Int
-		remainingBits int                             // remaining bites to be written
-		bitsToWrite   int                             // number of bits to writer per pass per symbol
+		outBuffer = new(bytes.Buffer)                // create a new buffer to write to
+		bw        = bitio.NewBitWriter(outBuffer)    // make a new bitwriter
+		codes     = getHuffmanCodesFromLengths(l[:]) // canonical codes
 	)
-	f := getFrequencyMap(src)                             // get freq map
-	t := getHuffmanTreeFromFreqMap(f)                     // build the tree
-	l := getHuffmanLengthsFromTree(t)                     // get lengths of all of codes
-	d := getHuffmanDictFromLengths(l)                     // build the canonical dictionary from the lengths
+	outBuffer.Grow(len(src))
 	_, err := outBuffer.Write(serializeHuffmanLengths(l)) // write the lengths to it
 	for i := range len(src) {
-		remainingBits = d[src[i]].length // how many bits need written
-		for remainingBits > 0 {
-			bitsToWrite = min(remainingBits, 64)                        // determine how many bits (max 64 due to bitwriter)
-			tmpBig.Rsh(d[src[i]].bits, uint(remainingBits-bitsToWrite)) // shift it to get bits of interest in LSB
-			err = bw.WriteBits(tmpBig.Uint64(), bitsToWrite)            // write it
-			if err != nil {
-				return []byte{}, fmt.Errorf("error while writing huffman encoded bits: %w", err)
-			}
-			remainingBits -= bitsToWrite // count down the bits to be written
+		err = bw.WriteBits(codes[src[i]], int(l[src[i]]))
+		if err != nil {
+			return []byte{}, fmt.Errorf("error while writing huffman encoded bits: %w", err)
 		}
 	}
 	pad, err := bw.Flush() // flush it and report back the number of pad bits
@@ -233,43 +312,22 @@ func (HUFFMANCodec) DecodeBlock(src []byte) ([]byte, error) {
 	if err != nil {
 		return []byte{}, fmt.Errorf("error while deserializing huffman code dictionary: %w", err)
 	}
-	d := getHuffmanDictFromLengths(l)  // build the canonical huffman dictionary from the lengths
-	t := getHuffmanTreeFromDict(d)     // build the Huffman tree
-	inBuffer := bitio.NewBitReader(br) // create a bitreader and traverse the tree with bits
 	var (
-		outBuffer = make([]byte, 0, 4*len(src))
-		padBuffer uint64
-		newBit    uint64
+		stream   = br.Bytes()                   // the code bits, padded at the end
+		dataBits = 8*len(stream) - int(padBits) // the bits holding codes
+		out      = make([]byte, 0, 2*len(stream))
 	)
-	if padBits > 0 {
-		padBuffer, err = inBuffer.ReadBits(int(padBits)) // read in the padded bits if there are any
-		if err != nil {
-			return []byte{}, fmt.Errorf("error while reading first %d bits from source in huffman decoding: %w", padBits, err)
-		}
+	if padBits > 7 || dataBits < 0 {
+		return []byte{}, sqerr.New(sqerr.Corrupt, "invalid huffman padding")
 	}
-	node := t
-	for {
-		if node.nodeType == branch {
-			newBit, err = inBuffer.ReadBits(1) // read in a bit
-			if err != nil {
-				break
-			}
-			if padBits > 0 {
-				node = node.children[(padBuffer>>(padBits-1))&0x01] // use the msb of the padded buffer as the decision bit
-				padBuffer = (padBuffer << 1) | newBit               // shift the padded buffer left 1 and add the new bit
-			} else {
-				node = node.children[newBit] // use the new bit as the decision bit if there is no padding.
-			}
-		} else {
-			outBuffer = append(outBuffer, node.value) // if you are at a leaf, you have your value
-			node = t                                  // reset to the root tree node
-		}
+	if slices.Max(l[:]) > maxHuffmanCodeLen {
+		return decodeHuffmanSlow(l, stream, dataBits, out)
 	}
-	if errors.Is(err, io.EOF) {
-		return outBuffer, nil
-	} else {
-		return outBuffer, fmt.Errorf("error while reading bit from source in huffman decoding: %w", err)
+	hd, err := newHuffmanDecoder(l[:])
+	if err != nil {
+		return []byte{}, err
 	}
+	return hd.decode(stream, dataBits, out)
 }
 
 func (HUFFMANCodec) IsLossless() bool {
@@ -2,6 +2,9 @@ package codec
 
 import (
 	"bytes"
+	"math/rand"
+	"squish/internal/sqerr"
+	"strings"
 	"testing"
 )
 
@@ -46,3 +49,102 @@ func TestHuffLossless(t *testing.T) {
 		t.Fatalf("HUFFMAN is lossless, but returned lossy")
 	}
 }
+
+func TestHuffmanLegacyStream(t *testing.T) {
+	// written by the original big.Int based encoder
+	coded := []byte{0x5, 0x2, 0x6c, 0x3, 0x20, 0x3, 0x65, 0x3, 0x6f, 0x4, 0x68, 0x4, 0x77, 0x4, 0x79, 0x5, 0x64, 0x5, 0x66, 0x5, 0x6d, 0x5, 0x73, 0x6, 0x21, 0x6, 0x54, 0x6, 0x61, 0x6, 0x72, 0x0, 0x0, 0xf6, 0x9a, 0xe3, 0x9, 0x6b, 0x18, 0x4b, 0x5b, 0x61, 0x2d, 0x77, 0xec, 0xea, 0xa6, 0x11, 0x5c, 0xfc, 0xd7, 0x80}
+	decoded, err := HUFFMANCodec{}.DecodeBlock(coded)
+	if err != nil {
+		t.Fatalf("Huffman decoding failed: %v", err)
+	}
+	if string(decoded) != "The mellow yellow fellow says hello world!" {
+		t.Fatalf("Huffman legacy stream mismatch: got %s", string(decoded))
+	}
+}
+
+func fibonacciMessage() []byte {
+	message := []byte{0, 1}
+	a, b := 1, 1
+	for i := range 30 {
+		a, b = b, a+b
+		message = append(message, bytes.Repeat([]byte{byte(i)}, b)...)
+	}
+	return message
+}
+
+func TestHuffmanLongCodes(t *testing.T) {
+	// older encoders didn't limit code lengths, those streams take the slow path
+	message := fibonacciMessage()
+	l := [256]uint8(buildCodeLengths(getFrequencyMap(message)[:], 64))
+	coded, err := encodeHuffman(message, &l)
+	if err != nil {
+		t.Fatalf("Huffman encoding failed: %v", err)
+	}
+	decoded, err := HUFFMANCodec{}.DecodeBlock(coded)
+	if err != nil {
+		t.Fatalf("Huffman decoding failed: %v", err)
+	}
+	if !bytes.Equal(message, decoded) {
+		t.Fatalf("Huffman long code mismatch")
+	}
+}
+
+func TestHuffmanAllBytes(t *testing.T) {
+	message := make([]byte, 0, 1<<16)
+	for i := range 256 {
+		message = append(message, bytes.Repeat([]byte{byte(i)}, 1+i*i/64)...) // skewed enough to need second level tables
+	}
+	HuffmanEncodeDecode(string(message), t)
+}
+
+func TestHuffmanSingleSymbol(t *testing.T) {
+	HuffmanEncodeDecode(strings.Repeat("a", 1000), t)
+}
+
+func TestHuffmanCorrupt(t *testing.T) {
+	coded, err := HUFFMANCodec{}.EncodeBlock([]byte(strings.Repeat("a", 1000)))
+	if err != nil {
+		t.Fatalf("Huffman encoding failed: %v", err)
+	}
+	coded[len(coded)-1] = 0xFF // 'a' is the only code, so a 1 bit is invalid
+	if _, err := (HUFFMANCodec{}).DecodeBlock(coded); sqerr.ErrorCode(err) != sqerr.Corrupt {
+		t.Fatalf("Huffman decoded an invalid code: %v", err)
+	}
+}
+
+func huffmanBenchmarkData() []byte {
+	var (
+		rnd   = rand.New(rand.NewSource(1))
+		words = strings.Fields("the of and to in is was that for it with as on be at by this had not are but from or have an they which one you were all we")
+		data  = make([]byte, 0, 1<<20)
+	)
+	for len(data) < 1<<20 {
+		data = append(data, words[int(rnd.ExpFloat64()*6)%len(words)]...)
+		data = append(data, ' ')
+	}
+	return data
+}
+
+func BenchmarkHuffmanEncode(b *testing.B) {
+	data := huffmanBenchmarkData()
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		if _, err := (HUFFMANCodec{}).EncodeBlock(data); err != nil {
+			b.Fatalf("Huffman encoding failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkHuffmanDecode(b *testing.B) {
+	data := huffmanBenchmarkData()
+	coded, err := HUFFMANCodec{}.EncodeBlock(data)
+	if err != nil {
+		b.Fatalf("Huffman encoding failed: %v", err)
+	}
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		if _, err := (HUFFMANCodec{}).DecodeBlock(coded); err != nil {
+			b.Fatalf("Huffman decoding failed: %v", err)
+		}
+	}
+}
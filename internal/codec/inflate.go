@@ -0,0 +1,258 @@
+package codec
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+	"squish/internal/bitio"
+	"squish/internal/sqerr"
+)
+
+const (
+	deflateFixedLitLen = 288 // literal/length codes of fixed blocks, including two that are never used
+	deflateFixedDist   = 32  // distance codes of fixed blocks, including two that are never used
+)
+
+// DeflateReader decompresses a raw deflate (RFC 1951) stream, with stored,
+// fixed and dynamic blocks, as written by DeflateWriter, compress/flate or
+// zlib. Codes are resolved through the same lookup tables as HUFFMAN's, fed
+// with peeked bits turned msb first. Peeking may load a few bytes past the end
+// of the stream, so formats with data after it (a gzip trailer) share an
+// LSBBitReader through NewDeflateReaderBits and carry on reading from that.
+type DeflateReader struct {
+	br      *bitio.LSBBitReader
+	window  []byte // output history followed by output not yet read
+	readIdx int    // first byte of window not yet read
+	final   bool   // whether the last block has been decoded
+	err     error
+}
+
+func NewDeflateReader(r io.Reader) *DeflateReader {
+	return NewDeflateReaderBits(bitio.NewLSBBitReader(r))
+}
+
+// NewDeflateReaderBits decodes the stream starting at br's next bit. Once Read
+// returns io.EOF, br is positioned just after the last block.
+func NewDeflateReaderBits(br *bitio.LSBBitReader) *DeflateReader {
+	return &DeflateReader{br: br}
+}
+
+func (dr *DeflateReader) Read(p []byte) (int, error) {
+	for dr.readIdx == len(dr.window) {
+		if dr.err != nil {
+			return 0, dr.err
+		}
+		if dr.final {
+			return 0, io.EOF
+		}
+		if len(dr.window) > lzhWindow { // keep only the history matches can reach
+			n := copy(dr.window, dr.window[len(dr.window)-lzhWindow:])
+			dr.window, dr.readIdx = dr.window[:n], n
+		}
+		dr.err = dr.decodeBlock()
+	}
+	n := copy(p, dr.window[dr.readIdx:])
+	dr.readIdx += n
+	return n, nil
+}
+
+func (dr *DeflateReader) bits(n int) (int, error) {
+	v, err := dr.br.ReadBits(n)
+	if err != nil {
+		return 0, sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read deflate stream")
+	}
+	return int(v), nil
+}
+
+func (dr *DeflateReader) decodeSymbol(hd *huffmanDecoder) (int, error) {
+	v, err := dr.br.PeekBits(maxHuffmanCodeLen) // may run short at the end, skipping catches codes that do
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read deflate stream")
+	}
+	symbol, n := hd.decodeSymbol(bits.Reverse64(v)) // first bit to the top, as the tables expect
+	if n == 0 {
+		return 0, sqerr.New(sqerr.Corrupt, "invalid deflate code")
+	}
+	if err = dr.br.SkipBits(n); err != nil {
+		return 0, sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read deflate stream")
+	}
+	return symbol, nil
+}
+
+// decodeBlock decodes the next block onto the end of the window.
+func (dr *DeflateReader) decodeBlock() error {
+	header, err := dr.bits(deflateHeaderLen)
+	if err != nil {
+		return err
+	}
+	dr.final = header&1 == 1
+	switch header >> 1 {
+	case deflateStored:
+		return dr.decodeStored()
+	case deflateFixed:
+		lengths := make([]uint8, deflateFixedLitLen+deflateFixedDist)
+		for i := range lengths {
+			switch {
+			case i < 144:
+				lengths[i] = 8
+			case i < 256:
+				lengths[i] = 9
+			case i < 280:
+				lengths[i] = 7
+			case i < deflateFixedLitLen:
+				lengths[i] = 8
+			default:
+				lengths[i] = 5
+			}
+		}
+		return dr.decodeCodes(lengths[:deflateFixedLitLen], lengths[deflateFixedLitLen:])
+	case deflateDynamic:
+		return dr.decodeDynamic()
+	}
+	return sqerr.New(sqerr.Corrupt, "invalid deflate block type")
+}
+
+func (dr *DeflateReader) decodeStored() error {
+	dr.br.AlignToByte()
+	n, err := dr.bits(16)
+	if err != nil {
+		return err
+	}
+	complement, err := dr.bits(16)
+	if err != nil {
+		return err
+	}
+	if n != ^complement&0xFFFF {
+		return sqerr.New(sqerr.Corrupt, "invalid deflate stored block length")
+	}
+	for range n {
+		b, err := dr.bits(8)
+		if err != nil {
+			return err
+		}
+		dr.window = append(dr.window, byte(b))
+	}
+	return nil
+}
+
+// decodeDynamic reads the block's code lengths, stored as in LZH, then its tokens.
+func (dr *DeflateReader) decodeDynamic() error {
+	var counts [3]int
+	for i, n := range []int{5, 5, 4} {
+		v, err := dr.bits(n)
+		if err != nil {
+			return err
+		}
+		counts[i] = v
+	}
+	var (
+		nLitLen   = counts[0] + 257
+		nDist     = counts[1] + 1
+		nCL       = counts[2] + 4
+		clLengths = make([]uint8, 19)
+		lengths   = make([]uint8, 0, nLitLen+nDist) // both alphabets' code lengths
+	)
+	if nLitLen > lzhLitLenCodes || nDist > lzhDistCodes {
+		return sqerr.New(sqerr.Corrupt, "invalid deflate code counts")
+	}
+	for i := range nCL {
+		l, err := dr.bits(3)
+		if err != nil {
+			return err
+		}
+		clLengths[lzhCLOrder[i]] = uint8(l)
+	}
+	clHuffman, err := newHuffmanDecoder(clLengths)
+	if err != nil {
+		return err
+	}
+	for len(lengths) < nLitLen+nDist {
+		symbol, err := dr.decodeSymbol(clHuffman)
+		if err != nil {
+			return err
+		}
+		var length uint8
+		repeat := 1
+		switch symbol {
+		case 16:
+			if len(lengths) == 0 {
+				return sqerr.New(sqerr.Corrupt, "deflate code length repeat with nothing to repeat")
+			}
+			length = lengths[len(lengths)-1]
+			repeat, err = dr.bits(2)
+			repeat += 3
+		case 17:
+			repeat, err = dr.bits(3)
+			repeat += 3
+		case 18:
+			repeat, err = dr.bits(7)
+			repeat += 11
+		default:
+			length = uint8(symbol)
+		}
+		if err != nil {
+			return err
+		}
+		if len(lengths)+repeat > nLitLen+nDist {
+			return sqerr.New(sqerr.Corrupt, "deflate code lengths overrun the alphabets")
+		}
+		for range repeat {
+			lengths = append(lengths, length)
+		}
+	}
+	if lengths[lzhEndOfBlock] == 0 {
+		return sqerr.New(sqerr.Corrupt, "deflate block has no end of block code")
+	}
+	return dr.decodeCodes(lengths[:nLitLen], lengths[nLitLen:])
+}
+
+// decodeCodes decodes tokens with the given code lengths up to the end of block.
+func (dr *DeflateReader) decodeCodes(litLenLengths []uint8, distLengths []uint8) error {
+	litLen, err := newHuffmanDecoder(litLenLengths)
+	if err != nil {
+		return err
+	}
+	dist, err := newHuffmanDecoder(distLengths)
+	if err != nil {
+		return err
+	}
+	for {
+		symbol, err := dr.decodeSymbol(litLen)
+		if err != nil {
+			return err
+		}
+		if symbol < lzhEndOfBlock {
+			dr.window = append(dr.window, byte(symbol))
+			continue
+		}
+		if symbol == lzhEndOfBlock {
+			return nil
+		}
+		l := symbol - 257
+		if l >= len(lzhLengthBase) {
+			return sqerr.New(sqerr.Corrupt, "invalid deflate length symbol")
+		}
+		extra, err := dr.bits(lzhLengthExtra[l])
+		if err != nil {
+			return err
+		}
+		length := lzhLengthBase[l] + extra
+		d, err := dr.decodeSymbol(dist)
+		if err != nil {
+			return err
+		}
+		if d >= len(lzhDistBase) {
+			return sqerr.New(sqerr.Corrupt, "invalid deflate distance symbol")
+		}
+		if extra, err = dr.bits(lzhDistExtra[d]); err != nil {
+			return err
+		}
+		distance := lzhDistBase[d] + extra
+		if distance > len(dr.window) {
+			return sqerr.New(sqerr.Corrupt, "deflate match reaches before the stream")
+		}
+		for range length { // copy byte by byte, matches may overlap themselves
+			dr.window = append(dr.window, dr.window[len(dr.window)-distance])
+		}
+	}
+}
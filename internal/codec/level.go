@@ -0,0 +1,66 @@
+package codec
+
+import "squish/internal/sqerr"
+
+// compression levels
+const (
+	MinLevel     = 1
+	MaxLevel     = 9
+	DefaultLevel = 6
+)
+
+type levelParams struct {
+	matchIter   int  // number of hash matches LZSS looks back through before halting
+	lazy        bool // whether LZSS defers a match when the next position holds a longer one
+	optimal     bool // whether LZSS picks matches and literals by their total token cost across the block
+	binaryTree  bool // whether LZ codecs find matches with a binary tree instead of a hash chain
+	autoDepth   int  // how many iterations of encodings AUTO tests
+	keepAlong   int  // how many "best" results AUTO carries into the next iteration
+	minProbeLen int  // minimum size of the payload chunk AUTO tests compression on
+	maxProbeLen int  // maximum size of the payload chunk AUTO tests compression on
+}
+
+// parameter sets per level, the default level matches the original tuning
+var levelTable = [MaxLevel + 1]levelParams{
+	1: {matchIter: 4, lazy: false, autoDepth: 1, keepAlong: 2, minProbeLen: 1 << 12, maxProbeLen: 1 << 14},
+	2: {matchIter: 8, lazy: false, autoDepth: 2, keepAlong: 2, minProbeLen: 1 << 13, maxProbeLen: 1 << 15},
+	3: {matchIter: 16, lazy: false, autoDepth: 2, keepAlong: 3, minProbeLen: 1 << 14, maxProbeLen: 1 << 16},
+	4: {matchIter: 16, lazy: false, autoDepth: 3, keepAlong: 3, minProbeLen: 1 << 14, maxProbeLen: 1 << 16},
+	5: {matchIter: 24, lazy: false, autoDepth: 3, keepAlong: 3, minProbeLen: 1 << 14, maxProbeLen: 1 << 16},
+	6: {matchIter: 32, lazy: false, autoDepth: 3, keepAlong: 3, minProbeLen: 1 << 14, maxProbeLen: 1 << 16},
+	7: {matchIter: 64, lazy: true, autoDepth: 3, keepAlong: 4, minProbeLen: 1 << 15, maxProbeLen: 1 << 17},
+	8: {matchIter: 128, lazy: true, optimal: true, autoDepth: 4, keepAlong: 4, minProbeLen: 1 << 16, maxProbeLen: 1 << 18},
+	9: {matchIter: 256, lazy: true, optimal: true, binaryTree: true, autoDepth: 4, keepAlong: 5, minProbeLen: 1 << 16, maxProbeLen: 1 << 19},
+}
+
+func getLevelParams(level int) levelParams {
+	if level < MinLevel || level > MaxLevel {
+		level = DefaultLevel // zero value codecs use the default
+	}
+	return levelTable[level]
+}
+
+// Leveled is implemented by codecs whose speed/ratio trade-off can be tuned.
+// Levels only affect encoding, the output always decodes the same way.
+type Leveled interface {
+	WithLevel(level int) Codec
+}
+
+// NewEncoder returns a codec ready to encode a block with the given serialized
+// parameters at the given level. Codecs that keep state while encoding are
+// freshly allocated, so the result may be used concurrently with other
+// encoders.
+func NewEncoder(id uint8, params []byte, level int) (Codec, error) {
+	c, ok := New(id)
+	if !ok {
+		return nil, sqerr.New(sqerr.Unsupported, "unsupported codec ID")
+	}
+	c, err := Configure(c, params)
+	if err != nil {
+		return nil, err
+	}
+	if l, ok := c.(Leveled); ok {
+		c = l.WithLevel(level)
+	}
+	return c, nil
+}
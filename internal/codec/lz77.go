@@ -0,0 +1,189 @@
+package codec
+
+import (
+	"encoding/binary"
+	"squish/internal/sqerr"
+)
+
+const (
+	lz77MinWindowLog     = 10 // smallest window, 1KiB
+	lz77MaxWindowLog     = 24 // largest window, 16MiB (the largest block size)
+	lz77DefaultWindowLog = lz77MaxWindowLog
+	lz77MinMatch         = 4   // min match length
+	lz77HashLog          = 17  // bits of the 4-byte sequence hash
+	lz77NiceMatch        = 256 // matches this long end the search early
+)
+
+// LZ77Codec is an LZ77-family codec with a window of up to the whole block and
+// variable-length match/offset encoding. The payload starts with the decoded
+// length and the window parameters, followed by sequences of
+//
+//	uvarint literal count, literals, uvarint offset, uvarint match length - min match
+//
+// where the final sequence stops after its literals.
+type LZ77Codec struct {
+	windowLog int // log2 of the window size, zero uses the default
+	level     int // compression level, zero uses the default
+}
+
+func (LC LZ77Codec) WithLevel(level int) Codec {
+	LC.level = level
+	return LC
+}
+
+func (LC LZ77Codec) getWindowLog() int {
+	if LC.windowLog < lz77MinWindowLog || LC.windowLog > lz77MaxWindowLog {
+		return lz77DefaultWindowLog
+	}
+	return LC.windowLog
+}
+
+// Params returns windowlog, the log2 of how far back matches reach.
+func (LC LZ77Codec) Params() Params {
+	return Params{"windowlog": LC.getWindowLog()}
+}
+
+func (LC LZ77Codec) WithParams(p Params) (Codec, error) {
+	if err := checkParams("LZ77", p, map[string][2]int{"windowlog": {lz77MinWindowLog, lz77MaxWindowLog}}); err != nil {
+		return nil, err
+	}
+	if v, ok := p["windowlog"]; ok {
+		LC.windowLog = v
+	}
+	return LC, nil
+}
+
+func uvarintLen(v int) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+func (LC LZ77Codec) EncodeBlock(src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return src, nil
+	}
+	var (
+		params    = getLevelParams(LC.level)       // match finder effort
+		windowLog = LC.getWindowLog()              // log2 of the window size
+		out       = make([]byte, 0, len(src)/2+16) // output byte slice
+		srcIdx    = 0                              // where you are in the input
+		litStart  = 0                              // start of the pending literals
+		matchLen  int                              // best match at the current position
+		offset    int                              // offset of that match
+		nextLen   int                              // best match one byte further (lazy matching)
+		nextOff   int                              // offset of that match
+		haveNext  bool                             // whether the next position was already searched
+		mf        = newMatchFinder(src, matchFinderConfig{
+			window:     1 << windowLog,
+			minMatch:   lz77MinMatch,
+			niceMatch:  lz77NiceMatch,
+			depth:      params.matchIter,
+			hashLog:    lz77HashLog,
+			binaryTree: params.binaryTree,
+		})
+	)
+	worthy := func(length int, offset int) bool {
+		return length > uvarintLen(offset)+1 // a match must beat the literals it replaces
+	}
+	out = binary.AppendUvarint(out, uint64(len(src))) // decoded length
+	out = append(out, byte(windowLog), lz77MinMatch)  // window parameters
+	for srcIdx < len(src) {
+		searched := srcIdx + 1 // positions before this have been added to the match finder
+		if haveNext {
+			matchLen, offset = nextLen, nextOff // searched while deciding the last byte
+			haveNext = false
+		} else {
+			matchLen, offset = mf.FindMatch(srcIdx)
+		}
+		if matchLen == 0 || !worthy(matchLen, offset) {
+			srcIdx++
+			continue
+		}
+		if params.lazy && srcIdx+1 < len(src) {
+			nextLen, nextOff = mf.FindMatch(srcIdx + 1)
+			searched++
+			if nextLen > matchLen && worthy(nextLen, nextOff) {
+				haveNext = true
+				srcIdx++ // take the longer match at the next byte instead
+				continue
+			}
+		}
+		out = binary.AppendUvarint(out, uint64(srcIdx-litStart)) // flush the sequence
+		out = append(out, src[litStart:srcIdx]...)
+		out = binary.AppendUvarint(out, uint64(offset))
+		out = binary.AppendUvarint(out, uint64(matchLen-lz77MinMatch))
+		srcIdx += matchLen
+		for k := searched; k < srcIdx; k++ {
+			mf.Skip(k) // keep the positions inside the match searchable
+		}
+		litStart = srcIdx
+	}
+	out = binary.AppendUvarint(out, uint64(len(src)-litStart)) // trailing literals
+	out = append(out, src[litStart:]...)
+	return out, nil
+}
+
+func (LZ77Codec) DecodeBlock(src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return src, nil
+	}
+	outLen, n := binary.Uvarint(src) // read the decoded length
+	if n <= 0 || n+2 > len(src) || outLen > maxBlockSize {
+		return []byte{}, sqerr.New(sqerr.Corrupt, "invalid LZ77 header")
+	}
+	windowLog, minMatch := int(src[n]), int(src[n+1])
+	if windowLog > lz77MaxWindowLog || minMatch == 0 {
+		return []byte{}, sqerr.New(sqerr.Corrupt, "invalid LZ77 window parameters")
+	}
+	var (
+		window = 1 << windowLog
+		srcIdx = n + 2
+		out    = make([]byte, 0, min(outLen, 8*uint64(len(src)))) // grown as needed past that
+	)
+	readUvarint := func() (int, error) {
+		v, n := binary.Uvarint(src[srcIdx:])
+		if n <= 0 || v > outLen {
+			return 0, sqerr.New(sqerr.Corrupt, "invalid LZ77 sequence")
+		}
+		srcIdx += n
+		return int(v), nil
+	}
+	for {
+		litLen, err := readUvarint()
+		if err != nil {
+			return []byte{}, err
+		}
+		if srcIdx+litLen > len(src) || len(out)+litLen > int(outLen) {
+			return []byte{}, sqerr.New(sqerr.Corrupt, "LZ77 literals overrun the block")
+		}
+		out = append(out, src[srcIdx:srcIdx+litLen]...)
+		srcIdx += litLen
+		if len(out) == int(outLen) {
+			break
+		}
+		offset, err := readUvarint()
+		if err != nil {
+			return []byte{}, err
+		}
+		matchLen, err := readUvarint()
+		if err != nil {
+			return []byte{}, err
+		}
+		matchLen += minMatch
+		if offset == 0 || offset > len(out) || offset > window || len(out)+matchLen > int(outLen) {
+			return []byte{}, sqerr.New(sqerr.Corrupt, "invalid LZ77 match")
+		}
+		for range matchLen { // copy byte by byte, matches may overlap themselves
+			out = append(out, out[len(out)-offset])
+		}
+	}
+	return out, nil
+}
+
+func (LZ77Codec) IsLossless() bool {
+	return true
+}
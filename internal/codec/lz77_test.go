@@ -0,0 +1,106 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"squish/internal/sqerr"
+	"testing"
+)
+
+func LZ77EncodeDecode(message string, t *testing.T) {
+	lc := LZ77Codec{}
+	coded, err := lc.EncodeBlock([]byte(message))
+	if err != nil {
+		t.Fatalf("LZ77 encoding failed: %v", err)
+	}
+	decoded, err := lc.DecodeBlock(coded)
+	if err != nil {
+		t.Fatalf("LZ77 decoding failed: %v", err)
+	}
+	if message != string(decoded) {
+		t.Fatalf("LZ77 encoding mismatch: got %s - expected %s", string(decoded), message)
+	}
+}
+
+func TestLZ77EncodeDecode(t *testing.T) {
+	message := "The mellow yellow fellow says hello world!"
+	LZ77EncodeDecode(message, t)
+}
+
+func TestLZ77RunLength(t *testing.T) {
+	message := []byte{0, 1}
+	a, b := 1, 1
+	for i := range 30 {
+		a, b = b, a+b
+		message = append(message, bytes.Repeat([]byte{byte(i)}, b)...)
+	}
+	LZ77EncodeDecode(string(message), t)
+}
+
+func TestLZ77EmptyMessage(t *testing.T) {
+	message := ""
+	LZ77EncodeDecode(message, t)
+}
+
+func TestLZ77Lossless(t *testing.T) {
+	lc := LZ77Codec{}
+	if !lc.IsLossless() {
+		t.Fatalf("LZ77 is lossless, but returned lossy")
+	}
+}
+
+func TestLZ77LongDistance(t *testing.T) {
+	chunk := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(chunk)
+	message := append(append([]byte{}, chunk...), chunk...) // repeat lies 1MiB back, far outside LZSS's window
+	lc := LZ77Codec{}
+	coded, err := lc.EncodeBlock(message)
+	if err != nil {
+		t.Fatalf("LZ77 encoding failed: %v", err)
+	}
+	if len(coded) > len(chunk)+len(chunk)/100 {
+		t.Fatalf("LZ77 failed to match across the window: %d bytes", len(coded))
+	}
+	LZ77EncodeDecode(string(message), t)
+}
+
+func TestLZ77Window(t *testing.T) {
+	chunk := make([]byte, 1<<12)
+	rand.New(rand.NewSource(1)).Read(chunk)
+	message := append(append([]byte{}, chunk...), chunk...)
+	small := LZ77Codec{windowLog: lz77MinWindowLog}
+	coded, err := small.EncodeBlock(message)
+	if err != nil {
+		t.Fatalf("LZ77 encoding failed: %v", err)
+	}
+	if coded[uvarintLen(len(message))] != lz77MinWindowLog {
+		t.Fatalf("LZ77 did not record its window size")
+	}
+	decoded, err := LZ77Codec{}.DecodeBlock(coded)
+	if err != nil {
+		t.Fatalf("LZ77 decoding failed: %v", err)
+	}
+	if !bytes.Equal(message, decoded) {
+		t.Fatalf("LZ77 encoding mismatch with a small window")
+	}
+}
+
+func TestLZ77Corrupt(t *testing.T) {
+	coded, err := LZ77Codec{}.EncodeBlock(bytes.Repeat([]byte("hello "), 100))
+	if err != nil {
+		t.Fatalf("LZ77 encoding failed: %v", err)
+	}
+	for i := 1; i < len(coded); i++ {
+		if _, err := (LZ77Codec{}).DecodeBlock(coded[:i]); err == nil {
+			t.Fatalf("LZ77 decoded a truncated payload of %d bytes", i)
+		}
+	}
+	// a 64 KiB payload claiming 64 GiB must fail instead of reserving it
+	huge := binary.AppendUvarint(nil, 64<<30)
+	huge = append(huge, coded[len(binary.AppendUvarint(nil, 600)):]...)
+	huge = append(huge, make([]byte, 64<<10)...)
+	if _, err := (LZ77Codec{}).DecodeBlock(huge); sqerr.ErrorCode(err) != sqerr.Corrupt {
+		t.Fatalf("LZ77 decoded a payload claiming 64 GiB: %v", err)
+	}
+}
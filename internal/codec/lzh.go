@@ -0,0 +1,377 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"squish/internal/bitio"
+	"squish/internal/sqerr"
+)
+
+const (
+	lzhWindow      = 1 << 15 // furthest distance a match may reach back
+	lzhMinMatch    = 3       // min match length
+	lzhMaxMatch    = 258     // max match length
+	lzhNiceMatch   = 128     // matches this long end the search early
+	lzhHashLog     = 15      // bits of the 3-byte sequence hash
+	lzhEndOfBlock  = 256     // literal/length symbol closing the token stream
+	lzhLitLenCodes = 286     // literal/length alphabet size
+	lzhDistCodes   = 30      // distance alphabet size
+	lzhMaxCLCode   = 7       // longest code in the code length alphabet
+)
+
+var (
+	// base match length and extra bits of length symbols 257 to 285
+	lzhLengthBase  = [29]int{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lzhLengthExtra = [29]int{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	// base distance and extra bits of distance symbols 0 to 29
+	lzhDistBase  = [30]int{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	lzhDistExtra = [30]int{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+	// order the code length code lengths are stored in, rarely used lengths last
+	lzhCLOrder = [19]int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+)
+
+// LZHCodec codes LZ77 tokens directly with Huffman codes, as DEFLATE (RFC 1951)
+// does: literals and match lengths share one alphabet, distances have their own,
+// and both carry extra bits for the offset within their symbol's range. The
+// payload is the uvarint decoded length followed by an msb-first bitstream of
+//
+//	5 bits literal/length code count - 257, 5 bits distance code count - 1,
+//	4 bits code length code count - 4, 3 bits per code length code length,
+//	the run-length coded code lengths of both alphabets, then the tokens
+//	closed by the end of block symbol.
+type LZHCodec struct {
+	level int // compression level, zero uses the default
+}
+
+func (LC LZHCodec) WithLevel(level int) Codec {
+	LC.level = level
+	return LC
+}
+
+// lzhToken is a literal (length 0) or a match.
+type lzhToken struct {
+	length   uint16 // match length, or zero for a literal
+	distance uint16 // match distance, or the literal byte
+}
+
+func lzhLengthSymbol(length int) int {
+	i, _ := slices.BinarySearch(lzhLengthBase[:], length+1)
+	return i - 1
+}
+
+func lzhDistSymbol(distance int) int {
+	i, _ := slices.BinarySearch(lzhDistBase[:], distance+1)
+	return i - 1
+}
+
+// lzhParse splits src[start:] into literals and matches, the bytes before
+// start only serve as history for the matches to reach back into.
+func lzhParse(src []byte, start int, params levelParams) []lzhToken {
+	var (
+		tokens   = make([]lzhToken, 0, (len(src)-start)/2)
+		srcIdx   = start
+		matchLen int
+		distance int
+		nextLen  int
+		nextDist int
+		haveNext bool
+		mf       = newMatchFinder(src, matchFinderConfig{
+			window:     lzhWindow,
+			minMatch:   lzhMinMatch,
+			maxMatch:   lzhMaxMatch,
+			niceMatch:  lzhNiceMatch,
+			depth:      params.matchIter,
+			hashLog:    lzhHashLog,
+			binaryTree: params.binaryTree,
+		})
+	)
+	for k := max(start-lzhWindow, 0); k < start; k++ {
+		mf.Skip(k) // only the last window of history can be reached
+	}
+	for srcIdx < len(src) {
+		searched := srcIdx + 1 // positions before this have been added to the match finder
+		if haveNext {
+			matchLen, distance = nextLen, nextDist // searched while deciding the last byte
+			haveNext = false
+		} else {
+			matchLen, distance = mf.FindMatch(srcIdx)
+		}
+		if matchLen > 0 && params.lazy && matchLen < lzhNiceMatch && srcIdx+1 < len(src) {
+			nextLen, nextDist = mf.FindMatch(srcIdx + 1)
+			searched++
+			if nextLen > matchLen {
+				haveNext = true
+				matchLen = 0 // take the longer match at the next byte instead
+			}
+		}
+		if matchLen == 0 {
+			tokens = append(tokens, lzhToken{distance: uint16(src[srcIdx])})
+			srcIdx++
+			continue
+		}
+		tokens = append(tokens, lzhToken{length: uint16(matchLen), distance: uint16(distance)})
+		srcIdx += matchLen
+		for k := searched; k < srcIdx; k++ {
+			mf.Skip(k) // keep the positions inside the match searchable
+		}
+	}
+	return tokens
+}
+
+// lzhCodeLengthSymbols run-length codes the code lengths: 0-15 are lengths,
+// 16 repeats the previous length 3-6 times (2 extra bits), 17 repeats zero 3-10
+// times (3 extra bits) and 18 repeats zero 11-138 times (7 extra bits).
+// Each entry holds the symbol and its extra bits value.
+func lzhCodeLengthSymbols(lengths []uint8) [][2]int {
+	var out [][2]int
+	for i := 0; i < len(lengths); {
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == lengths[i] {
+			run++
+		}
+		switch {
+		case lengths[i] == 0 && run >= 11:
+			run = min(run, 138)
+			out = append(out, [2]int{18, run - 11})
+		case lengths[i] == 0 && run >= 3:
+			out = append(out, [2]int{17, run - 3})
+		case run >= 4: // the length itself, then repeats of it
+			run = min(run, 7)
+			out = append(out, [2]int{int(lengths[i]), 0}, [2]int{16, run - 4})
+		default:
+			run = 1
+			out = append(out, [2]int{int(lengths[i]), 0})
+		}
+		i += run
+	}
+	return out
+}
+
+var lzhCLExtra = [19]int{16: 2, 17: 3, 18: 7}
+
+// lzhCodes holds the Huffman codes for one block of tokens, along with the
+// run-length coded code lengths that describe them.
+type lzhCodes struct {
+	litLenLengths []uint8
+	distLengths   []uint8
+	clLengths     []uint8
+	litLenCodes   []uint64
+	distCodes     []uint64
+	clCodes       []uint64
+	clSymbols     [][2]int // run-length coded lengths of both alphabets
+	nLitLen       int      // literal/length codes stored, trailing unused ones are dropped
+	nDist         int      // distance codes stored
+	nCL           int      // code length codes stored
+}
+
+func newLZHCodes(tokens []lzhToken) *lzhCodes {
+	var (
+		litLenFreqs = make([]int, lzhLitLenCodes)
+		distFreqs   = make([]int, lzhDistCodes)
+		clFreqs     = make([]int, 19)
+		c           = &lzhCodes{nLitLen: 257, nDist: 1, nCL: 4}
+	)
+	for _, t := range tokens {
+		if t.length == 0 {
+			litLenFreqs[t.distance]++
+		} else {
+			litLenFreqs[257+lzhLengthSymbol(int(t.length))]++
+			distFreqs[lzhDistSymbol(int(t.distance))]++
+		}
+	}
+	litLenFreqs[lzhEndOfBlock]++
+	c.litLenLengths = buildCodeLengths(litLenFreqs, maxHuffmanCodeLen)
+	c.distLengths = buildCodeLengths(distFreqs, maxHuffmanCodeLen)
+	for i := range lzhLitLenCodes {
+		if c.litLenLengths[i] > 0 {
+			c.nLitLen = max(c.nLitLen, i+1)
+		}
+	}
+	for i := range lzhDistCodes {
+		if c.distLengths[i] > 0 {
+			c.nDist = max(c.nDist, i+1)
+		}
+	}
+	c.clSymbols = lzhCodeLengthSymbols(append(c.litLenLengths[:c.nLitLen:c.nLitLen], c.distLengths[:c.nDist]...))
+	used := 0 // distinct code length symbols
+	for _, cl := range c.clSymbols {
+		if clFreqs[cl[0]] == 0 {
+			used++
+		}
+		clFreqs[cl[0]]++
+	}
+	if used == 1 {
+		clFreqs[slices.Index(clFreqs, 0)] = 1 // zlib rejects a lone 1 bit code length code, so pad it out
+	}
+	c.clLengths = buildCodeLengths(clFreqs, lzhMaxCLCode)
+	for i := range 19 {
+		if c.clLengths[lzhCLOrder[i]] > 0 {
+			c.nCL = max(c.nCL, i+1)
+		}
+	}
+	c.litLenCodes = getHuffmanCodesFromLengths(c.litLenLengths)
+	c.distCodes = getHuffmanCodesFromLengths(c.distLengths)
+	c.clCodes = getHuffmanCodesFromLengths(c.clLengths)
+	return c
+}
+
+// write puts the code lengths and the tokens, closed by the end of block
+// symbol, through put.
+func (c *lzhCodes) write(tokens []lzhToken, put func(bits uint64, n int)) {
+	put(uint64(c.nLitLen-257), 5)
+	put(uint64(c.nDist-1), 5)
+	put(uint64(c.nCL-4), 4)
+	for i := range c.nCL {
+		put(uint64(c.clLengths[lzhCLOrder[i]]), 3)
+	}
+	for _, cl := range c.clSymbols {
+		put(c.clCodes[cl[0]], int(c.clLengths[cl[0]]))
+		put(uint64(cl[1]), lzhCLExtra[cl[0]])
+	}
+	for _, t := range tokens {
+		if t.length == 0 {
+			put(c.litLenCodes[t.distance], int(c.litLenLengths[t.distance]))
+			continue
+		}
+		l, d := lzhLengthSymbol(int(t.length)), lzhDistSymbol(int(t.distance))
+		put(c.litLenCodes[257+l], int(c.litLenLengths[257+l]))
+		put(uint64(int(t.length)-lzhLengthBase[l]), lzhLengthExtra[l])
+		put(c.distCodes[d], int(c.distLengths[d]))
+		put(uint64(int(t.distance)-lzhDistBase[d]), lzhDistExtra[d])
+	}
+	put(c.litLenCodes[lzhEndOfBlock], int(c.litLenLengths[lzhEndOfBlock]))
+}
+
+func (LC LZHCodec) EncodeBlock(src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return src, nil
+	}
+	var (
+		tokens    = lzhParse(src, 0, getLevelParams(LC.level))
+		outBuffer = bytes.NewBuffer(binary.AppendUvarint(nil, uint64(len(src))))
+		bw        = bitio.NewBitWriter(outBuffer)
+		err       error
+	)
+	newLZHCodes(tokens).write(tokens, func(bits uint64, n int) {
+		if err == nil {
+			err = bw.WriteBits(bits, n)
+		}
+	})
+	if err != nil {
+		return []byte{}, fmt.Errorf("error while writing lzh encoded bits: %w", err)
+	}
+	if _, err = bw.Flush(); err != nil {
+		return []byte{}, fmt.Errorf("error while flushing bitwriter during lzh encoding: %w", err)
+	}
+	return outBuffer.Bytes(), nil
+}
+
+func (LZHCodec) DecodeBlock(src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return src, nil
+	}
+	outLen, n := binary.Uvarint(src) // read the decoded length
+	if n <= 0 || outLen > lzhMaxMatch*8*uint64(len(src)) {
+		return []byte{}, sqerr.New(sqerr.Corrupt, "invalid lzh header")
+	}
+	var (
+		r         = msbReader{src: src[n:]}
+		dataBits  = 8 * (len(src) - n)
+		nLitLen   = int(r.read(5)) + 257
+		nDist     = int(r.read(5)) + 1
+		nCL       = int(r.read(4)) + 4
+		clLengths = make([]uint8, 19)
+		lengths   = make([]uint8, 0, nLitLen+nDist)                  // both alphabets' code lengths
+		out       = make([]byte, 0, min(outLen, 8*uint64(len(src)))) // grown as needed past that
+	)
+	if nLitLen > lzhLitLenCodes || nDist > lzhDistCodes {
+		return []byte{}, sqerr.New(sqerr.Corrupt, "invalid lzh code counts")
+	}
+	for i := range nCL {
+		clLengths[lzhCLOrder[i]] = uint8(r.read(3))
+	}
+	clDecoder, err := newHuffmanDecoder(clLengths)
+	if err != nil {
+		return []byte{}, err
+	}
+	for len(lengths) < nLitLen+nDist {
+		symbol, n := clDecoder.decodeSymbol(r.peek())
+		if n == 0 {
+			return []byte{}, sqerr.New(sqerr.Corrupt, "invalid lzh code length code")
+		}
+		r.skip(n)
+		var length uint8
+		repeat := 1
+		switch symbol {
+		case 16:
+			if len(lengths) == 0 {
+				return []byte{}, sqerr.New(sqerr.Corrupt, "lzh code length repeat with nothing to repeat")
+			}
+			length, repeat = lengths[len(lengths)-1], 3+int(r.read(2))
+		case 17:
+			repeat = 3 + int(r.read(3))
+		case 18:
+			repeat = 11 + int(r.read(7))
+		default:
+			length = uint8(symbol)
+		}
+		if len(lengths)+repeat > nLitLen+nDist {
+			return []byte{}, sqerr.New(sqerr.Corrupt, "lzh code lengths overrun the alphabets")
+		}
+		for range repeat {
+			lengths = append(lengths, length)
+		}
+	}
+	litLenDecoder, err := newHuffmanDecoder(lengths[:nLitLen])
+	if err != nil {
+		return []byte{}, err
+	}
+	distDecoder, err := newHuffmanDecoder(lengths[nLitLen:])
+	if err != nil {
+		return []byte{}, err
+	}
+	for {
+		symbol, n := litLenDecoder.decodeSymbol(r.peek())
+		if n == 0 || r.consumed() > dataBits {
+			return []byte{}, sqerr.New(sqerr.Corrupt, "invalid lzh literal/length code")
+		}
+		r.skip(n)
+		if symbol < lzhEndOfBlock {
+			if len(out) == int(outLen) {
+				return []byte{}, sqerr.New(sqerr.Corrupt, "lzh literals overrun the block")
+			}
+			out = append(out, byte(symbol))
+			continue
+		}
+		if symbol == lzhEndOfBlock {
+			break
+		}
+		l := symbol - 257
+		if l >= len(lzhLengthBase) {
+			return []byte{}, sqerr.New(sqerr.Corrupt, "invalid lzh length symbol")
+		}
+		length := lzhLengthBase[l] + int(r.read(lzhLengthExtra[l]))
+		d, n := distDecoder.decodeSymbol(r.peek())
+		if n == 0 || d >= len(lzhDistBase) {
+			return []byte{}, sqerr.New(sqerr.Corrupt, "invalid lzh distance code")
+		}
+		r.skip(n)
+		distance := lzhDistBase[d] + int(r.read(lzhDistExtra[d]))
+		if distance > len(out) || len(out)+length > int(outLen) {
+			return []byte{}, sqerr.New(sqerr.Corrupt, "invalid lzh match")
+		}
+		for range length { // copy byte by byte, matches may overlap themselves
+			out = append(out, out[len(out)-distance])
+		}
+	}
+	if len(out) != int(outLen) || r.consumed() > dataBits {
+		return []byte{}, sqerr.New(sqerr.Corrupt, "lzh block ended early")
+	}
+	return out, nil
+}
+
+func (LZHCodec) IsLossless() bool {
+	return true
+}
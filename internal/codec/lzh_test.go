@@ -0,0 +1,118 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func LZHEncodeDecode(message string, t *testing.T) {
+	lc := LZHCodec{}
+	coded, err := lc.EncodeBlock([]byte(message))
+	if err != nil {
+		t.Fatalf("LZH encoding failed: %v", err)
+	}
+	decoded, err := lc.DecodeBlock(coded)
+	if err != nil {
+		t.Fatalf("LZH decoding failed: %v", err)
+	}
+	if message != string(decoded) {
+		t.Fatalf("LZH encoding mismatch: got %s - expected %s", string(decoded), message)
+	}
+}
+
+func TestLZHEncodeDecode(t *testing.T) {
+	message := "The mellow yellow fellow says hello world!"
+	LZHEncodeDecode(message, t)
+}
+
+func TestLZHRunLength(t *testing.T) {
+	message := []byte{0, 1}
+	a, b := 1, 1
+	for i := range 20 {
+		a, b = b, a+b
+		message = append(message, bytes.Repeat([]byte{byte(i)}, b)...)
+	}
+	LZHEncodeDecode(string(message), t)
+}
+
+func TestLZHEmptyMessage(t *testing.T) {
+	message := ""
+	LZHEncodeDecode(message, t)
+}
+
+func TestLZHAllBytes(t *testing.T) {
+	message := make([]byte, 1<<16)
+	rand.New(rand.NewSource(1)).Read(message)
+	LZHEncodeDecode(string(message), t)
+}
+
+func TestLZHLossless(t *testing.T) {
+	lc := LZHCodec{}
+	if !lc.IsLossless() {
+		t.Fatalf("LZH is lossless, but returned lossy")
+	}
+}
+
+func TestLZHLevels(t *testing.T) {
+	var text bytes.Buffer
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"squish", "block", "codec", "huffman", "match", "window", "literal", "length", "distance"}
+	for text.Len() < 1<<17 {
+		fmt.Fprintf(&text, "%s %s %d, ", words[rng.Intn(len(words))], words[rng.Intn(len(words))], rng.Intn(1000))
+	}
+	message := text.Bytes()
+	for level := MinLevel; level <= MaxLevel; level++ {
+		lzss, err := LZSSCodec{}.WithLevel(level).EncodeBlock(message)
+		if err != nil {
+			t.Fatalf("LZSS encoding failed at level %d: %v", level, err)
+		}
+		pipeline, err := HUFFMANCodec{}.EncodeBlock(lzss)
+		if err != nil {
+			t.Fatalf("HUFFMAN encoding failed: %v", err)
+		}
+		lc := LZHCodec{}.WithLevel(level)
+		coded, err := lc.EncodeBlock(message)
+		if err != nil {
+			t.Fatalf("LZH encoding failed at level %d: %v", level, err)
+		}
+		decoded, err := lc.DecodeBlock(coded)
+		if err != nil {
+			t.Fatalf("LZH decoding failed at level %d: %v", level, err)
+		}
+		if !bytes.Equal(message, decoded) {
+			t.Fatalf("LZH encoding mismatch at level %d", level)
+		}
+		if len(coded) >= len(pipeline) {
+			t.Fatalf("LZH at level %d is no smaller than LZSS-HUFFMAN: %d >= %d bytes", level, len(coded), len(pipeline))
+		}
+	}
+}
+
+func TestLZHSymbols(t *testing.T) {
+	for length := lzhMinMatch; length <= lzhMaxMatch; length++ {
+		s := lzhLengthSymbol(length)
+		if length < lzhLengthBase[s] || length-lzhLengthBase[s] >= 1<<lzhLengthExtra[s] && s != len(lzhLengthBase)-1 {
+			t.Fatalf("LZH length %d mapped to symbol %d", length, s)
+		}
+	}
+	for distance := 1; distance <= lzhWindow; distance++ {
+		s := lzhDistSymbol(distance)
+		if distance < lzhDistBase[s] || distance-lzhDistBase[s] >= 1<<lzhDistExtra[s] {
+			t.Fatalf("LZH distance %d mapped to symbol %d", distance, s)
+		}
+	}
+}
+
+func TestLZHCorrupt(t *testing.T) {
+	coded, err := LZHCodec{}.EncodeBlock(bytes.Repeat([]byte("hello "), 100))
+	if err != nil {
+		t.Fatalf("LZH encoding failed: %v", err)
+	}
+	for i := 1; i < len(coded); i++ {
+		if _, err := (LZHCodec{}).DecodeBlock(coded[:i]); err == nil {
+			t.Fatalf("LZH decoded a truncated payload of %d bytes", i)
+		}
+	}
+}
@@ -1,57 +1,129 @@
 package codec
 
+import "squish/internal/sqerr"
+
 const (
-	maxLookBack  = 1<<12 - 1              // 4095 - how far back to look for matches
-	minMatchLen  = 3                      // min match length
-	maxMatchLen  = 1<<4 - 1 + minMatchLen // 15 - how far forward you can match (after min match)
-	maxMatchIter = 32                     // number of hash matches to look back through before halting
-	hashSize     = 1 << 16
+	minMatchLen          = 3      // min match length
+	lzssHashLog          = 16     // bits of the 3-byte sequence hash
+	literalCost          = 1 + 8  // flag bit + literal byte
+	matchCost            = 1 + 16 // flag bit + lookback and length bytes
+	lzssTokenBits        = 16     // a match is a 2 byte token of lookback then length
+	lzssMinWindowLog     = 8      // smallest window, 255 bytes back with matches up to 258 bytes
+	lzssMaxWindowLog     = 14     // largest window, 16383 bytes back with matches up to 6 bytes
+	lzssDefaultWindowLog = 12     // 4095 bytes back with matches up to 18 bytes
 )
 
-type LZSSCodec struct{}
+// LZSSCodec is a flag-byte LZSS codec. Each flag bit marks a literal byte or
+// a match token of windowlog bits of lookback and the remaining bits of
+// length, so a wider window leaves room for shorter matches only.
+type LZSSCodec struct {
+	windowLog int // log2 of the window size, zero uses the default
+	level     int // compression level, zero uses the default
+}
 
-func balanceBytes(lookBack int, runLen int) []byte {
-	a := byte((lookBack >> 4) & 0xFF)                                     // keep the 8 MSb of the lookback in one byte
-	b := byte(((lookBack << 4) & 0xF0) | ((runLen - minMatchLen) & 0x0F)) // and 4 LSb of lookback + 4 bit length in other byte
-	return []byte{a, b}
+func (LC LZSSCodec) WithLevel(level int) Codec {
+	LC.level = level
+	return LC
 }
 
-func splitBytes(a byte, b byte) (int, int) {
-	lookback := (int(a) << 4) | int((b>>4)&0x0F) // lookback is first byte + 4 msb of second bit
-	runLen := int(b&0x0F) + minMatchLen          // length is lsb bits of second byte + minimum match length
-	return lookback, runLen
+func (LC LZSSCodec) getWindowLog() int {
+	if LC.windowLog < lzssMinWindowLog || LC.windowLog > lzssMaxWindowLog {
+		return lzssDefaultWindowLog
+	}
+	return LC.windowLog
 }
 
-func hashBytes(bytes []byte) int {
-	hash := 0
-	for i := range len(bytes) {
-		hash = (hash << 8) | int(bytes[i])
+// Params returns windowlog, the bits of lookback in a match token.
+func (LC LZSSCodec) Params() Params {
+	return Params{"windowlog": LC.getWindowLog()}
+}
+
+func (LC LZSSCodec) WithParams(p Params) (Codec, error) {
+	if err := checkParams("LZSS", p, map[string][2]int{"windowlog": {lzssMinWindowLog, lzssMaxWindowLog}}); err != nil {
+		return nil, err
 	}
-	return hash & (hashSize - 1)
+	if v, ok := p["windowlog"]; ok {
+		LC.windowLog = v
+	}
+	return LC, nil
 }
 
-func (LZSSCodec) EncodeBlock(src []byte) ([]byte, error) {
+// maxLookBack is how far back a match token can reach.
+func (LC LZSSCodec) maxLookBack() int {
+	return 1<<LC.getWindowLog() - 1
+}
+
+// maxMatchLen is the longest match the length bits of a token hold.
+func (LC LZSSCodec) maxMatchLen() int {
+	return 1<<(lzssTokenBits-LC.getWindowLog()) - 1 + minMatchLen
+}
+
+func (LC LZSSCodec) balanceBytes(lookBack int, runLen int) []byte {
+	token := lookBack<<(lzssTokenBits-LC.getWindowLog()) | (runLen - minMatchLen) // lookback in the msb, length in the lsb
+	return []byte{byte(token >> 8), byte(token)}
+}
+
+func (LC LZSSCodec) splitBytes(a byte, b byte) (int, int) {
+	lengthBits := lzssTokenBits - LC.getWindowLog()
+	token := int(a)<<8 | int(b)
+	lookback := token >> lengthBits                 // lookback is the msb of the token
+	runLen := token&(1<<lengthBits-1) + minMatchLen // length is the lsb + minimum match length
+	return lookback, runLen
+}
+
+// optimalParse picks the cheapest sequence of literals and matches for the
+// whole block. It records the longest match at every position, then walks the
+// block backwards pricing each choice by its real token size in bits. Any prefix
+// of a match of at least minMatchLen bytes is itself a valid match, so every
+// shorter length is considered too. The returned slice holds the chosen match
+// length and lookback per position, with zero length meaning a literal.
+func optimalParse(n int, mf matchFinder) [][2]int {
 	var (
-		head         [hashSize]int                                        // most recent match of hashes 3-byte sequence
-		prev         [maxLookBack + 1]int                                 // previous matches
-		output       []byte               = make([]byte, 0, len(src)*9/8) // output byte slice
-		srcIdx       int                  = 0                             // where you are in the input
-		matchStream  []byte               = make([]byte, 0, 16)           // current matching values corresponding to flag bits
-		flagIdx      int                                                  // where you are in processing flags
-		flagByte     byte                                                 // the flag byte
-		hash         int                                                  // hash of the next minMatchLen bytes
-		curMatchIdx  int                                                  // where the current match is in the input
-		curMatchLen  int                                                  // how long it is
-		bestMatchLen int                                                  // best match length per 3 byte hash
-		bestLookBack int                                                  // lookback for that best match
-		iterations   int                                                  // number of iterations of checking matches
-		lookBackIdx  int                                                  // index of the lookback window start
+		longest = make([][2]int, n)   // longest match (length, lookback) at each position
+		cost    = make([]int, n+1)    // cheapest cost in bits from a position to the end
+		choice  = make([][2]int, n+1) // the token that achieves that cost
 	)
-	for i := range len(head) {
-		head[i] = -1 // set the head hash-match index mapping array to -1
+	for i := range n {
+		longest[i][0], longest[i][1] = mf.FindMatch(i)
+	}
+	for i := n - 1; i >= 0; i-- {
+		cost[i] = cost[i+1] + literalCost // a literal is always possible
+		choice[i] = [2]int{0, 0}
+		for l := minMatchLen; l <= longest[i][0]; l++ {
+			if c := cost[i+l] + matchCost; c < cost[i] {
+				cost[i] = c
+				choice[i] = [2]int{l, longest[i][1]}
+			}
+		}
 	}
-	for i := range len(prev) {
-		prev[i] = -1 // set the list of previous matches to -1
+	return choice[:n]
+}
+
+func (LC LZSSCodec) EncodeBlock(src []byte) ([]byte, error) {
+	var (
+		params       levelParams = getLevelParams(LC.level)      // match finder effort
+		output       []byte      = make([]byte, 0, len(src)*9/8) // output byte slice
+		srcIdx       int         = 0                             // where you are in the input
+		matchStream  []byte      = make([]byte, 0, 16)           // current matching values corresponding to flag bits
+		flagIdx      int                                         // where you are in processing flags
+		flagByte     byte                                        // the flag byte
+		bestMatchLen int                                         // best match length at the current position
+		bestLookBack int                                         // lookback for that best match
+		nextMatchLen int                                         // best match length one byte further (lazy matching)
+		nextLookBack int                                         // lookback for that match
+		haveNext     bool                                        // whether the next position was already searched
+		parse        [][2]int                                    // chosen match per position (optimal parsing)
+		mf           matchFinder = newMatchFinder(src, matchFinderConfig{
+			window:     LC.maxLookBack(),
+			minMatch:   minMatchLen,
+			maxMatch:   LC.maxMatchLen(),
+			depth:      params.matchIter,
+			hashLog:    lzssHashLog,
+			binaryTree: params.binaryTree,
+		})
+	)
+	if params.optimal {
+		parse = optimalParse(len(src), mf) // every position is searched up front
 	}
 	for srcIdx < len(src) {
 		flagIdx = 7                   // start at the msb of the flag
@@ -61,50 +133,37 @@ func (LZSSCodec) EncodeBlock(src []byte) ([]byte, error) {
 			if srcIdx >= len(src) {
 				break // dip if you run out of source before finishing the flag byte
 			}
-			bestMatchLen = 0                    // reset you best match
-			bestLookBack = -1                   // and best look back
-			if srcIdx+minMatchLen <= len(src) { // don't go out of bounds
-				iterations = 0                                     // reset your iterations of match checks
-				hash = hashBytes(src[srcIdx : srcIdx+minMatchLen]) // get the hash of the current three consecutive bytes
-				curMatchIdx = head[hash]                           // get the index of the last match of that hash
-				lookBackIdx = max(0, srcIdx-maxLookBack)           // determine the lookback value
-				for curMatchIdx != -1 &&                           // while there is a match within the window
-					curMatchIdx >= lookBackIdx && // and the match is within the window
-					iterations < maxMatchIter { // and you haven't exceeded your max iterations
-					curMatchLen = 0                  // reset the length of the match
-					for curMatchLen < maxMatchLen && // while you haven't achieved the longest match possible
-						srcIdx+curMatchLen < len(src) && // your front match isn't extending past the source data
-						curMatchIdx < srcIdx && // you aren't getting ahead of yourself... literally
-						src[curMatchIdx+curMatchLen] == src[srcIdx+curMatchLen] { // and the match continues
-						curMatchLen++ // keep counting
-					}
-					if curMatchLen >= minMatchLen && curMatchLen > bestMatchLen { // save it off if is the best match yet
-						bestMatchLen = curMatchLen
-						bestLookBack = srcIdx - curMatchIdx
-						if bestMatchLen == maxMatchLen {
-							break
-						}
-					}
-					curMatchIdx = prev[curMatchIdx%(maxLookBack+1)] // grab the next match if it is still iterating
-					iterations++                                    // count it
+			searched := srcIdx + 1 // positions before this have been added to the match finder
+			if parse != nil {
+				bestMatchLen, bestLookBack = parse[srcIdx][0], parse[srcIdx][1]
+				searched = len(src)
+			} else if haveNext {
+				bestMatchLen, bestLookBack = nextMatchLen, nextLookBack // searched while deciding the last byte
+				haveNext = false
+			} else {
+				bestMatchLen, bestLookBack = mf.FindMatch(srcIdx)
+			}
+			if parse == nil && params.lazy && // when matching lazily
+				bestMatchLen >= minMatchLen && bestMatchLen < LC.maxMatchLen() && // and the match could be beaten
+				srcIdx+1 < len(src) { // and there is room for a later match
+				nextMatchLen, nextLookBack = mf.FindMatch(srcIdx + 1)
+				haveNext = true
+				searched++
+				if nextMatchLen > bestMatchLen {
+					bestMatchLen = 0 // emit a literal and take the longer match at the next byte
 				}
 			}
-			start := srcIdx                  // where does the match start
 			if bestMatchLen >= minMatchLen { // for matches
-				flagByte |= (1 << flagIdx)                                                     // add a 1 bit to the flag
-				matchStream = append(matchStream, balanceBytes(bestLookBack, bestMatchLen)...) // add the look back + length bytes
-				srcIdx += bestMatchLen                                                         // increment where you are in the source data
+				flagByte |= (1 << flagIdx)                                                        // add a 1 bit to the flag
+				matchStream = append(matchStream, LC.balanceBytes(bestLookBack, bestMatchLen)...) // add the look back + length bytes
+				srcIdx += bestMatchLen                                                            // increment where you are in the source data
+				haveNext = false                                                                  // the next position is inside the match
 			} else { // for literals
 				matchStream = append(matchStream, src[srcIdx]) // add the literal
 				srcIdx++                                       // increment where you are in the source data
 			}
-			end := srcIdx                  // keep track of where the match ended
-			for k := start; k < end; k++ { // loop through all the 3 byte chunks from the beginning of the match to the end
-				if minMatchLen+k <= len(src) { // don't read past the end
-					hash = hashBytes(src[k : k+minMatchLen]) // get the hash of the next bytes
-					prev[k%(maxLookBack+1)] = head[hash]     // update the old matches
-					head[hash] = k                           // update the newest most recent match
-				}
+			for k := searched; k < srcIdx; k++ { // add the rest of the match so later searches can find it
+				mf.Skip(k)
 			}
 			flagIdx--
 		}
@@ -114,7 +173,7 @@ func (LZSSCodec) EncodeBlock(src []byte) ([]byte, error) {
 	return output, nil
 }
 
-func (LZSSCodec) DecodeBlock(src []byte) ([]byte, error) {
+func (LC LZSSCodec) DecodeBlock(src []byte) ([]byte, error) {
 	if len(src) == 0 {
 		return []byte{}, nil
 	}
@@ -128,6 +187,8 @@ func (LZSSCodec) DecodeBlock(src []byte) ([]byte, error) {
 		runLen   int  // how long a run is
 
 	)
+	lenMask := 1<<(lzssTokenBits-LC.getWindowLog()) - 1 // the length bits of a match token
+
 	for srcIdx < len(src) { // scan through the input to count how long the output will be
 		flagByte = src[srcIdx]                     // get the current flag byte
 		srcIdx++                                   // move past the flag byte
@@ -137,8 +198,8 @@ func (LZSSCodec) DecodeBlock(src []byte) ([]byte, error) {
 				outLen++ // increase the output length by one byte
 				srcIdx++ // move forward as you scan through the source
 			} else if srcIdx+1 < len(src) {
-				outLen += int(src[srcIdx+1]&0x0F) + minMatchLen // increase the output by the length of the run
-				srcIdx += 2                                     // move forward as you scan through the source
+				outLen += int(src[srcIdx+1])&lenMask + minMatchLen // increase the output by the length of the run
+				srcIdx += 2                                        // move forward as you scan through the source
 			}
 			if srcIdx > len(src) {
 				break
@@ -159,7 +220,13 @@ func (LZSSCodec) DecodeBlock(src []byte) ([]byte, error) {
 				output = append(output, src[srcIdx]) // add the literal to the output
 				srcIdx++                             // move forward as you scan through the source
 			} else {
-				lookback, runLen = splitBytes(src[srcIdx], src[srcIdx+1]) // get the reference details
+				if srcIdx+1 >= len(src) {
+					return []byte{}, sqerr.New(sqerr.Corrupt, "truncated LZSS match")
+				}
+				lookback, runLen = LC.splitBytes(src[srcIdx], src[srcIdx+1]) // get the reference details
+				if lookback == 0 || lookback > len(output) {
+					return []byte{}, sqerr.New(sqerr.Corrupt, "LZSS match reaches before the block")
+				}
 				for range runLen {
 					output = append(output, output[len(output)-lookback]) // copy the match up to the front
 				}
@@ -2,6 +2,7 @@ package codec
 
 import (
 	"bytes"
+	"math/rand"
 	"testing"
 )
 
@@ -46,3 +47,98 @@ func TestLZSSLossless(t *testing.T) {
 		t.Fatalf("LZSS is lossless, but returned lossy")
 	}
 }
+
+func TestLZSSLevels(t *testing.T) {
+	message := bytes.Repeat([]byte("The mellow yellow fellow says hello world! Yellow fellows mellow."), 50)
+	sizes := make([]int, MaxLevel+1)
+	for level := MinLevel; level <= MaxLevel; level++ {
+		lc := LZSSCodec{}.WithLevel(level)
+		coded, err := lc.EncodeBlock(message)
+		if err != nil {
+			t.Fatalf("LZSS encoding failed at level %d: %v", level, err)
+		}
+		decoded, err := LZSSCodec{}.DecodeBlock(coded)
+		if err != nil {
+			t.Fatalf("LZSS decoding failed at level %d: %v", level, err)
+		}
+		if !bytes.Equal(message, decoded) {
+			t.Fatalf("LZSS encoding mismatch at level %d", level)
+		}
+		sizes[level] = len(coded)
+	}
+	if sizes[MaxLevel] > sizes[MinLevel] {
+		t.Fatalf("LZSS level %d (%d bytes) compressed worse than level %d (%d bytes)", MaxLevel, sizes[MaxLevel], MinLevel, sizes[MinLevel])
+	}
+}
+
+func TestLZSSOptimalParse(t *testing.T) {
+	message := bytes.Repeat([]byte("abcde_bcdefgh_abcdefgh_cdefg_"), 40)
+	greedy, err := LZSSCodec{level: 6}.EncodeBlock(message)
+	if err != nil {
+		t.Fatalf("LZSS greedy encoding failed: %v", err)
+	}
+	lazy, err := LZSSCodec{level: 7}.EncodeBlock(message)
+	if err != nil {
+		t.Fatalf("LZSS lazy encoding failed: %v", err)
+	}
+	optimal, err := LZSSCodec{level: 8}.EncodeBlock(message)
+	if err != nil {
+		t.Fatalf("LZSS optimal encoding failed: %v", err)
+	}
+	if len(optimal) > len(lazy) || len(optimal) > len(greedy) {
+		t.Fatalf("LZSS optimal parse (%d bytes) lost to greedy (%d bytes) or lazy (%d bytes)", len(optimal), len(greedy), len(lazy))
+	}
+	decoded, err := LZSSCodec{}.DecodeBlock(optimal)
+	if err != nil {
+		t.Fatalf("LZSS decoding failed: %v", err)
+	}
+	if !bytes.Equal(message, decoded) {
+		t.Fatalf("LZSS optimal parse mismatch")
+	}
+}
+
+func TestLZSSWindowLog(t *testing.T) {
+	r := rand.New(rand.NewSource(22))
+	chunk := make([]byte, 10000)
+	r.Read(chunk)
+	message := append(bytes.Clone(chunk), chunk...) // repeats beyond the default window
+	sizes := map[int]int{}
+	for windowLog := lzssMinWindowLog; windowLog <= lzssMaxWindowLog; windowLog++ {
+		c, err := LZSSCodec{}.WithParams(Params{"windowlog": windowLog})
+		if err != nil {
+			t.Fatalf("Failed to set windowlog %d: %v", windowLog, err)
+		}
+		for _, level := range []int{1, 6, 9} {
+			lc := c.(LZSSCodec).WithLevel(level)
+			coded, err := lc.EncodeBlock(message)
+			if err != nil {
+				t.Fatalf("LZSS encoding failed with windowlog %d: %v", windowLog, err)
+			}
+			decoded, err := lc.DecodeBlock(coded)
+			if err != nil || !bytes.Equal(decoded, message) {
+				t.Fatalf("LZSS round trip failed with windowlog %d at level %d: %v", windowLog, level, err)
+			}
+			sizes[windowLog] = len(coded)
+		}
+	}
+	if sizes[lzssMaxWindowLog] > len(message)*3/4 || sizes[lzssDefaultWindowLog] < len(message) {
+		t.Fatalf("Only the widest window should reach the repeat: %v", sizes)
+	}
+	for _, bad := range []Params{{"windowlog": lzssMinWindowLog - 1}, {"windowlog": lzssMaxWindowLog + 1}, {"window": 12}} {
+		if _, err := (LZSSCodec{}).WithParams(bad); err == nil {
+			t.Fatalf("Accepted LZSS parameters %s", bad)
+		}
+	}
+}
+
+func TestLZSSCorrupt(t *testing.T) {
+	for name, src := range map[string][]byte{
+		"match before the block": {0x80, 0x00, 0x10},
+		"zero lookback":          {0x40, 'a', 0x00, 0x01},
+		"truncated match":        {0x40, 'a', 0x00},
+	} {
+		if _, err := (LZSSCodec{}).DecodeBlock(src); err == nil {
+			t.Fatalf("Missed %s", name)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package codec
+
+import "encoding/binary"
+
+// matchFinder searches a block for earlier copies of the bytes at a position.
+// Positions must be visited in increasing order, each exactly once, through
+// either FindMatch or Skip, so that later searches can see them.
+type matchFinder interface {
+	FindMatch(pos int) (length int, distance int) // longest match at pos, zero length if none, then adds pos
+	Skip(pos int)                                 // adds pos without searching
+}
+
+type matchFinderConfig struct {
+	window     int  // furthest distance a match may reach back
+	minMatch   int  // shortest match worth reporting, also the number of bytes hashed (3 or 4)
+	maxMatch   int  // longest match to report, zero means up to the end of the block
+	niceMatch  int  // stop searching once a match this long is found, zero means maxMatch
+	depth      int  // number of candidates visited per search before giving up
+	hashLog    int  // log2 of the number of hash buckets
+	binaryTree bool // keep candidates in a binary tree rather than a hash chain
+}
+
+// newMatchFinder returns a match finder over src. Both finders keep their
+// history in ring buffers sized to the window (or the block, when smaller),
+// so memory stays bounded by the window rather than the block.
+func newMatchFinder(src []byte, cfg matchFinderConfig) matchFinder {
+	if cfg.maxMatch <= 0 {
+		cfg.maxMatch = len(src)
+	}
+	if cfg.niceMatch <= 0 || cfg.niceMatch > cfg.maxMatch {
+		cfg.niceMatch = cfg.maxMatch
+	}
+	cfg.depth = max(cfg.depth, 1)
+	base := matchBase{
+		src:  src,
+		cfg:  cfg,
+		head: make([]int32, 1<<cfg.hashLog),
+		ring: max(min(cfg.window+1, len(src)), 1),
+	}
+	for i := range len(base.head) {
+		base.head[i] = -1 // no positions seen yet
+	}
+	if cfg.binaryTree {
+		return &binaryTree{
+			matchBase: base,
+			left:      make([]int32, base.ring),
+			right:     make([]int32, base.ring),
+		}
+	}
+	return &hashChain{
+		matchBase: base,
+		prev:      make([]int32, base.ring),
+	}
+}
+
+// matchBase holds what both match finders share.
+type matchBase struct {
+	src  []byte
+	cfg  matchFinderConfig
+	head []int32 // most recent position of each hash
+	ring int     // size of the history ring buffers
+}
+
+func (mb *matchBase) hash(pos int) int {
+	var v uint32
+	if mb.cfg.minMatch >= 4 {
+		v = binary.LittleEndian.Uint32(mb.src[pos:])
+	} else {
+		v = uint32(mb.src[pos]) | uint32(mb.src[pos+1])<<8 | uint32(mb.src[pos+2])<<16
+	}
+	return int((v * 2654435761) >> (32 - mb.cfg.hashLog))
+}
+
+// limit returns how long a match at pos can be, or zero if pos can't be hashed.
+func (mb *matchBase) limit(pos int) int {
+	if pos+mb.cfg.minMatch > len(mb.src) {
+		return 0
+	}
+	return min(mb.cfg.maxMatch, len(mb.src)-pos)
+}
+
+func (mb *matchBase) inWindow(cand int, pos int) bool {
+	return cand >= 0 && cand < pos && pos-cand <= mb.cfg.window
+}
+
+func matchLength(src []byte, a int, b int, limit int) int {
+	n := 0
+	for n < limit && src[a+n] == src[b+n] {
+		n++
+	}
+	return n
+}
+
+// hashChain links every position to the previous one with the same hash and
+// walks that list from the newest candidate back.
+type hashChain struct {
+	matchBase
+	prev []int32 // previous position with the same hash
+}
+
+func (hc *hashChain) FindMatch(pos int) (int, int) {
+	limit := hc.limit(pos)
+	if limit == 0 {
+		return 0, 0
+	}
+	var (
+		h        = hc.hash(pos)
+		cand     = int(hc.head[h]) // newest candidate
+		bestLen  int               // longest match found
+		bestDist int               // distance of that match
+	)
+	for depth := 0; hc.inWindow(cand, pos) && depth < hc.cfg.depth; depth++ {
+		if hc.src[cand+bestLen] == hc.src[pos+bestLen] { // only a longer match is interesting
+			if l := matchLength(hc.src, cand, pos, limit); l > bestLen {
+				bestLen, bestDist = l, pos-cand
+				if l == limit || l >= hc.cfg.niceMatch {
+					break // can't do better, or good enough
+				}
+			}
+		}
+		cand = int(hc.prev[cand%hc.ring])
+	}
+	hc.prev[pos%hc.ring] = hc.head[h]
+	hc.head[h] = int32(pos)
+	if bestLen < hc.cfg.minMatch {
+		return 0, 0
+	}
+	return bestLen, bestDist
+}
+
+func (hc *hashChain) Skip(pos int) {
+	if hc.limit(pos) == 0 {
+		return
+	}
+	h := hc.hash(pos)
+	hc.prev[pos%hc.ring] = hc.head[h]
+	hc.head[h] = int32(pos)
+}
+
+// binaryTree keeps the candidates of each hash in a binary search tree ordered
+// by the bytes that follow them, rebuilt around every new position as it is
+// added (as in LZMA's bt match finders). Searches visit far fewer candidates
+// than a hash chain for the same match length on repetitive data.
+type binaryTree struct {
+	matchBase
+	left  []int32 // candidates sorting before a position
+	right []int32 // candidates sorting after a position
+}
+
+func (bt *binaryTree) FindMatch(pos int) (int, int) {
+	return bt.insert(pos, true)
+}
+
+func (bt *binaryTree) Skip(pos int) {
+	bt.insert(pos, false)
+}
+
+// insert makes pos the root of its hash's tree, splitting the old tree into
+// the new root's left and right subtrees while searching for the longest match.
+func (bt *binaryTree) insert(pos int, search bool) (int, int) {
+	limit := bt.limit(pos)
+	if limit == 0 {
+		return 0, 0
+	}
+	treeLimit := min(limit, bt.cfg.niceMatch) // the tree is only ordered this deep
+	var (
+		h        = bt.hash(pos)
+		cand     = int(bt.head[h])        // current node
+		lessPtr  = &bt.left[pos%bt.ring]  // where the next smaller node hangs
+		morePtr  = &bt.right[pos%bt.ring] // where the next larger node hangs
+		lessLen  int                      // bytes known to match along the smaller side
+		moreLen  int                      // bytes known to match along the larger side
+		bestLen  int                      // longest match found
+		bestDist int                      // distance of that match
+	)
+	bt.head[h] = int32(pos)
+	for depth := 0; ; depth++ {
+		if !bt.inWindow(cand, pos) || depth >= bt.cfg.depth {
+			*lessPtr, *morePtr = -1, -1
+			break
+		}
+		node := cand % bt.ring
+		l := min(lessLen, moreLen) // both sides agree on at least this many bytes
+		l += matchLength(bt.src, cand+l, pos+l, treeLimit-l)
+		if search && l > bestLen {
+			bestLen, bestDist = l, pos-cand
+		}
+		if l == treeLimit { // identical as far as we can compare, so cand's subtrees become ours
+			*lessPtr, *morePtr = bt.left[node], bt.right[node]
+			break
+		}
+		if bt.src[cand+l] < bt.src[pos+l] {
+			*lessPtr = int32(cand)
+			lessPtr = &bt.right[node]
+			cand = int(*lessPtr)
+			lessLen = l
+		} else {
+			*morePtr = int32(cand)
+			morePtr = &bt.left[node]
+			cand = int(*morePtr)
+			moreLen = l
+		}
+	}
+	if bestLen < bt.cfg.minMatch {
+		return 0, 0
+	}
+	if bestLen == treeLimit { // see how far past the nice length the match runs
+		bestLen += matchLength(bt.src, pos-bestDist+bestLen, pos+bestLen, limit-bestLen)
+	}
+	return bestLen, bestDist
+}
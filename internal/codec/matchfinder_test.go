@@ -0,0 +1,67 @@
+package codec
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// longestMatch searches every earlier position for the longest match at pos.
+func longestMatch(src []byte, pos int, cfg matchFinderConfig) int {
+	best := 0
+	for cand := max(0, pos-cfg.window); cand < pos; cand++ {
+		best = max(best, matchLength(src, cand, pos, min(cfg.maxMatch, len(src)-pos)))
+	}
+	if best < cfg.minMatch || pos+cfg.minMatch > len(src) {
+		return 0
+	}
+	return best
+}
+
+func MatchFinderAgainstSearch(src []byte, cfg matchFinderConfig, t *testing.T) {
+	mf := newMatchFinder(src, cfg)
+	for pos := range len(src) {
+		if pos%3 == 2 {
+			mf.Skip(pos) // skipped positions must still be found later
+			continue
+		}
+		length, distance := mf.FindMatch(pos)
+		if want := longestMatch(src, pos, cfg); length != want {
+			t.Fatalf("Match finder (binary tree %v) found length %d at %d, expected %d", cfg.binaryTree, length, pos, want)
+		}
+		if length > 0 && (distance <= 0 || distance > cfg.window || matchLength(src, pos-distance, pos, length) != length) {
+			t.Fatalf("Match finder (binary tree %v) returned invalid match (%d, %d) at %d", cfg.binaryTree, length, distance, pos)
+		}
+	}
+}
+
+func TestMatchFinders(t *testing.T) {
+	src := make([]byte, 1<<13)
+	rnd := rand.New(rand.NewSource(1))
+	for i := range src {
+		src[i] = "ab"[rnd.Intn(2)] // small alphabet for lots of long matches
+	}
+	for _, binaryTree := range []bool{false, true} {
+		for _, minMatch := range []int{3, 4} {
+			cfg := matchFinderConfig{window: 1 << 10, minMatch: minMatch, maxMatch: 40, depth: 1 << 20, hashLog: 12, binaryTree: binaryTree}
+			MatchFinderAgainstSearch(src, cfg, t)
+			cfg.window, cfg.maxMatch = len(src), len(src) // whole block window, matches up to the end
+			MatchFinderAgainstSearch(src, cfg, t)
+		}
+	}
+}
+
+func TestMatchFinderNiceMatch(t *testing.T) {
+	src := make([]byte, 1<<12)
+	rand.New(rand.NewSource(1)).Read(src[:1<<11])
+	copy(src[1<<11:], src[:1<<11])
+	for _, binaryTree := range []bool{false, true} {
+		mf := newMatchFinder(src, matchFinderConfig{window: len(src), minMatch: 4, niceMatch: 16, depth: 4, hashLog: 12, binaryTree: binaryTree})
+		for pos := range 1 << 11 {
+			mf.Skip(pos)
+		}
+		length, distance := mf.FindMatch(1 << 11)
+		if length != 1<<11 || distance != 1<<11 {
+			t.Fatalf("Match finder (binary tree %v) returned (%d, %d), expected the whole repeat", binaryTree, length, distance)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"squish/internal/bitio"
+	"squish/internal/sqerr"
+)
+
+const (
+	mhuffGroupSize  = 50 // symbols coded with the same table
+	mhuffMaxTables  = 6  // most tables in a block
+	mhuffIterations = 4  // rounds of refining the tables and the group assignment
+)
+
+// MHUFFMANCodec is a bzip2 style Huffman codec with several code tables per
+// block. Each group of 50 symbols is coded with whichever table suits it best,
+// so the codes can follow statistics that shift within a block, as they do
+// after BWT and MTF. The payload is
+//
+//	uvarint length, 32 byte used symbol bitmap, table count, then a bitstream
+//	of the tables' code lengths, the MTF coded table selectors and the codes.
+//
+// Each table stores its first code length in 4 bits, then for every used
+// symbol steps from the previous length to its own, "10" adding one and
+// "11" taking one away, ending with "0". Selectors are unary, n ones and a zero.
+type MHUFFMANCodec struct{}
+
+// mhuffTableCount picks more tables for longer blocks, as bzip2 does.
+func mhuffTableCount(n int) int {
+	switch {
+	case n < 200:
+		return 2
+	case n < 600:
+		return 3
+	case n < 1200:
+		return 4
+	case n < 2400:
+		return 5
+	}
+	return mhuffMaxTables
+}
+
+func (MHUFFMANCodec) EncodeBlock(src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return src, nil
+	}
+	var (
+		freq      = getFrequencyMap(src)                             // symbol frequencies of the whole block
+		used      []int                                              // symbols present, in order
+		nGroups   = (len(src) + mhuffGroupSize - 1) / mhuffGroupSize // number of symbol groups
+		selectors = make([]byte, nGroups)                            // table used by each group
+	)
+	for s := range 256 {
+		if freq[s] > 0 {
+			used = append(used, s)
+		}
+	}
+	nTables := min(mhuffTableCount(len(src)), len(used))
+	lengths := make([][256]uint8, nTables)
+	// start each table cheap on its own run of symbols holding a similar share
+	// of the block, and expensive on the rest
+	remaining, start := len(src), 0
+	for t := range nTables {
+		target, share, end := remaining/(nTables-t), 0, start
+		for end < len(used) && (end == start || share < target) && len(used)-end > nTables-t-1 {
+			share += freq[used[end]]
+			end++
+		}
+		for _, s := range used {
+			lengths[t][s] = maxHuffmanCodeLen
+		}
+		for _, s := range used[start:end] {
+			lengths[t][s] = 1
+		}
+		remaining -= share
+		start = end
+	}
+	for range mhuffIterations {
+		tableFreqs := make([][256]int, nTables)
+		for g := range nGroups {
+			group := src[g*mhuffGroupSize : min((g+1)*mhuffGroupSize, len(src))]
+			best, bestCost := 0, -1
+			for t := range nTables {
+				cost := 0
+				for _, b := range group {
+					cost += int(lengths[t][b])
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = t, cost
+				}
+			}
+			selectors[g] = byte(best)
+			for _, b := range group {
+				tableFreqs[best][b]++
+			}
+		}
+		for t := range nTables {
+			for _, s := range used {
+				tableFreqs[t][s] = max(tableFreqs[t][s], 1) // every table codes every used symbol
+			}
+			lengths[t] = [256]uint8(buildCodeLengths(tableFreqs[t][:], maxHuffmanCodeLen))
+		}
+	}
+	out := binary.AppendUvarint(nil, uint64(len(src)))
+	var bitmap [32]byte
+	for _, s := range used {
+		bitmap[s/8] |= 0x80 >> (s % 8)
+	}
+	out = append(out, bitmap[:]...)
+	out = append(out, byte(nTables))
+	var (
+		outBuffer = bytes.NewBuffer(out)
+		bw        = bitio.NewBitWriter(outBuffer)
+		codes     = make([][]uint64, nTables)
+		order     = []byte{0, 1, 2, 3, 4, 5} // move-to-front order of the tables
+		err       error
+	)
+	for t := range nTables {
+		cur := lengths[t][used[0]]
+		err = bw.WriteBits(uint64(cur), 4)
+		for _, s := range used {
+			for ; err == nil && cur < lengths[t][s]; cur++ {
+				err = bw.WriteBits(0b10, 2)
+			}
+			for ; err == nil && cur > lengths[t][s]; cur-- {
+				err = bw.WriteBits(0b11, 2)
+			}
+			if err == nil {
+				err = bw.WriteBits(0, 1)
+			}
+		}
+		if err != nil {
+			return []byte{}, fmt.Errorf("error while writing multi-table huffman code lengths: %w", err)
+		}
+	}
+	for _, sel := range selectors {
+		v := bytes.IndexByte(order, sel)
+		copy(order[1:v+1], order[:v])
+		order[0] = sel
+		if err = bw.WriteBits(1<<(v+1)-2, v+1); err != nil { // v ones then a zero
+			return []byte{}, fmt.Errorf("error while writing multi-table huffman selectors: %w", err)
+		}
+	}
+	for t := range nTables {
+		codes[t] = getHuffmanCodesFromLengths(lengths[t][:])
+	}
+	for i, b := range src {
+		t := selectors[i/mhuffGroupSize]
+		if err = bw.WriteBits(codes[t][b], int(lengths[t][b])); err != nil {
+			return []byte{}, fmt.Errorf("error while writing multi-table huffman encoded bits: %w", err)
+		}
+	}
+	if _, err = bw.Flush(); err != nil {
+		return []byte{}, fmt.Errorf("error while flushing bitwriter during multi-table huffman encoding: %w", err)
+	}
+	return outBuffer.Bytes(), nil
+}
+
+func (MHUFFMANCodec) DecodeBlock(src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return src, nil
+	}
+	outLen, n := binary.Uvarint(src) // read the decoded length
+	if n <= 0 || n+33 > len(src) || outLen > 8*uint64(len(src)) {
+		return []byte{}, sqerr.New(sqerr.Corrupt, "invalid multi-table huffman header")
+	}
+	var (
+		used    []int // symbols present, in order
+		srcIdx  = n
+		nTables int
+	)
+	for s := range 256 {
+		if src[srcIdx+s/8]&(0x80>>(s%8)) != 0 {
+			used = append(used, s)
+		}
+	}
+	srcIdx += 32
+	nTables = int(src[srcIdx])
+	srcIdx++
+	if nTables == 0 || nTables > mhuffMaxTables || len(used) == 0 {
+		return []byte{}, sqerr.New(sqerr.Corrupt, "invalid multi-table huffman tables")
+	}
+	var (
+		r        = msbReader{src: src[srcIdx:]}
+		dataBits = 8 * (len(src) - srcIdx)
+		decoders = make([]*huffmanDecoder, nTables)
+	)
+	for t := range nTables {
+		var lengths [256]uint8
+		cur := int(r.peek() >> 60)
+		r.skip(4)
+		for _, s := range used {
+			for r.peek()>>63 == 1 { // step the length until the closing zero
+				cur += 1 - 2*int(r.peek()>>62&1)
+				r.skip(2)
+				if cur < 1 || cur > maxHuffmanCodeLen || r.consumed() > dataBits {
+					return []byte{}, sqerr.New(sqerr.Corrupt, "invalid multi-table huffman code length")
+				}
+			}
+			r.skip(1)
+			if cur == 0 {
+				return []byte{}, sqerr.New(sqerr.Corrupt, "missing multi-table huffman code length")
+			}
+			lengths[s] = uint8(cur)
+		}
+		hd, err := newHuffmanDecoder(lengths[:])
+		if err != nil {
+			return []byte{}, err
+		}
+		decoders[t] = hd
+	}
+	var (
+		nGroups   = (int(outLen) + mhuffGroupSize - 1) / mhuffGroupSize
+		selectors = make([]byte, nGroups)
+		order     = []byte{0, 1, 2, 3, 4, 5}
+		out       = make([]byte, 0, outLen)
+	)
+	for g := range nGroups {
+		v := 0
+		for r.peek()>>63 == 1 { // count the ones
+			r.skip(1)
+			v++
+			if v >= nTables || r.consumed() > dataBits {
+				return []byte{}, sqerr.New(sqerr.Corrupt, "invalid multi-table huffman selector")
+			}
+		}
+		r.skip(1) // and the closing zero
+		selectors[g] = order[v]
+		copy(order[1:v+1], order[:v])
+		order[0] = selectors[g]
+	}
+	for i := range int(outLen) {
+		symbol, n := decoders[selectors[i/mhuffGroupSize]].decodeSymbol(r.peek())
+		if n == 0 {
+			return []byte{}, sqerr.New(sqerr.Corrupt, "invalid multi-table huffman code")
+		}
+		out = append(out, byte(symbol))
+		r.skip(n)
+	}
+	if r.consumed() > dataBits {
+		return []byte{}, sqerr.New(sqerr.Corrupt, "multi-table huffman codes overrun the block")
+	}
+	return out, nil
+}
+
+func (MHUFFMANCodec) IsLossless() bool {
+	return true
+}
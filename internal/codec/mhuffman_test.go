@@ -0,0 +1,93 @@
+package codec
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func MHUFFMANEncodeDecode(message string, t *testing.T) {
+	mc := MHUFFMANCodec{}
+	coded, err := mc.EncodeBlock([]byte(message))
+	if err != nil {
+		t.Fatalf("MHUFFMAN encoding failed: %v", err)
+	}
+	decoded, err := mc.DecodeBlock(coded)
+	if err != nil {
+		t.Fatalf("MHUFFMAN decoding failed: %v", err)
+	}
+	if message != string(decoded) {
+		t.Fatalf("MHUFFMAN encoding mismatch: got %s - expected %s", string(decoded), message)
+	}
+}
+
+func TestMHUFFMANEncodeDecode(t *testing.T) {
+	message := "The mellow yellow fellow says hello world!"
+	MHUFFMANEncodeDecode(message, t)
+}
+
+func TestMHUFFMANRunLength(t *testing.T) {
+	MHUFFMANEncodeDecode(string(fibonacciMessage()), t)
+}
+
+func TestMHUFFMANEmptyMessage(t *testing.T) {
+	message := ""
+	MHUFFMANEncodeDecode(message, t)
+}
+
+func TestMHUFFMANSingleSymbol(t *testing.T) {
+	MHUFFMANEncodeDecode(strings.Repeat("a", 1000), t)
+}
+
+func TestMHUFFMANAllBytes(t *testing.T) {
+	message := make([]byte, 0, 256*3)
+	for i := range 256 * 3 {
+		message = append(message, byte(i*7))
+	}
+	MHUFFMANEncodeDecode(string(message), t)
+}
+
+func TestMHUFFMANLossless(t *testing.T) {
+	mc := MHUFFMANCodec{}
+	if !mc.IsLossless() {
+		t.Fatalf("MHUFFMAN is lossless, but returned lossy")
+	}
+}
+
+func TestMHUFFMANShiftingStatistics(t *testing.T) {
+	// halves drawn from different alphabets, one table can't suit both
+	rnd := rand.New(rand.NewSource(1))
+	message := make([]byte, 1<<15)
+	for i := range message {
+		if i < len(message)/2 {
+			message[i] = "abcd"[rnd.Intn(4)]
+		} else {
+			message[i] = "wxyz0123"[rnd.Intn(8)]
+		}
+	}
+	single, err := HUFFMANCodec{}.EncodeBlock(message)
+	if err != nil {
+		t.Fatalf("Huffman encoding failed: %v", err)
+	}
+	multi, err := MHUFFMANCodec{}.EncodeBlock(message)
+	if err != nil {
+		t.Fatalf("MHUFFMAN encoding failed: %v", err)
+	}
+	if len(multi) >= len(single)*9/10 {
+		t.Fatalf("MHUFFMAN (%d bytes) didn't beat a single table (%d bytes)", len(multi), len(single))
+	}
+	MHUFFMANEncodeDecode(string(message), t)
+}
+
+func TestMHUFFMANCorrupt(t *testing.T) {
+	coded, err := MHUFFMANCodec{}.EncodeBlock(bytes.Repeat([]byte("hello world "), 100))
+	if err != nil {
+		t.Fatalf("MHUFFMAN encoding failed: %v", err)
+	}
+	for i := 1; i < len(coded)-8; i++ { // the final bytes may only hold padding
+		if _, err := (MHUFFMANCodec{}).DecodeBlock(coded[:i]); err == nil {
+			t.Fatalf("MHUFFMAN decoded a truncated payload of %d bytes", i)
+		}
+	}
+}
@@ -1,57 +1,79 @@
 package codec
 
-import "container/list"
+import "bytes"
 
-type MTFCodec struct{}
+// move to front variants, deciding how far a coded byte moves up the table
+const (
+	mtfToFront      = iota // every byte moves to the front
+	mtfOneFromFront        // MTF-1: a byte moves to the front from rank 1, otherwise to rank 1
+	mtfTwoStep             // MTF-2: like MTF-1, but from rank 1 only when the previous rank wasn't 0
+)
 
-func getAlphabet() *list.List {
-	alphabet := list.New()
+// MTFCodec replaces each byte with its rank in a table of recently seen bytes,
+// turning the runs of a few symbols left by BWT into runs of small ranks. The
+// variants move bytes up more cautiously, which keeps a lone interruption from
+// pushing the dominant byte off the front.
+type MTFCodec struct {
+	variant int
+}
+
+// mtfTable returns the table every block starts from. Byte 255 comes last,
+// after 254 down to 0, as earlier versions started from 254 down to 0 and
+// left 255 out, so their streams without 255 decode the same.
+func mtfTable() [256]byte {
+	var table [256]byte
 	for i := range 255 {
-		alphabet.PushFront(byte(i))
+		table[i] = byte(254 - i)
 	}
-	return alphabet
+	table[255] = 255
+	return table
 }
 
-func mtf(src []byte, encode bool) ([]byte, error) {
-	if len(src) == 0 {
-		return src, nil
+// moveUp moves the byte at rank up the table as the variant says, given the
+// rank coded before it.
+func (c MTFCodec) moveUp(table *[256]byte, rank int, prevRank int) {
+	to := 0
+	switch {
+	case rank == 0:
+		return
+	case c.variant == mtfOneFromFront && rank > 1:
+		to = 1
+	case c.variant == mtfTwoStep && (rank > 1 || prevRank == 0):
+		to = 1
 	}
+	b := table[rank]
+	copy(table[to+1:rank+1], table[to:rank])
+	table[to] = b
+}
+
+func (c MTFCodec) EncodeBlock(src []byte) ([]byte, error) {
 	var (
-		srcIdx            = 0
-		index       uint8 = 0
-		alphabet          = getAlphabet()
-		comparison  byte
-		replacement byte
+		dst      = make([]byte, len(src))
+		table    = mtfTable()
+		prevRank = -1
 	)
-	for srcIdx < len(src) {
-		for e := alphabet.Front(); e != nil; e = e.Next() {
-			if encode {
-				comparison = e.Value.(byte)
-				replacement = index
-			} else {
-				comparison = index
-				replacement = e.Value.(byte)
-			}
-			if src[srcIdx] == comparison {
-				src[srcIdx] = replacement
-				alphabet.MoveToFront(e)
-				index = 0
-				break
-			} else {
-				index++
-			}
-		}
-		srcIdx++
+	for i, b := range src {
+		rank := bytes.IndexByte(table[:], b) // every byte is in the table
+		dst[i] = byte(rank)
+		c.moveUp(&table, rank, prevRank)
+		prevRank = rank
 	}
-	return src, nil
+	return dst, nil
 }
 
-func (MTFCodec) EncodeBlock(src []byte) ([]byte, error) {
-	return mtf(src, true)
-}
-
-func (MTFCodec) DecodeBlock(src []byte) ([]byte, error) {
-	return mtf(src, false)
+func (c MTFCodec) DecodeBlock(src []byte) ([]byte, error) {
+	var (
+		dst      = make([]byte, len(src))
+		table    = mtfTable()
+		prevRank = -1
+	)
+	for i, r := range src {
+		rank := int(r)
+		dst[i] = table[rank]
+		c.moveUp(&table, rank, prevRank)
+		prevRank = rank
+	}
+	return dst, nil
 }
 
 func (MTFCodec) IsLossless() bool {
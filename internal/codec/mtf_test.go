@@ -6,17 +6,19 @@ import (
 )
 
 func MTFEncodeDecode(message string, t *testing.T) {
-	lc := MTFCodec{}
-	coded, err := lc.EncodeBlock([]byte(message))
-	if err != nil {
-		t.Fatalf("MTF encoding failed: %v", err)
-	}
-	decoded, err := lc.DecodeBlock(coded)
-	if err != nil {
-		t.Fatalf("MTF decoding failed: %v", err)
-	}
-	if message != string(decoded) {
-		t.Fatalf("MTF encoding mismatch: got %s - expected %s", string(decoded), message)
+	for _, id := range []uint8{MTF, MTF1, MTF2} {
+		lc, _ := New(id)
+		coded, err := lc.EncodeBlock([]byte(message))
+		if err != nil {
+			t.Fatalf("%s encoding failed: %v", CodecName(id), err)
+		}
+		decoded, err := lc.DecodeBlock(coded)
+		if err != nil {
+			t.Fatalf("%s decoding failed: %v", CodecName(id), err)
+		}
+		if message != string(decoded) {
+			t.Fatalf("%s encoding mismatch: got %s - expected %s", CodecName(id), string(decoded), message)
+		}
 	}
 }
 
@@ -46,3 +48,42 @@ func TestMTFLossless(t *testing.T) {
 		t.Fatalf("MTF is lossless, but returned lossy")
 	}
 }
+
+func TestMTFAllBytes(t *testing.T) {
+	message := make([]byte, 0, 3*256)
+	for i := range 256 {
+		message = append(message, byte(i), 255, byte(255-i))
+	}
+	MTFEncodeDecode(string(message), t)
+}
+
+func TestMTFRanks(t *testing.T) {
+	// ranks from the table earlier versions started with, 254 down to 0
+	coded, _ := MTFCodec{}.EncodeBlock([]byte{254, 0, 0, 254, 255, 255, 1})
+	expected := []byte{0, 254, 0, 1, 255, 0, 255}
+	if !bytes.Equal(coded, expected) {
+		t.Fatalf("MTF ranks mismatch: got %v - expected %v", coded, expected)
+	}
+	// MTF-1 only moves to the front from rank 1, MTF-2 not right after a rank 0
+	message := []byte{'a', 'a', 'a', 254, 254}
+	for id, expected := range map[uint8][]byte{
+		MTF:  {157, 0, 0, 1, 0},
+		MTF1: {157, 1, 0, 1, 0},
+		MTF2: {157, 1, 0, 1, 1},
+	} {
+		lc, _ := New(id)
+		coded, _ := lc.EncodeBlock(message)
+		if !bytes.Equal(coded, expected) {
+			t.Fatalf("%s ranks mismatch: got %v - expected %v", CodecName(id), coded, expected)
+		}
+	}
+}
+
+func TestMTFLeavesInput(t *testing.T) {
+	message := []byte("banana bandana")
+	coded, _ := MTFCodec{}.EncodeBlock(message)
+	decoded, _ := MTFCodec{}.DecodeBlock(coded)
+	if string(message) != "banana bandana" || !bytes.Equal(decoded, message) {
+		t.Fatalf("MTF modified its input: got %q", message)
+	}
+}
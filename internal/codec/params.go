@@ -0,0 +1,150 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"slices"
+	"squish/internal/sqerr"
+	"strconv"
+	"strings"
+)
+
+// Params holds codec parameters by name, as written in a pipeline such as
+// "RLE(stride=3)-HUFFMAN".
+type Params map[string]int
+
+// Configurable is implemented by codecs whose behavior depends on parameters
+// beyond their ID. Parameters that differ from the registered codec's are
+// stored with the codec list of a stream, so it decodes without being told
+// them again.
+type Configurable interface {
+	// Params returns every parameter the codec takes with its current value.
+	Params() Params
+	// WithParams returns a copy of the codec with the given parameters set,
+	// rejecting unknown names and values out of range.
+	WithParams(p Params) (Codec, error)
+}
+
+// String formats the parameters as in a pipeline, e.g. "stride=3,tolmax=8".
+func (p Params) String() string {
+	fields := make([]string, 0, len(p))
+	for _, name := range slices.Sorted(maps.Keys(p)) {
+		fields = append(fields, fmt.Sprintf("%s=%d", name, p[name]))
+	}
+	return strings.Join(fields, ",")
+}
+
+// parseParams reads the inside of the parentheses in a pipeline, e.g. "stride=3".
+func parseParams(s string) (Params, error) {
+	p := Params{}
+	for _, field := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(field, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		v, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || name == "" || err != nil || v < 0 {
+			return nil, sqerr.New(sqerr.Usage, fmt.Sprintf("invalid codec parameter %q, expected name=number", field))
+		}
+		if _, ok := p[name]; ok {
+			return nil, sqerr.New(sqerr.Usage, fmt.Sprintf("codec parameter %s given twice", name))
+		}
+		p[name] = v
+	}
+	return p, nil
+}
+
+// MarshalParams serializes the parameters of c that differ from those of the
+// codec registered to id, as a sequence of
+//
+//	uvarint name length, name, uvarint value
+//
+// sorted by name. Codecs left at their registered parameters give nothing.
+func MarshalParams(id uint8, c Codec) []byte {
+	conf, ok := c.(Configurable)
+	if !ok {
+		return nil
+	}
+	var defaults Params
+	if def, ok := New(id); ok {
+		if defConf, ok := def.(Configurable); ok {
+			defaults = defConf.Params()
+		}
+	}
+	var (
+		p   = conf.Params()
+		out []byte
+	)
+	for _, name := range slices.Sorted(maps.Keys(p)) {
+		if v, ok := defaults[name]; ok && v == p[name] {
+			continue
+		}
+		out = binary.AppendUvarint(out, uint64(len(name)))
+		out = append(out, name...)
+		out = binary.AppendUvarint(out, uint64(p[name]))
+	}
+	return out
+}
+
+// UnmarshalParams reads parameters serialized by MarshalParams.
+func UnmarshalParams(b []byte) (Params, error) {
+	p := Params{}
+	for len(b) > 0 {
+		nameLen, n := binary.Uvarint(b)
+		if n <= 0 || nameLen == 0 || nameLen > uint64(len(b)-n) {
+			return nil, sqerr.New(sqerr.Corrupt, "invalid codec parameter name")
+		}
+		name := string(b[n : n+int(nameLen)])
+		b = b[n+int(nameLen):]
+		v, n := binary.Uvarint(b)
+		if n <= 0 || v > uint64(^uint32(0)) {
+			return nil, sqerr.New(sqerr.Corrupt, "invalid codec parameter value")
+		}
+		b = b[n:]
+		p[name] = int(v)
+	}
+	return p, nil
+}
+
+// Configure applies serialized parameters to a codec, as read from a stream.
+func Configure(c Codec, params []byte) (Codec, error) {
+	if len(params) == 0 {
+		return c, nil
+	}
+	conf, ok := c.(Configurable)
+	if !ok {
+		return nil, sqerr.New(sqerr.Corrupt, "parameters given to a codec that takes none")
+	}
+	p, err := UnmarshalParams(params)
+	if err != nil {
+		return nil, err
+	}
+	c, err = conf.WithParams(p)
+	if err != nil {
+		return nil, sqerr.New(sqerr.Corrupt, fmt.Sprintf("invalid codec parameters: %v", err))
+	}
+	return c, nil
+}
+
+// ParamsAt returns the parameters of the ith codec of a list, which may be
+// shorter than the list when the trailing codecs have none.
+func ParamsAt(params [][]byte, i int) []byte {
+	if i < len(params) {
+		return params[i]
+	}
+	return nil
+}
+
+// checkParams rejects names a codec doesn't take and values outside their
+// ranges. Every codec parameter is an integer, usually a size or count.
+func checkParams(name string, p Params, ranges map[string][2]int) error {
+	for k, v := range p {
+		r, ok := ranges[k]
+		if !ok {
+			return sqerr.New(sqerr.Usage, fmt.Sprintf("%s has no parameter %s", name, k))
+		}
+		if v < r[0] || v > r[1] {
+			return sqerr.New(sqerr.Usage, fmt.Sprintf("%s parameter %s must be from %d to %d", name, k, r[0], r[1]))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package codec
+
+import (
+	"bytes"
+	"squish/internal/sqerr"
+	"testing"
+)
+
+func TestParsePipelineParams(t *testing.T) {
+	codecIDs, params, err := ParsePipeline("lrle2(TolMax=9, stride=3)-LZ77(windowlog=16)-huffman")
+	if err != nil {
+		t.Fatalf("Failed to parse pipeline: %v", err)
+	}
+	if len(codecIDs) != 3 || codecIDs[0] != LRLE2 || len(params) != 3 || params[2] != nil {
+		t.Fatalf("Pipeline parsed as %v %v", codecIDs, params)
+	}
+	if s := PipelineString(codecIDs, params); s != "LRLE2(stride=3,tolmax=9)-LZ77(windowlog=16)-HUFFMAN" {
+		t.Fatalf("Pipeline formatted as %s", s)
+	}
+	// parameters left at the registered codec's values are not stored
+	codecIDs, params, err = ParsePipeline("RLE2(stride=2)-LZ77(windowlog=24)-LZSS(windowlog=12)")
+	if err != nil || params != nil || PipelineString(codecIDs, params) != "RLE2-LZ77-LZSS" {
+		t.Fatalf("Default parameters parsed as %v: %v", params, err)
+	}
+	if _, params, _ = ParsePipeline("DEFLATE"); params != nil {
+		t.Fatalf("Pipeline without parameters parsed as %v", params)
+	}
+	for _, pipeline := range []string{
+		"HUFFMAN(stride=2)",      // takes no parameters
+		"RLE(tolmax=3)",          // only lossy RLE has tolerances
+		"RLE(stride=0)",          // out of range
+		"RLE(stride=-1)",         // negative
+		"RLE(stride)",            // no value
+		"RLE(stride=2",           // unclosed
+		"RLE(stride=2,stride=3)", // twice
+		"LZ77(windowlog=25)",     // out of range
+		"LZSS(windowlog=15)",     // out of range
+		"LRLE(tolmin=8,tolmax=4)",
+	} {
+		if _, _, err = ParsePipeline(pipeline); sqerr.ErrorCode(err) != sqerr.Usage {
+			t.Fatalf("Pipeline %s was not rejected: %v", pipeline, err)
+		}
+	}
+}
+
+func TestParamsMatchIDs(t *testing.T) {
+	message := []byte("aaabbbaaabbbcccdddcccddd1234567812345678")
+	for id, pipeline := range map[uint8]string{RLE3: "RLE(stride=3)", LRLE4: "LRLE(stride=4)", LZ77: "LZ77(windowlog=24)"} {
+		codecIDs, params, err := ParsePipeline(pipeline)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", pipeline, err)
+		}
+		configured, err := NewEncoder(codecIDs[0], ParamsAt(params, 0), DefaultLevel)
+		if err != nil {
+			t.Fatalf("Failed to configure %s: %v", pipeline, err)
+		}
+		c, _ := New(id)
+		expected, _ := c.EncodeBlock(message)
+		coded, _ := configured.EncodeBlock(message)
+		if !bytes.Equal(coded, expected) {
+			t.Fatalf("%s does not encode as %s", pipeline, CodecName(id))
+		}
+	}
+}
+
+func TestConfigureCorrupt(t *testing.T) {
+	_, params, _ := ParsePipeline("RLE(stride=3)")
+	if _, err := Configure(HUFFMANCodec{}, params[0]); sqerr.ErrorCode(err) != sqerr.Corrupt {
+		t.Fatalf("Parameters for a codec taking none were not rejected: %v", err)
+	}
+	for i := range params[0] {
+		if _, err := Configure(RLECodec{byteLength: 1, lossless: true}, params[0][:i]); i > 0 && err == nil {
+			t.Fatalf("Truncated parameters were not rejected at %d bytes", i)
+		}
+	}
+	bad := MarshalParams(RLE, RLECodec{byteLength: 99, lossless: true}) // out of range once read back
+	if _, err := Configure(RLECodec{byteLength: 1, lossless: true}, bad); sqerr.ErrorCode(err) != sqerr.Corrupt {
+		t.Fatalf("Out of range parameters were not rejected: %v", err)
+	}
+}
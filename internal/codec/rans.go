@@ -0,0 +1,202 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"squish/internal/sqerr"
+)
+
+const (
+	ransScaleBits        = 12                 // normalized frequencies sum to 1 << ransScaleBits
+	ransScale            = 1 << ransScaleBits // total of the normalized frequencies
+	ransLow       uint32 = 1 << 23            // lower bound of the normalized state interval
+	ransStates           = 2                  // interleaved states, symbol i uses state i % ransStates
+)
+
+type RANSCodec struct{}
+
+type ransTable struct {
+	freq  [256]uint32     // normalized frequency of every symbol
+	start [256]uint32     // cumulative frequency before every symbol
+	slot  [ransScale]byte // symbol owning every slot of the scale, used for decoding
+}
+
+func normalizeFrequencies(freqMap *[256]int, total int) *[256]uint32 {
+	var (
+		freqs   = [256]uint32{}
+		sum     = 0
+		largest = 0
+	)
+	for i := range len(freqMap) {
+		if freqMap[i] == 0 {
+			continue
+		}
+		freqs[i] = uint32(max(1, freqMap[i]*ransScale/total)) // scale down, never dropping a symbol
+		sum += int(freqs[i])
+		if freqs[i] > freqs[largest] {
+			largest = i
+		}
+	}
+	if sum < ransScale {
+		freqs[largest] += uint32(ransScale - sum) // give the rounding slack to the most common symbol
+	}
+	for sum > ransScale { // or take the excess from the most common symbols
+		for i := range len(freqs) {
+			if freqs[i] > freqs[largest] {
+				largest = i
+			}
+		}
+		take := min(sum-ransScale, int(freqs[largest])/2)
+		freqs[largest] -= uint32(take)
+		sum -= take
+	}
+	return &freqs
+}
+
+func newRansTable(freqs *[256]uint32) (*ransTable, error) {
+	t := &ransTable{freq: *freqs}
+	cum := uint32(0)
+	for i := range len(freqs) {
+		t.start[i] = cum
+		if cum+freqs[i] > ransScale {
+			return nil, sqerr.New(sqerr.Corrupt, "rANS frequencies exceed the scale")
+		}
+		for s := cum; s < cum+freqs[i]; s++ {
+			t.slot[s] = byte(i)
+		}
+		cum += freqs[i]
+	}
+	if cum != ransScale {
+		return nil, sqerr.New(sqerr.Corrupt, "rANS frequencies do not fill the scale")
+	}
+	return t, nil
+}
+
+func serializeRansFrequencies(freqs *[256]uint32) []byte {
+	// only the symbols present are stored as (symbol, uvarint frequency) pairs
+	out := []byte{0x00} // placeholder for the number of symbols - 1
+	symbols := 0
+	for i := range len(freqs) {
+		if freqs[i] > 0 {
+			out = append(out, byte(i))
+			out = binary.AppendUvarint(out, uint64(freqs[i]))
+			symbols++
+		}
+	}
+	out[0] = byte(symbols - 1)
+	return out
+}
+
+func deserializeRansFrequencies(src []byte) (*[256]uint32, int, error) {
+	var (
+		freqs  = [256]uint32{}
+		srcIdx = 1
+	)
+	if len(src) == 0 {
+		return &freqs, 0, sqerr.New(sqerr.Corrupt, "missing rANS frequency table")
+	}
+	for range int(src[0]) + 1 {
+		if srcIdx >= len(src) {
+			return &freqs, 0, sqerr.New(sqerr.Corrupt, "truncated rANS frequency table")
+		}
+		symbol := src[srcIdx]
+		freq, n := binary.Uvarint(src[srcIdx+1:])
+		if n <= 0 || freq == 0 || freq > ransScale {
+			return &freqs, 0, sqerr.New(sqerr.Corrupt, "invalid rANS frequency")
+		}
+		freqs[symbol] = uint32(freq)
+		srcIdx += 1 + n
+	}
+	return &freqs, srcIdx, nil
+}
+
+func (RANSCodec) EncodeBlock(src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return src, nil
+	}
+	freqs := normalizeFrequencies(getFrequencyMap(src), len(src))
+	t, err := newRansTable(freqs)
+	if err != nil {
+		return []byte{}, fmt.Errorf("error while building rANS table: %w", err)
+	}
+	var (
+		states = [ransStates]uint32{ransLow, ransLow}
+		rev    = make([]byte, 0, len(src)+8) // output built back to front
+		x      uint32
+		xMax   uint32
+		s      byte
+	)
+	for i := len(src) - 1; i >= 0; i-- { // rANS encodes in reverse so decoding runs forwards
+		s = src[i]
+		x = states[i%ransStates]
+		xMax = ((ransLow >> ransScaleBits) << 8) * t.freq[s]
+		for x >= xMax { // renormalize so the state stays in range after encoding
+			rev = append(rev, byte(x))
+			x >>= 8
+		}
+		states[i%ransStates] = ((x / t.freq[s]) << ransScaleBits) + (x % t.freq[s]) + t.start[s]
+	}
+	for i := ransStates - 1; i >= 0; i-- { // flush the states so state 0 is read first
+		x = states[i]
+		rev = append(rev, byte(x>>24), byte(x>>16), byte(x>>8), byte(x))
+	}
+	out := binary.AppendUvarint(make([]byte, 0, len(rev)+300), uint64(len(src))) // store the decoded length
+	out = append(out, serializeRansFrequencies(freqs)...)
+	for i := len(rev) - 1; i >= 0; i-- {
+		out = append(out, rev[i])
+	}
+	return out, nil
+}
+
+func (RANSCodec) DecodeBlock(src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return src, nil
+	}
+	// read the decoded length, a lone symbol costs no bits so any length fits a short payload
+	outLen, n := binary.Uvarint(src)
+	if n <= 0 || outLen > maxBlockSize {
+		return []byte{}, sqerr.New(sqerr.Corrupt, "invalid rANS coded length")
+	}
+	freqs, tableLen, err := deserializeRansFrequencies(src[n:])
+	if err != nil {
+		return []byte{}, err
+	}
+	t, err := newRansTable(freqs)
+	if err != nil {
+		return []byte{}, err
+	}
+	src = src[n+tableLen:]
+	if len(src) < 4*ransStates {
+		return []byte{}, sqerr.New(sqerr.Corrupt, "truncated rANS states")
+	}
+	var (
+		states = [ransStates]uint32{}
+		srcIdx = 0
+		out    = make([]byte, outLen)
+		x      uint32
+		s      byte
+	)
+	for i := range ransStates {
+		states[i] = binary.LittleEndian.Uint32(src[srcIdx:])
+		srcIdx += 4
+	}
+	for i := range len(out) {
+		x = states[i%ransStates]
+		s = t.slot[x&(ransScale-1)] // the low bits of the state pick the symbol
+		out[i] = s
+		x = t.freq[s]*(x>>ransScaleBits) + (x & (ransScale - 1)) - t.start[s]
+		for x < ransLow { // renormalize by pulling in bytes
+			if srcIdx >= len(src) {
+				return []byte{}, sqerr.New(sqerr.Corrupt, "rANS coded data ended early")
+			}
+			x = x<<8 | uint32(src[srcIdx])
+			srcIdx++
+		}
+		states[i%ransStates] = x
+	}
+	return out, nil
+}
+
+func (RANSCodec) IsLossless() bool {
+	return true
+}
@@ -0,0 +1,111 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func RANSEncodeDecode(message string, t *testing.T) {
+	rc := RANSCodec{}
+	coded, err := rc.EncodeBlock([]byte(message))
+	if err != nil {
+		t.Fatalf("RANS encoding failed: %v", err)
+	}
+	decoded, err := rc.DecodeBlock(coded)
+	if err != nil {
+		t.Fatalf("RANS decoding failed: %v", err)
+	}
+	if message != string(decoded) {
+		t.Fatalf("RANS encoding mismatch: got %s - expected %s", string(decoded), message)
+	}
+}
+
+func TestRANSEncodeDecode(t *testing.T) {
+	message := "The mellow yellow fellow says hello world!"
+	RANSEncodeDecode(message, t)
+}
+
+func TestRANSRunLength(t *testing.T) {
+	message := []byte{0, 1}
+	a, b := 1, 1
+	for i := range 30 {
+		a, b = b, a+b
+		message = append(message, bytes.Repeat([]byte{byte(i)}, b)...)
+	}
+	RANSEncodeDecode(string(message), t)
+}
+
+func TestRANSAllBytes(t *testing.T) {
+	message := make([]byte, 0, 256*3)
+	for i := range 256 * 3 {
+		message = append(message, byte(i*7))
+	}
+	RANSEncodeDecode(string(message), t)
+}
+
+func TestRANSSkewed(t *testing.T) {
+	message := bytes.Repeat([]byte{0}, 100000)
+	message[500] = 1
+	message[90000] = 0xFF
+	rc := RANSCodec{}
+	coded, err := rc.EncodeBlock(message)
+	if err != nil {
+		t.Fatalf("RANS encoding failed: %v", err)
+	}
+	if len(coded) > len(message)/8 {
+		t.Fatalf("RANS failed to compress skewed data: %d bytes", len(coded))
+	}
+	RANSEncodeDecode(string(message), t)
+}
+
+func TestRANSTruncated(t *testing.T) {
+	rc := RANSCodec{}
+	coded, err := rc.EncodeBlock([]byte("The mellow yellow fellow says hello world!"))
+	if err != nil {
+		t.Fatalf("RANS encoding failed: %v", err)
+	}
+	_, err = rc.DecodeBlock(coded[:len(coded)/2])
+	if err == nil {
+		t.Fatalf("Missed truncated input")
+	}
+}
+
+func TestRANSEmptyMessage(t *testing.T) {
+	message := ""
+	RANSEncodeDecode(message, t)
+}
+
+func TestRANSLossless(t *testing.T) {
+	rc := RANSCodec{}
+	if !rc.IsLossless() {
+		t.Fatalf("RANS is lossless, but returned lossy")
+	}
+}
+
+func TestRANSSingleSymbol(t *testing.T) {
+	RANSEncodeDecode(string(bytes.Repeat([]byte{'a'}, 1000)), t)
+	RANSEncodeDecode(string(make([]byte, 1<<20)), t) // about 15 bytes of payload, whatever the length
+	RANSEncodeDecode("a", t)
+}
+
+func TestRANSNormalizeManySymbols(t *testing.T) {
+	freqMap := [256]int{}
+	total := 0
+	for i := range len(freqMap) {
+		freqMap[i] = 1
+		total++
+	}
+	freqMap[7] = 1 << 20
+	total += 1 << 20
+	freqs := normalizeFrequencies(&freqMap, total)
+	sum := uint32(0)
+	for i := range len(freqs) {
+		if freqs[i] == 0 {
+			t.Fatalf("Normalization dropped symbol %d", i)
+		}
+		sum += freqs[i]
+	}
+	if sum != ransScale {
+		t.Fatalf("Normalized frequencies sum to %d, expected %d", sum, ransScale)
+	}
+}
@@ -0,0 +1,146 @@
+package codec
+
+import (
+	"fmt"
+	"slices"
+	"squish/internal/sqerr"
+	"strings"
+	"sync"
+)
+
+// Codec IDs from FirstUserCodec to LastUserCodec are reserved for codecs
+// registered by applications, built-in codecs never take them.
+const (
+	FirstUserCodec = 0xC0
+	LastUserCodec  = 0xFF
+)
+
+// Factory returns a codec ready to encode or decode one block. It is called for
+// every block, so codecs that keep state while encoding start afresh.
+type Factory func() Codec
+
+// Properties describe a registered codec.
+type Properties struct {
+	Lossless    bool   // whether decoding gives back exactly the encoded bytes, must match the codec's IsLossless
+	Description string // one line summary shown by squish enc -list-codecs
+}
+
+// Registration is a codec as it was registered.
+type Registration struct {
+	ID   uint8
+	Name string
+	Properties
+	factory Factory
+}
+
+// registry is the single source of codec IDs, names and properties
+var registry = struct {
+	sync.RWMutex
+	byID   map[uint8]Registration
+	byName map[string]uint8
+}{
+	byID:   map[uint8]Registration{},
+	byName: map[string]uint8{},
+}
+
+// Register adds a codec under an ID from FirstUserCodec to LastUserCodec and a
+// name to use in pipelines, so streams can carry codecs squish doesn't ship.
+// Names are case insensitive and made of letters, digits and underscores,
+// starting with a letter. IDs and names already taken, by a built-in codec,
+// an alias or an earlier registration, are rejected. Streams using the codec
+// only decode where it is registered under the same ID.
+func Register(id uint8, name string, factory Factory, props Properties) error {
+	if id < FirstUserCodec {
+		return sqerr.New(sqerr.Usage, fmt.Sprintf("codec ID %d is reserved for built-in codecs, use %d to %d", id, FirstUserCodec, LastUserCodec))
+	}
+	return register(id, name, factory, props)
+}
+
+func register(id uint8, name string, factory Factory, props Properties) error {
+	name = strings.ToUpper(name)
+	if !validCodecName(name) {
+		return sqerr.New(sqerr.Usage, fmt.Sprintf("invalid codec name %q", name))
+	}
+	if factory == nil {
+		return sqerr.New(sqerr.Usage, fmt.Sprintf("codec %s has no factory", name))
+	}
+	if factory().IsLossless() != props.Lossless {
+		return sqerr.New(sqerr.Usage, fmt.Sprintf("codec %s is registered with Lossless %t but its IsLossless disagrees", name, props.Lossless))
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if r, ok := registry.byID[id]; ok {
+		return sqerr.New(sqerr.Usage, fmt.Sprintf("codec ID %d is already registered to %s", id, r.Name))
+	}
+	if _, ok := registry.byName[name]; ok {
+		return sqerr.New(sqerr.Usage, fmt.Sprintf("codec name %s is already registered", name))
+	}
+	if _, ok := CodecAliases[name]; ok {
+		return sqerr.New(sqerr.Usage, fmt.Sprintf("codec name %s is already an alias", name))
+	}
+	registry.byID[id] = Registration{ID: id, Name: name, Properties: props, factory: factory}
+	registry.byName[name] = id
+	return nil
+}
+
+// mustRegister registers a built-in codec, which can only fail on a typo.
+func mustRegister(id uint8, name string, factory Factory, props Properties) {
+	if err := register(id, name, factory, props); err != nil {
+		panic(err)
+	}
+}
+
+func validCodecName(name string) bool {
+	for i, r := range name {
+		letter := r >= 'A' && r <= 'Z'
+		if !letter && (i == 0 || !(r >= '0' && r <= '9' || r == '_')) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// New returns a new codec for the ID, or false if no codec is registered to it.
+func New(id uint8) (Codec, bool) {
+	r, ok := Lookup(id)
+	if !ok {
+		return nil, false
+	}
+	return r.New(), true
+}
+
+// New returns a new codec of the registered kind.
+func (r Registration) New() Codec {
+	return r.factory()
+}
+
+// Lookup returns the registration of the codec ID.
+func Lookup(id uint8) (Registration, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	r, ok := registry.byID[id]
+	return r, ok
+}
+
+// CodecID returns the ID registered to a codec name, ignoring case. Aliases
+// are not expanded.
+func CodecID(name string) (uint8, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	id, ok := registry.byName[strings.ToUpper(name)]
+	return id, ok
+}
+
+// Registered returns every registered codec in ID order.
+func Registered() []Registration {
+	registry.RLock()
+	defer registry.RUnlock()
+	regs := make([]Registration, 0, len(registry.byID))
+	for _, r := range registry.byID {
+		regs = append(regs, r)
+	}
+	slices.SortFunc(regs, func(a, b Registration) int {
+		return int(a.ID) - int(b.ID)
+	})
+	return regs
+}
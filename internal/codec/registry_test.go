@@ -0,0 +1,105 @@
+package codec
+
+import (
+	"bytes"
+	"squish/internal/sqerr"
+	"testing"
+)
+
+type reverseCodec struct{}
+
+func (reverseCodec) EncodeBlock(src []byte) ([]byte, error) {
+	dst := bytes.Clone(src)
+	for i, j := 0, len(dst)-1; i < j; i, j = i+1, j-1 {
+		dst[i], dst[j] = dst[j], dst[i]
+	}
+	return dst, nil
+}
+
+func (c reverseCodec) DecodeBlock(src []byte) ([]byte, error) {
+	return c.EncodeBlock(src)
+}
+
+func (reverseCodec) IsLossless() bool {
+	return true
+}
+
+func newReverseCodec() Codec {
+	return reverseCodec{}
+}
+
+// unregisterAfter drops a test's registration when it ends, so tests can repeat.
+func unregisterAfter(t *testing.T, id uint8) {
+	t.Cleanup(func() {
+		registry.Lock()
+		defer registry.Unlock()
+		delete(registry.byName, registry.byID[id].Name)
+		delete(registry.byID, id)
+	})
+}
+
+func TestRegister(t *testing.T) {
+	unregisterAfter(t, FirstUserCodec)
+	err := Register(FirstUserCodec, "Reverse", newReverseCodec, Properties{Lossless: true, Description: "reverses blocks"})
+	if err != nil {
+		t.Fatalf("Failed to register codec: %v", err)
+	}
+	codecIDs, _, err := ParsePipeline("reverse-huffman")
+	if err != nil {
+		t.Fatalf("Failed to parse pipeline with registered codec: %v", err)
+	}
+	if len(codecIDs) != 2 || codecIDs[0] != FirstUserCodec || PipelineString(codecIDs, nil) != "REVERSE-HUFFMAN" {
+		t.Fatalf("Registered codec parsed as %v", codecIDs)
+	}
+	r, ok := Lookup(FirstUserCodec)
+	if !ok || !r.Lossless || r.Description != "reverses blocks" {
+		t.Fatalf("Registered codec looked up as %+v", r)
+	}
+	c, _ := New(FirstUserCodec)
+	coded, _ := c.EncodeBlock([]byte("abc"))
+	if string(coded) != "cba" {
+		t.Fatalf("Registered codec encoded to %q", coded)
+	}
+	regs := Registered()
+	if regs[len(regs)-1].ID != FirstUserCodec || regs[0].ID != RAW {
+		t.Fatalf("Registered codecs are not in ID order")
+	}
+}
+
+func TestRegisterRejects(t *testing.T) {
+	lossless := Properties{Lossless: true}
+	for name, err := range map[string]error{
+		"built-in ID":    Register(LZH, "OTHER", newReverseCodec, lossless),
+		"taken name":     Register(FirstUserCodec+2, "huffman", newReverseCodec, lossless),
+		"alias name":     Register(FirstUserCodec+2, "DEFLATE", newReverseCodec, lossless),
+		"pipeline name":  Register(FirstUserCodec+2, "RLE-HUFFMAN", newReverseCodec, lossless),
+		"empty name":     Register(FirstUserCodec+2, "", newReverseCodec, lossless),
+		"digit name":     Register(FirstUserCodec+2, "2X", newReverseCodec, lossless),
+		"no factory":     Register(FirstUserCodec+2, "NONE", nil, lossless),
+		"wrong lossless": Register(FirstUserCodec+2, "LOSSY", newReverseCodec, Properties{Lossless: false}),
+	} {
+		if sqerr.ErrorCode(err) != sqerr.Usage {
+			t.Fatalf("Registering with a %s was not rejected: %v", name, err)
+		}
+	}
+	unregisterAfter(t, LastUserCodec)
+	if err := Register(LastUserCodec, "TWO", newReverseCodec, lossless); err != nil {
+		t.Fatalf("Failed to register codec: %v", err)
+	}
+	if err := Register(LastUserCodec, "THREE", newReverseCodec, lossless); sqerr.ErrorCode(err) != sqerr.Usage {
+		t.Fatalf("Registering with a taken ID was not rejected: %v", err)
+	}
+	if _, ok := CodecID("THREE"); ok {
+		t.Fatalf("Rejected codec was registered")
+	}
+}
+
+func TestParsePipelineAliases(t *testing.T) {
+	codecIDs, _, err := ParsePipeline("rle-deflate")
+	if err != nil || PipelineString(codecIDs, nil) != "RLE-LZH" {
+		t.Fatalf("Alias expanded to %v: %v", codecIDs, err)
+	}
+	if _, _, err = ParsePipeline("DEFLATEX"); sqerr.ErrorCode(err) != sqerr.Unsupported {
+		t.Fatalf("Alias expanded inside a codec name: %v", err)
+	}
+}
@@ -1,5 +1,7 @@
 package codec
 
+import "squish/internal/sqerr"
+
 const (
 	maxRunLength uint8   = 255
 	tolAlpha     float64 = 0.15 // tolerance sigma decay
@@ -8,14 +10,66 @@ const (
 	tolK         float64 = 1.5  // variance to tolerance factor
 	tolBand      uint8   = 1    // wiggle allowance when considering new anchor candidate
 	tolHang      uint8   = 3    // required repetitions for candidate to become new anchor
+	rleMaxStride         = 64   // widest value a run can repeat
 )
 
 type RLECodec struct {
 	byteLength int
 	lossless   bool
+	tolMin     int // lossy residual always conforming to the anchor, zero uses tolMin
+	tolMax     int // lossy residual always starting a new anchor, zero uses tolMax
+}
+
+func (RC RLECodec) getTolerances() (float64, float64) {
+	lo, hi := tolMin, tolMax
+	if RC.tolMin > 0 {
+		lo = float64(RC.tolMin)
+	}
+	if RC.tolMax > 0 {
+		hi = float64(RC.tolMax)
+	}
+	return lo, hi
+}
+
+// Params returns the stride, the byte width of repeated values, and for lossy
+// RLE the tolerance limits.
+func (RC RLECodec) Params() Params {
+	p := Params{"stride": RC.byteLength}
+	if !RC.lossless {
+		lo, hi := RC.getTolerances()
+		p["tolmin"], p["tolmax"] = int(lo), int(hi)
+	}
+	return p
+}
+
+func (RC RLECodec) WithParams(p Params) (Codec, error) {
+	name, ranges := "RLE", map[string][2]int{"stride": {1, rleMaxStride}}
+	if !RC.lossless {
+		name = "LRLE"
+		ranges["tolmin"] = [2]int{1, 255}
+		ranges["tolmax"] = [2]int{1, 255}
+	}
+	if err := checkParams(name, p, ranges); err != nil {
+		return nil, err
+	}
+	if v, ok := p["stride"]; ok {
+		RC.byteLength = v
+	}
+	if v, ok := p["tolmin"]; ok {
+		RC.tolMin = v
+	}
+	if v, ok := p["tolmax"]; ok {
+		RC.tolMax = v
+	}
+	if lo, hi := RC.getTolerances(); lo > hi {
+		return nil, sqerr.New(sqerr.Usage, "LRLE parameter tolmin must not be above tolmax")
+	}
+	return RC, nil
 }
 
 type RLTolerance struct {
+	min       float64 // residual that will always result in conforming to anchor
+	max       float64 // residual that will always result in a new anchor
 	anchor    []byte
 	sigma     []float64
 	tolerance []float64
@@ -54,8 +108,10 @@ func clampFloat(f, lo, hi float64) float64 {
 	return min(f, hi)
 }
 
-func newTolerance(n int) *RLTolerance {
+func newTolerance(n int, lo, hi float64) *RLTolerance {
 	return &RLTolerance{
+		min:       lo,
+		max:       hi,
 		anchor:    make([]byte, n),
 		sigma:     make([]float64, n),
 		tolerance: make([]float64, n),
@@ -72,8 +128,8 @@ func (t *RLTolerance) updateTolerance(data []byte) {
 	for i := range len(t.tolerance) { // loop through the bytes
 		res = absByteDiff(t.anchor[i], data[i])                      // get a residual of new data
 		t.sigma[i] = (1-tolAlpha)*t.sigma[i] + tolAlpha*float64(res) // calculate sigma
-		tol = tolMin + tolK*t.sigma[i]                               // calculate the new tolerance
-		t.tolerance[i] = clampFloat(tol, tolMin, tolMax)             // clamp it
+		tol = t.min + tolK*t.sigma[i]                                // calculate the new tolerance
+		t.tolerance[i] = clampFloat(tol, t.min, t.max)               // clamp it
 		if float64(res) <= t.tolerance[i] {
 			if absByteDiff(t.candidate[i], data[i]) <= tolBand { // if candidate residual is in valid band
 				t.count[i]++ // keep track of repeats of new candidate anchor
@@ -90,7 +146,7 @@ func (t *RLTolerance) updateTolerance(data []byte) {
 			t.sigma[i] = 0        // pick the new anchor and reset everything
 			t.candidate[i] = data[i]
 			t.count[i] = 0
-			t.tolerance[i] = tolMin
+			t.tolerance[i] = t.min
 		}
 	}
 }
@@ -109,6 +165,7 @@ func (RC RLECodec) EncodeBlock(src []byte) ([]byte, error) {
 	if len(src) == 0 {
 		return src, nil
 	}
+	lo, hi := RC.getTolerances()
 	var (
 		flagBit    uint8        = 7                                    // current bit representing a pair or not
 		flagByte   byte         = 0x00                                 // byte holding flag bits
@@ -117,7 +174,7 @@ func (RC RLECodec) EncodeBlock(src []byte) ([]byte, error) {
 		groupBytes []byte       = make([]byte, 0, 8*(RC.byteLength+1)) // current set of encoded bytes
 		srcIdx     int          = 0                                    // index as you traverse the source
 		srcBytes   []byte       = nil                                  // current bytes from the source
-		tolerance  *RLTolerance = newTolerance(RC.byteLength)          // noise and tolerance calculations
+		tolerance  *RLTolerance = newTolerance(RC.byteLength, lo, hi)  // noise and tolerance calculations
 		outBytes   []byte       = make([]byte, 0, len(src)*9/8)        // encoded bytes
 	)
 	for srcIdx < len(src) {
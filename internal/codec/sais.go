@@ -0,0 +1,149 @@
+package codec
+
+// suffixArray builds the suffix array of t with SA-IS (Nong, Zhang and Chan),
+// in time and space linear in len(t). Every symbol must be below k and t must
+// end with a unique smallest symbol, the sentinel, so that each suffix sorts
+// apart from the others.
+//
+// Suffixes are typed S when smaller than the suffix after them and L when
+// larger, an S suffix right after an L one being leftmost S (LMS). Sorting the
+// LMS suffixes is enough to induce the order of all the others, and sorting
+// them is a suffix array problem on a string of at most half the length, one
+// symbol per LMS substring, solved recursively when those symbols repeat.
+func suffixArray(t []int32, sa []int32, k int) {
+	n := len(t)
+	stype := make([]bool, n) // whether each suffix is S type
+	stype[n-1] = true        // the sentinel
+	for i := n - 2; i >= 0; i-- {
+		stype[i] = t[i] < t[i+1] || (t[i] == t[i+1] && stype[i+1])
+	}
+	isLMS := func(i int32) bool {
+		return i > 0 && stype[i] && !stype[i-1]
+	}
+	bucket := make([]int32, k) // next free slot in each symbol's bucket
+	// sort the LMS substrings by placing the LMS suffixes at their bucket ends
+	// in any order and inducing from them
+	for i := range sa {
+		sa[i] = -1
+	}
+	bucketEnds(t, bucket)
+	for i := int32(n) - 1; i > 0; i-- {
+		if isLMS(i) {
+			bucket[t[i]]--
+			sa[bucket[t[i]]] = i
+		}
+	}
+	induceSort(t, sa, stype, bucket)
+	m := 0 // number of LMS suffixes, gathered at the front in sorted order
+	for i := range n {
+		if isLMS(sa[i]) {
+			sa[m] = sa[i]
+			m++
+		}
+	}
+	for i := m; i < n; i++ {
+		sa[i] = -1
+	}
+	// name the LMS substrings by rank, equal substrings sharing a name, and
+	// park the names in the free back half indexed by position/2 (LMS
+	// positions are at least two apart)
+	names, prev := 0, int32(-1)
+	for i := range m {
+		pos, diff := sa[i], false
+		for d := int32(0); ; d++ {
+			if prev < 0 || t[pos+d] != t[prev+d] || stype[pos+d] != stype[prev+d] {
+				diff = true
+				break
+			}
+			if d > 0 && (isLMS(pos+d) || isLMS(prev+d)) { // both substrings ended together
+				break
+			}
+		}
+		if diff {
+			names++
+			prev = pos
+		}
+		sa[m+int(pos)/2] = int32(names - 1)
+	}
+	j := n - 1
+	for i := n - 1; i >= m; i-- { // pack the names to the back in text order
+		if sa[i] >= 0 {
+			sa[j] = sa[i]
+			j--
+		}
+	}
+	// sort the reduced string, directly when its symbols are all distinct
+	s1, sa1 := sa[n-m:], sa[:m]
+	if names < m {
+		suffixArray(s1, sa1, names)
+	} else {
+		for i := range m {
+			sa1[s1[i]] = int32(i)
+		}
+	}
+	// put the LMS suffixes in that order at their bucket ends and induce the rest
+	j = 0
+	for i := int32(1); i < int32(n); i++ {
+		if isLMS(i) {
+			s1[j] = i // reduced string position j is text position i
+			j++
+		}
+	}
+	for i := range m {
+		sa1[i] = s1[sa1[i]]
+	}
+	for i := m; i < n; i++ {
+		sa[i] = -1
+	}
+	bucketEnds(t, bucket)
+	for i := m - 1; i >= 0; i-- {
+		pos := sa[i]
+		sa[i] = -1
+		bucket[t[pos]]--
+		sa[bucket[t[pos]]] = pos
+	}
+	induceSort(t, sa, stype, bucket)
+}
+
+// bucketEnds sets each symbol's bucket to the slot after its last suffix.
+func bucketEnds(t []int32, bucket []int32) {
+	for i := range bucket {
+		bucket[i] = 0
+	}
+	for _, c := range t {
+		bucket[c]++
+	}
+	var sum int32
+	for i := range bucket {
+		sum += bucket[i]
+		bucket[i] = sum
+	}
+}
+
+// bucketStarts sets each symbol's bucket to the slot of its first suffix.
+func bucketStarts(t []int32, bucket []int32) {
+	bucketEnds(t, bucket)
+	for i := len(bucket) - 1; i > 0; i-- {
+		bucket[i] = bucket[i-1]
+	}
+	bucket[0] = 0
+}
+
+// induceSort places the L suffixes left to right from the sorted suffixes
+// already in sa, then the S suffixes right to left from those.
+func induceSort(t []int32, sa []int32, stype []bool, bucket []int32) {
+	bucketStarts(t, bucket)
+	for i := range len(sa) {
+		if j := sa[i] - 1; j >= 0 && !stype[j] {
+			sa[bucket[t[j]]] = j
+			bucket[t[j]]++
+		}
+	}
+	bucketEnds(t, bucket)
+	for i := len(sa) - 1; i >= 0; i-- {
+		if j := sa[i] - 1; j >= 0 && stype[j] {
+			bucket[t[j]]--
+			sa[bucket[t[j]]] = j
+		}
+	}
+}
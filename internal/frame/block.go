@@ -1,18 +1,30 @@
 package frame
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
-	"hash/crc32"
+	"io"
+	"squish/internal/checksum"
 	"squish/internal/sqerr"
 )
 
 type Block struct {
-	BlockType uint8   // 0x00 EOS, 0x01 Default codec, 0x02 Block codec
-	Codec     []uint8 // only used if BlockType > 0
-	USize     uint64  // uncompressed size
-	CSize     uint64  // compressed size
-	Checksum  uint64  // checksum value 4 bytes for uncompressed, 4 bytes for compressed
+	BlockType   uint8    // 0x00 EOS, 0x01 Default codec, 0x02 Block codec
+	Codec       []uint8  // only used if BlockType > 0
+	CodecParams [][]byte // serialized parameters of each codec, only kept with CodecParamsFlag
+	USize       uint64   // uncompressed size
+	CSize       uint64   // compressed size
+	Checksum    []byte   // digest of the uncompressed then the compressed payload, as the checksum mode asks
+	Trailer     *Trailer // totals closing the stream, only on EOS blocks with TrailerFlag
+}
+
+// Trailer vouches for the stream as a whole, so blocks that were dropped,
+// duplicated or reordered are caught even when each block checks out.
+type Trailer struct {
+	USize  uint64 // total uncompressed size of every data block
+	Blocks uint64 // number of data blocks
+	Digest []byte // digest of the whole uncompressed content, in the header's DigestAlg
 }
 
 func (b *Block) valid() error {
@@ -29,7 +41,7 @@ func (block1 Block) equal(block2 Block) bool {
 	a := block1.BlockType == block2.BlockType
 	b := block1.USize == block2.USize
 	c := block1.CSize == block2.CSize
-	d := block1.Checksum == block2.Checksum
+	d := bytes.Equal(block1.Checksum, block2.Checksum)
 	e := true
 	for i := range block1.Codec {
 		e = block1.Codec[i] == block2.Codec[i]
@@ -37,7 +49,13 @@ func (block1 Block) equal(block2 Block) bool {
 			return false
 		}
 	}
-	return a && b && c && d && e
+	f := equalCodecParams(block1.CodecParams, block2.CodecParams, len(block1.Codec))
+	g := (block1.Trailer == nil) == (block2.Trailer == nil)
+	if g && block1.Trailer != nil {
+		t1, t2 := block1.Trailer, block2.Trailer
+		g = t1.USize == t2.USize && t1.Blocks == t2.Blocks && bytes.Equal(t1.Digest, t2.Digest)
+	}
+	return a && b && c && d && e && f && g
 }
 
 func (b Block) String() string {
@@ -45,7 +63,10 @@ func (b Block) String() string {
 	s += fmt.Sprintf("Codec:     %d\n", b.Codec)
 	s += fmt.Sprintf("USize:     %d\n", b.USize)
 	s += fmt.Sprintf("CSize:     %d\n", b.CSize)
-	s += fmt.Sprintf("Checksum:  %016x\n", b.Checksum)
+	s += fmt.Sprintf("Checksum:  %x\n", b.Checksum)
+	if b.Trailer != nil {
+		s += fmt.Sprintf("Trailer:   %d blocks, %d bytes, digest %x\n", b.Trailer.Blocks, b.Trailer.USize, b.Trailer.Digest)
+	}
 	return s
 }
 
@@ -58,8 +79,11 @@ func readBlock(fr *frameReader) (Block, error) {
 	if err != nil {
 		return b, fmt.Errorf("failed to read block type: %w", err)
 	}
-	if b.BlockType == EOS { // return if EOS block
-		return b, nil
+	if b.BlockType == EOS { // return if EOS block, after its trailer
+		if fr.Header.Flags&TrailerFlag != 0 {
+			b.Trailer, err = readTrailer(fr)
+		}
+		return b, err
 	}
 	codecs := byte(0) // read the number of codecs if it is block specific
 	if b.BlockType == BlockCodec {
@@ -72,6 +96,12 @@ func readBlock(fr *frameReader) (Block, error) {
 	if err != nil {
 		return b, fmt.Errorf("failed to read block codec list: %w", err)
 	}
+	if codecs > 0 && fr.Header.Flags&CodecParamsFlag != 0 {
+		b.CodecParams, err = readCodecParams(fr, int(codecs))
+		if err != nil {
+			return b, fmt.Errorf("failed to read block codec parameters: %w", err)
+		}
+	}
 	b.USize, err = binary.ReadUvarint(fr) // read and assign the varint sizes
 	if err != nil {
 		return b, fmt.Errorf("failed to read block uncompressed size: %w", err)
@@ -80,51 +110,146 @@ func readBlock(fr *frameReader) (Block, error) {
 	if err != nil {
 		return b, fmt.Errorf("failed to read block compressed size: %w", err)
 	}
-	byteLength := 0 // read the checksum data according to the method
-	if fr.Header.ChecksumMode&CompressedChecksum != 0x00 {
-		byteLength += crc32.Size
-	}
-	if fr.Header.ChecksumMode&UncompressedChecksum != 0x00 {
-		byteLength += crc32.Size
-	}
-	if byteLength > 0 {
-		cs, err := fr.ReadBytes(byteLength)
+	if n := checksumSize(fr.Header); n > 0 { // read the checksum data according to the method
+		b.Checksum, err = fr.ReadBytes(n)
 		if err != nil {
 			return b, fmt.Errorf("failed to read block checksum: %w", err)
 		}
-		for _, csbyte := range cs {
-			b.Checksum = (b.Checksum << 8) | uint64(csbyte)
-		}
 	}
 	return b, nil
 }
 
 func writeBlock(fw *frameWriter, b Block) error {
 	if b.BlockType == EOS { // if EOS block is being written
-		_, err := fw.writer.Write([]byte{b.BlockType})
+		bytes := []byte{b.BlockType}
+		if fw.header.Flags&TrailerFlag != 0 {
+			if b.Trailer == nil || len(b.Trailer.Digest) != checksum.Size(fw.header.DigestAlg()) {
+				return sqerr.New(sqerr.Internal, "EOS block without a trailer of the header's digest algorithm")
+			}
+			bytes = binary.AppendUvarint(bytes, b.Trailer.USize)
+			bytes = binary.AppendUvarint(bytes, b.Trailer.Blocks)
+			bytes = append(bytes, b.Trailer.Digest...)
+		}
+		_, err := fw.writer.Write(bytes)
 		if err != nil {
 			return fmt.Errorf("failed to write EOS block: %w", err)
 		}
 		return nil
 	}
-	bytes := make([]byte, 0, 27) // build block header
+	bytes := make([]byte, 0, 20+2*checksum.MaxSize) // build block header
 	bytes = append(bytes, b.BlockType)
 	if b.BlockType == BlockCodec {
 		bytes = append(bytes, byte(len(b.Codec)))
 		bytes = append(bytes, b.Codec...)
+		if fw.header.Flags&CodecParamsFlag != 0 {
+			bytes = appendCodecParams(bytes, b.CodecParams, len(b.Codec))
+		}
 	}
 	bytes = binary.AppendUvarint(bytes, b.USize)
 	bytes = binary.AppendUvarint(bytes, b.CSize)
-	hasCCS := fw.header.ChecksumMode&CompressedChecksum != 0
-	hasUCS := fw.header.ChecksumMode&UncompressedChecksum != 0
-	if hasUCS && hasCCS {
-		bytes = binary.BigEndian.AppendUint64(bytes, b.Checksum)
-	} else if hasUCS || hasCCS {
-		bytes = binary.BigEndian.AppendUint32(bytes, uint32(b.Checksum))
+	if len(b.Checksum) != checksumSize(fw.header) {
+		return sqerr.New(sqerr.Internal, fmt.Sprintf("block checksum of %d bytes, the checksum mode takes %d", len(b.Checksum), checksumSize(fw.header)))
 	}
+	bytes = append(bytes, b.Checksum...)
 	_, err := fw.writer.Write(bytes)
 	if err != nil {
 		return fmt.Errorf("failed to write block: %w", err)
 	}
 	return nil
 }
+
+func readTrailer(fr *frameReader) (*Trailer, error) {
+	var (
+		t   Trailer
+		err error
+	)
+	t.USize, err = binary.ReadUvarint(fr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trailer uncompressed size: %w", err)
+	}
+	t.Blocks, err = binary.ReadUvarint(fr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trailer block count: %w", err)
+	}
+	t.Digest, err = fr.ReadBytes(checksum.Size(fr.Header.DigestAlg()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trailer digest: %w", err)
+	}
+	return &t, nil
+}
+
+// checksumSize returns the bytes of checksum in each block of a stream.
+func checksumSize(h Header) int {
+	n := 0
+	if h.ChecksumMode&UncompressedChecksum != 0 {
+		n += checksum.Size(h.ChecksumAlg)
+	}
+	if h.ChecksumMode&CompressedChecksum != 0 {
+		n += checksum.Size(h.ChecksumAlg)
+	}
+	return n
+}
+
+// appendCodecParams appends the uvarint length and bytes of each of n codecs'
+// parameters, params may be shorter when the trailing codecs have none.
+func appendCodecParams(dst []byte, params [][]byte, n int) []byte {
+	for i := range n {
+		var p []byte
+		if i < len(params) {
+			p = params[i]
+		}
+		dst = binary.AppendUvarint(dst, uint64(len(p)))
+		dst = append(dst, p...)
+	}
+	return dst
+}
+
+func readCodecParams(r io.ByteReader, n int) ([][]byte, error) {
+	params := make([][]byte, n)
+	for i := range params {
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if length > MaxCodecParams {
+			return nil, sqerr.New(sqerr.Corrupt, "codec parameters too long")
+		}
+		if length == 0 {
+			continue
+		}
+		params[i] = make([]byte, length)
+		for j := range params[i] {
+			if params[i][j], err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return params, nil
+}
+
+func equalCodecParams(params1 [][]byte, params2 [][]byte, n int) bool {
+	for i := range n {
+		var p1, p2 []byte
+		if i < len(params1) {
+			p1 = params1[i]
+		}
+		if i < len(params2) {
+			p2 = params2[i]
+		}
+		if !bytes.Equal(p1, p2) {
+			return false
+		}
+	}
+	return true
+}
+
+// byteReader reads single bytes from readers that can't unread them.
+type byteReader struct {
+	io.Reader
+}
+
+func (br byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(br.Reader, b[:])
+	return b[0], err
+}
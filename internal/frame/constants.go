@@ -1,7 +1,9 @@
 package frame
 
 const MagicKey = "SQZ"
+const IndexKey = "SQI"
 const MaxBlockSize = 1<<24 - 1
+const MaxCodecParams = 1 << 10 // longest serialized parameters of one codec
 
 // Block types
 const (
@@ -16,3 +18,31 @@ const (
 	UncompressedChecksum
 	CompressedChecksum
 )
+
+// Header flag bits, each one a format feature
+const (
+	IndexFlag       = 1 << iota // a block index follows the EOS block
+	CodecParamsFlag             // every codec in header and block codec lists is followed by its parameters
+	ChecksumAlgFlag             // the checksum algorithm follows the checksum mode, otherwise CRC32 is used
+	TrailerFlag                 // a trailer with the stream totals and content digest follows the EOS block type
+	TrailerAlgFlag              // the trailer digest algorithm follows the checksum algorithm, otherwise the trailer uses the checksum algorithm
+)
+
+// RequiredFlags are the features a decoder must understand to read a stream,
+// OptionalFlags those decoders that don't know them can ignore.
+const (
+	RequiredFlags = CodecParamsFlag | ChecksumAlgFlag | TrailerAlgFlag
+	OptionalFlags = IndexFlag | TrailerFlag
+)
+
+// Format versions. LegacyVersion headers have no version byte, their flags
+// byte directly follows the magic and never has the version bit set.
+const (
+	LegacyVersion = 0
+	FormatVersion = 1    // version written by this squish
+	versionBit    = 0x80 // marks the byte after the magic as a version
+)
+
+// legacyFlags are the only flags LegacyVersion writers ever set, any other bit
+// in a legacy flags byte can't be trusted.
+const legacyFlags = IndexFlag | CodecParamsFlag
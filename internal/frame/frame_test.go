@@ -1,27 +1,36 @@
 package frame
 
 import (
+	"bytes"
+	"encoding/binary"
+	"flag"
 	"io"
+	"os"
+	"squish/internal/checksum"
 	"squish/internal/codec"
+	"squish/internal/sqerr"
 	"strings"
 	"testing"
 )
 
 var payloadStr string = "Hello World!"
 
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
 func TestWriteRead(t *testing.T) {
 	headers := []Header{
 		{Key: MagicKey, Codec: []uint8{codec.RAW}, ChecksumMode: NoChecksum},
 		{Key: MagicKey, Codec: []uint8{codec.RAW}, ChecksumMode: UncompressedChecksum},
 		{Key: MagicKey, Codec: []uint8{codec.RAW, codec.RLE}, ChecksumMode: CompressedChecksum},
 		{Key: MagicKey, Codec: []uint8{codec.RAW}, ChecksumMode: UncompressedChecksum | CompressedChecksum},
+		{Key: MagicKey, Version: FormatVersion, Flags: ChecksumAlgFlag, Codec: []uint8{codec.RAW}, ChecksumMode: UncompressedChecksum | CompressedChecksum, ChecksumAlg: checksum.SHA256},
 	}
 	blocks := []Block{
-		{BlockType: DefaultCodec, USize: 12, CSize: 12, Checksum: 0},
-		{BlockType: BlockCodec, Codec: []uint8{codec.RAW}, USize: 12, CSize: 12, Checksum: 75},
-		{BlockType: DefaultCodec, USize: 12, CSize: 12, Checksum: 170},
-		{BlockType: DefaultCodec, USize: 12, CSize: 12, Checksum: 345},
-		{BlockType: DefaultCodec, USize: 12, CSize: 12, Checksum: 345},
+		{BlockType: DefaultCodec, USize: 12, CSize: 12},
+		{BlockType: BlockCodec, Codec: []uint8{codec.RAW}, USize: 12, CSize: 12, Checksum: []byte{0, 0, 0, 75}},
+		{BlockType: DefaultCodec, USize: 12, CSize: 12, Checksum: []byte{0, 0, 0, 170}},
+		{BlockType: DefaultCodec, USize: 12, CSize: 12, Checksum: []byte{0, 0, 1, 89, 0, 0, 1, 89}},
+		{BlockType: DefaultCodec, USize: 12, CSize: 12, Checksum: bytes.Repeat([]byte{0xA5}, 2*checksum.Size(checksum.SHA256))},
 	}
 	for i, h := range headers {
 		var str strings.Builder
@@ -85,6 +94,172 @@ func TestWriteRead(t *testing.T) {
 	}
 }
 
+func TestCodecParams(t *testing.T) {
+	h := Header{Key: MagicKey, Flags: CodecParamsFlag, Codec: []uint8{codec.RLE, codec.HUFFMAN}, CodecParams: [][]byte{{1, 2, 3}}}
+	testBlocks := []Block{
+		{BlockType: DefaultCodec, USize: 12, CSize: 12},
+		{BlockType: BlockCodec, Codec: []uint8{codec.LZ77, codec.RAW}, CodecParams: [][]byte{nil, []byte("raw")}, USize: 12, CSize: 12},
+		{BlockType: BlockCodec, Codec: []uint8{codec.RAW}, USize: 12, CSize: 12},
+	}
+	var str strings.Builder
+	fw := NewFrameWriter(io.Writer(&str), h)
+	if err := fw.Ready(); err != nil {
+		t.Fatalf("Failed to ready FrameWriter: %v", err)
+	}
+	for i, b := range testBlocks {
+		if err := fw.WriteBlock(b, strings.NewReader(payloadStr)); err != nil {
+			t.Fatalf("Failed writing block %d: %v", i, err)
+		}
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("Failed to close frame writer: %v", err)
+	}
+	stream := str.String()
+	fr := NewFrameReader(strings.NewReader(stream))
+	if err := fr.Ready(); err != nil {
+		t.Fatalf("Failed to ready FrameReader: %v", err)
+	}
+	if !fr.Header.equal(h) || len(fr.Header.CodecParams[1]) != 0 {
+		t.Fatalf("Header mismatch\n%s\n%s", h, fr.Header)
+	}
+	for i := range testBlocks {
+		block, _, err := fr.Next()
+		if err != nil {
+			t.Fatalf("Failed to read block %d: %v", i, err)
+		}
+		if !block.equal(testBlocks[i]) {
+			t.Fatalf("Mismatch in header of block %d, %s", i, block)
+		}
+		if err = fr.Drop(); err != nil {
+			t.Fatalf("Failed to drop payload of block %d: %v", i, err)
+		}
+	}
+	// a parameter length running past the end of the header
+	corrupt := stream[:len(MagicKey)+5] + "\x7f"
+	fr = NewFrameReader(strings.NewReader(corrupt))
+	if err := fr.Ready(); err == nil {
+		t.Fatalf("Missed truncated codec parameters")
+	}
+}
+
+// TestGoldenLayout pins the byte layout of each format version, a base frame
+// per version and one per later feature are written and compared with
+// testdata. Existing files only change with a new format version, features
+// added within a version get a file of their own.
+func TestGoldenLayout(t *testing.T) {
+	for _, c := range []struct {
+		golden  string
+		version uint8
+		flags   uint8 // features on top of the base header
+		alg     uint8 // checksum algorithm
+		trailer uint8 // trailer digest algorithm, only kept with TrailerAlgFlag
+	}{
+		{"frame_v0.sqz", LegacyVersion, 0, checksum.CRC32, 0},
+		{"frame_v1.sqz", FormatVersion, 0, checksum.CRC32, 0},
+		{"frame_v1_sha256.sqz", FormatVersion, ChecksumAlgFlag, checksum.SHA256, 0},
+		{"frame_v1_trailer.sqz", FormatVersion, ChecksumAlgFlag | TrailerFlag, checksum.SHA256, 0},
+		{"frame_v1_trailer_alg.sqz", FormatVersion, ChecksumAlgFlag | TrailerFlag | TrailerAlgFlag, checksum.XXH64, checksum.SHA256},
+	} {
+		h := Header{
+			Key:          MagicKey,
+			Version:      c.version,
+			Flags:        IndexFlag | CodecParamsFlag | c.flags,
+			Codec:        []uint8{codec.RLE, codec.HUFFMAN},
+			CodecParams:  [][]byte{{1, 's', 2}, nil},
+			ChecksumMode: UncompressedChecksum | CompressedChecksum,
+			ChecksumAlg:  c.alg,
+			TrailerAlg:   c.trailer,
+		}
+		n := checksum.Size(h.ChecksumAlg) / 4 // CRC-32 sized patterns stretched to the digest size
+		testBlocks := []Block{
+			{BlockType: DefaultCodec, USize: 300, CSize: 12, Checksum: bytes.Repeat([]byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xAB, 0xCD, 0xEF}, n)},
+			{BlockType: BlockCodec, Codec: []uint8{codec.LZ77}, CodecParams: [][]byte{{1, 'w', 12}}, USize: 12, CSize: 12, Checksum: append(make([]byte, 8*n-1), 1)},
+		}
+		var str strings.Builder
+		fw := NewFrameWriter(io.Writer(&str), h)
+		if err := fw.Ready(); err != nil {
+			t.Fatalf("Failed to ready FrameWriter: %v", err)
+		}
+		for i, b := range testBlocks {
+			if err := fw.WriteBlock(b, strings.NewReader(payloadStr)); err != nil {
+				t.Fatalf("Failed writing block %d: %v", i, err)
+			}
+		}
+		eos := Block{BlockType: EOS}
+		if h.Flags&TrailerFlag != 0 {
+			eos.Trailer = &Trailer{USize: 312, Blocks: 2, Digest: checksum.Sum(h.DigestAlg(), nil, []byte(payloadStr))}
+			fw.SetDigest(eos.Trailer.Digest)
+		}
+		if err := fw.Close(); err != nil {
+			t.Fatalf("Failed to close frame writer: %v", err)
+		}
+		golden := "testdata/" + c.golden
+		if *update {
+			if err := os.WriteFile(golden, []byte(str.String()), 0o644); err != nil {
+				t.Fatalf("Failed to update %s: %v", golden, err)
+			}
+		}
+		expected, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", golden, err)
+		}
+		if !bytes.Equal([]byte(str.String()), expected) {
+			t.Fatalf("%s layout changed:\n got %x\nwant %x", c.golden, str.String(), expected)
+		}
+		fr := NewFrameReader(bytes.NewReader(expected))
+		if err = fr.Ready(); err != nil || !fr.Header.equal(h) {
+			t.Fatalf("%s header read back as %s: %v", c.golden, fr.Header, err)
+		}
+		for i := range testBlocks {
+			block, _, err := fr.Next()
+			if err != nil || !block.equal(testBlocks[i]) {
+				t.Fatalf("%s block %d read back as %s: %v", c.golden, i, block, err)
+			}
+			fr.Drop()
+		}
+		if block, _, err := fr.Next(); err != nil || !block.equal(eos) {
+			t.Fatalf("%s EOS block read back as %s: %v", c.golden, block, err)
+		}
+	}
+}
+
+func TestHeaderVersions(t *testing.T) {
+	const rest = "\x00\x01\x00" // no checksums, the RAW pipeline
+	for name, c := range map[string]struct {
+		header string
+		code   sqerr.Code
+		flags  uint8
+	}{
+		"legacy":                     {"SQZ\x01" + rest, sqerr.Success, IndexFlag},
+		"legacy codec parameters":    {"SQZ\x02\x00\x01\x00\x00", sqerr.Success, CodecParamsFlag},
+		"legacy checksum algorithm":  {"SQZ\x04\x00\x02\x01\x00", sqerr.Unsupported, 0},
+		"legacy trailer":             {"SQZ\x08" + rest, sqerr.Unsupported, 0},
+		"legacy unknown flags":       {"SQZ\x41" + rest, sqerr.Unsupported, 0},
+		"current":                    {"SQZ\x81\x00\x01" + rest, sqerr.Success, IndexFlag},
+		"unknown optional features":  {"SQZ\x81\x00\x85\x01" + rest, sqerr.Success, IndexFlag},
+		"checksum algorithm":         {"SQZ\x81\x04\x00\x01\x02\x01\x00", sqerr.Success, ChecksumAlgFlag},
+		"unknown checksum algorithm": {"SQZ\x81\x04\x00\x01\x09\x01\x00", sqerr.Unsupported, 0},
+		"trailer algorithm":          {"SQZ\x81\x14\x08\x01\x02\x03\x01\x00", sqerr.Success, ChecksumAlgFlag | TrailerFlag | TrailerAlgFlag},
+		"unknown trailer algorithm":  {"SQZ\x81\x10\x08\x00\x09\x01\x00", sqerr.Unsupported, 0},
+		"unknown required features":  {"SQZ\x81\x20\x00" + rest, sqerr.Unsupported, 0},
+		"newer version":              {"SQZ\x82\x00\x00" + rest, sqerr.Unsupported, 0},
+		"version zero":               {"SQZ\x80\x00\x00" + rest, sqerr.Corrupt, 0},
+	} {
+		fr := NewFrameReader(strings.NewReader(c.header))
+		err := fr.Ready()
+		if sqerr.ErrorCode(err) != c.code {
+			t.Fatalf("Header with %s read with %v", name, err)
+		}
+		if err == nil && (fr.Header.Flags != c.flags || len(fr.Header.Codec) != 1) {
+			t.Fatalf("Header with %s read as %s", name, fr.Header)
+		}
+	}
+	legacy := Header{Key: MagicKey, Flags: TrailerFlag, Codec: []uint8{codec.RAW}}
+	if err := NewFrameWriter(io.Discard, legacy).Ready(); sqerr.ErrorCode(err) != sqerr.Internal {
+		t.Fatalf("Wrote a legacy header with a versioned feature: %v", err)
+	}
+}
+
 func TestHeaderValid(t *testing.T) {
 	var badHeader Header
 	badHeader = Header{Key: "SQz"}
@@ -159,3 +334,108 @@ func TestWriteNilPayloadErr(t *testing.T) {
 		t.Fatalf("Missed nil payload with non-zero CSize")
 	}
 }
+
+func TestTrailer(t *testing.T) {
+	h := Header{Key: MagicKey, Version: FormatVersion, Flags: IndexFlag | TrailerFlag | ChecksumAlgFlag, Codec: []uint8{codec.RAW}, ChecksumAlg: checksum.XXH64}
+	digest := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	write := func(digest []byte) (string, error) {
+		var str strings.Builder
+		fw := NewFrameWriter(io.Writer(&str), h)
+		fw.Ready()
+		for range 3 {
+			fw.WriteBlock(Block{BlockType: DefaultCodec, USize: 100, CSize: 12}, strings.NewReader(payloadStr))
+		}
+		fw.SetDigest(digest)
+		err := fw.Close()
+		return str.String(), err
+	}
+	if _, err := write(digest[:4]); err == nil {
+		t.Fatalf("Missed trailer digest of the wrong size")
+	}
+	stream, err := write(digest)
+	if err != nil {
+		t.Fatalf("Failed to close frame writer: %v", err)
+	}
+	for _, flags := range []uint8{h.Flags, h.Flags &^ TrailerFlag} {
+		fr := NewFrameReader(strings.NewReader(stream))
+		fr.Ready()
+		fr.Header.Flags = flags // decoders that don't know trailers stop at the EOS block type
+		for range 3 {
+			fr.Next()
+			fr.Drop()
+		}
+		expected := Block{BlockType: EOS}
+		if flags&TrailerFlag != 0 {
+			expected.Trailer = &Trailer{USize: 300, Blocks: 3, Digest: digest}
+		}
+		if block, _, err := fr.Next(); err != nil || !block.equal(expected) {
+			t.Fatalf("EOS block read back as %s: %v", block, err)
+		}
+	}
+	if idx, err := ReadIndex(strings.NewReader(stream), int64(len(stream))); err != nil || len(idx) != 3 {
+		t.Fatalf("Failed to read index after the trailer: %v", err)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	h := Header{Key: MagicKey, Flags: IndexFlag, Codec: []uint8{codec.RAW}, ChecksumMode: CompressedChecksum}
+	var str strings.Builder
+	fw := NewFrameWriter(io.Writer(&str), h)
+	err := fw.Ready()
+	if err != nil {
+		t.Fatalf("Failed to ready FrameWriter: %v", err)
+	}
+	for i := range 3 {
+		b := Block{BlockType: DefaultCodec, USize: 12, CSize: uint64(len(payloadStr) - i), Checksum: []byte{0, 0, 0, byte(i)}}
+		err = fw.WriteBlock(b, strings.NewReader(payloadStr))
+		if err != nil {
+			t.Fatalf("Failed writing block %d: %v", i, err)
+		}
+	}
+	err = fw.Close()
+	if err != nil {
+		t.Fatalf("Failed to close frame writer: %v", err)
+	}
+	stream := str.String()
+	idx, err := ReadIndex(strings.NewReader(stream), int64(len(stream)))
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	if len(idx) != 3 || idx.USize() != 36 {
+		t.Fatalf("Unexpected index %v", idx)
+	}
+	for i, e := range idx {
+		fr := NewFrameReader(strings.NewReader(stream[e.Offset:]))
+		fr.Header = h
+		block, err := readBlock(fr)
+		if err != nil {
+			t.Fatalf("Failed to read block %d at indexed offset: %v", i, err)
+		}
+		if block.CSize != uint64(len(payloadStr)-i) || e.UOffset != uint64(12*i) {
+			t.Fatalf("Index entry %d does not point at its block", i)
+		}
+	}
+	if idx.Find(0) != 0 || idx.Find(12) != 1 || idx.Find(35) != 2 || idx.Find(36) != 3 {
+		t.Fatalf("Index lookup returned the wrong block")
+	}
+	_, err = ReadIndex(strings.NewReader(stream[:len(stream)-1]), int64(len(stream)-1))
+	if err == nil {
+		t.Fatalf("Missed missing index key")
+	}
+	for name, entry := range map[string][2]uint64{
+		"first offset past the end": {1 << 20, 10},
+		"wrapping offset":           {1<<64 - 10, 20},
+		"wrapping size":             {10, 1<<64 - 5},
+	} {
+		crafted := binary.AppendUvarint(nil, entry[0])
+		crafted = binary.AppendUvarint(crafted, 1)
+		crafted = binary.AppendUvarint(crafted, 12)
+		crafted = binary.AppendUvarint(crafted, entry[1])
+		crafted = binary.BigEndian.AppendUint64(crafted, uint64(len(crafted)))
+		crafted = append([]byte(stream[:40]), append(crafted, IndexKey...)...)
+		_, err = ReadIndex(bytes.NewReader(crafted), int64(len(crafted)))
+		if sqerr.ErrorCode(err) != sqerr.Corrupt {
+			t.Fatalf("Missed index with a %s: %v", name, err)
+		}
+	}
+}
@@ -1,16 +1,22 @@
 package frame
 
 import (
+	"encoding/binary"
 	"fmt"
 	"io"
+	"squish/internal/checksum"
 	"squish/internal/sqerr"
 )
 
 type Header struct {
-	Key          string  // Magic string marking the start of a header
-	Flags        uint8   // flags to determine processing
-	Codec        []uint8 // default codec used
-	ChecksumMode uint8   // per block checksum mode
+	Key          string   // Magic string marking the start of a header
+	Version      uint8    // format version, LegacyVersion or up to FormatVersion
+	Flags        uint8    // flags to determine processing, the format features in use
+	Codec        []uint8  // default codec used
+	CodecParams  [][]byte // serialized parameters of each default codec, only kept with CodecParamsFlag
+	ChecksumMode uint8    // per block checksum mode
+	ChecksumAlg  uint8    // per block checksum algorithm, only kept with ChecksumAlgFlag
+	TrailerAlg   uint8    // trailer content digest algorithm, only kept with TrailerAlgFlag
 }
 
 func (h *Header) valid() error {
@@ -20,21 +26,49 @@ func (h *Header) valid() error {
 	if h.ChecksumMode > UncompressedChecksum+CompressedChecksum {
 		return sqerr.New(sqerr.Corrupt, "invalid checksum method found")
 	}
+	if !checksum.Valid(h.ChecksumAlg) {
+		return sqerr.New(sqerr.Unsupported, fmt.Sprintf("unsupported checksum algorithm %d", h.ChecksumAlg))
+	}
+	if !checksum.Valid(h.TrailerAlg) {
+		return sqerr.New(sqerr.Unsupported, fmt.Sprintf("unsupported trailer algorithm %d", h.TrailerAlg))
+	}
 	return nil
 }
 
+// DigestAlg returns the algorithm of the trailer's content digest, the
+// checksum algorithm unless the header names one of its own.
+func (h Header) DigestAlg() uint8 {
+	switch {
+	case h.Flags&TrailerAlgFlag != 0:
+		return h.TrailerAlg
+	case h.Flags&ChecksumAlgFlag != 0:
+		return h.ChecksumAlg
+	}
+	return checksum.CRC32
+}
+
 func (h Header) String() string {
 	s := fmt.Sprintf("Key:          %s\n", h.Key)
+	s += fmt.Sprintf("Version:      %d\n", h.Version)
 	s += fmt.Sprintf("Flags:        %04b\n", h.Flags)
 	s += fmt.Sprintf("Codec:        %d\n", h.Codec)
+	if h.Flags&CodecParamsFlag != 0 {
+		s += fmt.Sprintf("CodecParams:  %x\n", h.CodecParams)
+	}
 	s += fmt.Sprintf("ChecksumMode: %04b\n", h.ChecksumMode)
+	if h.Flags&ChecksumAlgFlag != 0 {
+		s += fmt.Sprintf("ChecksumAlg:  %s\n", checksum.Name(h.ChecksumAlg))
+	}
+	if h.Flags&TrailerAlgFlag != 0 {
+		s += fmt.Sprintf("TrailerAlg:   %s\n", checksum.Name(h.TrailerAlg))
+	}
 	return s
 }
 
 func (header1 Header) equal(header2 Header) bool {
-	a := header1.Key == header2.Key
+	a := header1.Key == header2.Key && header1.Version == header2.Version
 	b := header1.Flags == header2.Flags
-	c := header1.ChecksumMode == header2.ChecksumMode
+	c := header1.ChecksumMode == header2.ChecksumMode && header1.ChecksumAlg == header2.ChecksumAlg && header1.TrailerAlg == header2.TrailerAlg
 	d := true
 	for i := range header1.Codec {
 		d = header1.Codec[i] == header2.Codec[i]
@@ -42,34 +76,108 @@ func (header1 Header) equal(header2 Header) bool {
 			return false
 		}
 	}
-	return a && b && c && d
+	e := equalCodecParams(header1.CodecParams, header2.CodecParams, len(header1.Codec))
+	return a && b && c && d && e
 }
 
+// readHeader reads a header of any version. Versioned headers follow the
+// magic with the version, then the required and optional features as
+// uvarints where legacy headers have their flags byte. Newer versions,
+// unknown required features and legacy flags no legacy writer set are
+// unsupported, unknown optional features are dropped.
 func readHeader(r io.Reader) (Header, error) {
 	var h Header
-	bytes := make([]byte, len(MagicKey)+3) // read in the header of the frame
+	bytes := make([]byte, len(MagicKey)+1) // read in the magic and the version or flags
 	_, err := io.ReadFull(r, bytes)
 	if err != nil {
 		return h, fmt.Errorf("failed to read header: %w", err)
 	}
-	h.Key = string(bytes[:len(MagicKey)]) // assign values to the header of the FrameReader
-	h.Flags = bytes[len(MagicKey)]
-	h.ChecksumMode = bytes[len(MagicKey)+1]
-	codecs := bytes[len(MagicKey)+2]
+	h.Key = string(bytes[:len(MagicKey)])
+	if h.Key != MagicKey {
+		return h, nil // reported by valid
+	}
+	if v := bytes[len(MagicKey)]; v&versionBit == 0 {
+		if unknown := v &^ legacyFlags; unknown != 0 {
+			return h, sqerr.New(sqerr.Unsupported, fmt.Sprintf("legacy stream has flags %#x unknown to its format version", unknown))
+		}
+		h.Flags = v
+	} else if h.Version = v &^ versionBit; h.Version == LegacyVersion {
+		return h, sqerr.New(sqerr.Corrupt, "invalid header version found")
+	} else if h.Version > FormatVersion {
+		return h, sqerr.New(sqerr.Unsupported, fmt.Sprintf("stream format version %d is newer than this squish supports (%d)", h.Version, FormatVersion))
+	} else {
+		required, err := binary.ReadUvarint(byteReader{r})
+		if err != nil {
+			return h, fmt.Errorf("failed to read header required features: %w", err)
+		}
+		optional, err := binary.ReadUvarint(byteReader{r})
+		if err != nil {
+			return h, fmt.Errorf("failed to read header optional features: %w", err)
+		}
+		if unknown := required &^ RequiredFlags; unknown != 0 {
+			return h, sqerr.New(sqerr.Unsupported, fmt.Sprintf("stream requires format features %#x unknown to this squish", unknown))
+		}
+		h.Flags = uint8(required) | uint8(optional&OptionalFlags)
+	}
+	bytes = bytes[:2] // read in the checksum mode, algorithms and codec count
+	if h.Flags&ChecksumAlgFlag != 0 {
+		bytes = append(bytes, 0)
+	}
+	if h.Flags&TrailerAlgFlag != 0 {
+		bytes = append(bytes, 0)
+	}
+	_, err = io.ReadFull(r, bytes)
+	if err != nil {
+		return h, fmt.Errorf("failed to read header: %w", err)
+	}
+	h.ChecksumMode = bytes[0]
+	algs := bytes[1 : len(bytes)-1]
+	if h.Flags&ChecksumAlgFlag != 0 {
+		h.ChecksumAlg, algs = algs[0], algs[1:]
+	}
+	if h.Flags&TrailerAlgFlag != 0 {
+		h.TrailerAlg = algs[0]
+	}
+	codecs := bytes[len(bytes)-1]
 	h.Codec = make([]byte, codecs)
 	_, err = io.ReadFull(r, h.Codec)
 	if err != nil {
 		return h, fmt.Errorf("failed to read header codecs: %w", err)
 	}
+	if h.Flags&CodecParamsFlag != 0 {
+		h.CodecParams, err = readCodecParams(byteReader{r}, len(h.Codec))
+		if err != nil {
+			return h, fmt.Errorf("failed to read header codec parameters: %w", err)
+		}
+	}
 	return h, nil
 }
 
+// writeHeader writes a header in the layout of its version.
 func writeHeader(w io.Writer, h Header) error {
 	bytes := []byte(h.Key) // build byte array for header
-	bytes = append(bytes, h.Flags)
+	if h.Version == LegacyVersion {
+		if h.Flags&^legacyFlags != 0 {
+			return sqerr.New(sqerr.Internal, fmt.Sprintf("flags %#x need a versioned header", h.Flags&^legacyFlags))
+		}
+		bytes = append(bytes, h.Flags)
+	} else {
+		bytes = append(bytes, versionBit|h.Version)
+		bytes = binary.AppendUvarint(bytes, uint64(h.Flags&RequiredFlags))
+		bytes = binary.AppendUvarint(bytes, uint64(h.Flags&^RequiredFlags))
+	}
 	bytes = append(bytes, h.ChecksumMode)
+	if h.Flags&ChecksumAlgFlag != 0 {
+		bytes = append(bytes, h.ChecksumAlg)
+	}
+	if h.Flags&TrailerAlgFlag != 0 {
+		bytes = append(bytes, h.TrailerAlg)
+	}
 	bytes = append(bytes, byte(len(h.Codec)))
 	bytes = append(bytes, h.Codec...)
+	if h.Flags&CodecParamsFlag != 0 {
+		bytes = appendCodecParams(bytes, h.CodecParams, len(h.Codec))
+	}
 	_, err := w.Write(bytes) // write the header so FrameWriter is ready to write blocks
 	if err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
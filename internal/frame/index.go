@@ -0,0 +1,120 @@
+package frame
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"squish/internal/sqerr"
+)
+
+const indexFooterSize = 8 + len(IndexKey) // index size + index key
+
+type IndexEntry struct {
+	Offset  uint64 // offset of the block from the start of the stream
+	Size    uint64 // size of the block in the stream, block header included
+	UOffset uint64 // offset of the block's first byte in the uncompressed data
+	USize   uint64 // uncompressed size of the block
+}
+
+// Index maps every data block of a stream to its compressed and uncompressed
+// position, in stream order.
+type Index []IndexEntry
+
+// USize returns the total uncompressed size of the indexed stream.
+func (idx Index) USize() uint64 {
+	if len(idx) == 0 {
+		return 0
+	}
+	last := idx[len(idx)-1]
+	return last.UOffset + last.USize
+}
+
+// Find returns the position of the block holding uncompressed offset off, or
+// len(idx) if off is past the end of the data.
+func (idx Index) Find(off uint64) int {
+	return sort.Search(len(idx), func(i int) bool {
+		return idx[i].UOffset+idx[i].USize > off
+	})
+}
+
+func (idx *Index) add(offset uint64, size uint64, usize uint64) {
+	*idx = append(*idx, IndexEntry{Offset: offset, Size: size, UOffset: idx.USize(), USize: usize})
+}
+
+func writeIndex(w io.Writer, idx Index) error {
+	first := uint64(0)
+	if len(idx) > 0 {
+		first = idx[0].Offset
+	}
+	bytes := binary.AppendUvarint(nil, first) // offset of the first block
+	bytes = binary.AppendUvarint(bytes, uint64(len(idx)))
+	for _, e := range idx {
+		bytes = binary.AppendUvarint(bytes, e.USize)
+		bytes = binary.AppendUvarint(bytes, e.Size)
+	}
+	bytes = binary.BigEndian.AppendUint64(bytes, uint64(len(bytes))) // footer so the index can be found from the end
+	bytes = append(bytes, IndexKey...)
+	_, err := w.Write(bytes)
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
+
+// ReadIndex reads the block index from the end of a stream of the given size.
+func ReadIndex(r io.ReaderAt, size int64) (Index, error) {
+	if size < int64(indexFooterSize) {
+		return nil, sqerr.New(sqerr.Corrupt, "stream too small to hold an index")
+	}
+	footer := make([]byte, indexFooterSize)
+	_, err := r.ReadAt(footer, size-int64(indexFooterSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index footer: %w", err)
+	}
+	if string(footer[8:]) != IndexKey {
+		return nil, sqerr.New(sqerr.Corrupt, "invalid index key found")
+	}
+	indexSize := binary.BigEndian.Uint64(footer[:8])
+	if indexSize > uint64(size)-uint64(indexFooterSize) {
+		return nil, sqerr.New(sqerr.Corrupt, "invalid index size found")
+	}
+	data := make([]byte, indexSize)
+	_, err = r.ReadAt(data, size-int64(indexFooterSize)-int64(indexSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	br := bytes.NewReader(data)
+	offset, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index first block offset: %w", err)
+	}
+	if offset > uint64(size) {
+		return nil, sqerr.New(sqerr.Corrupt, "invalid index first block offset found")
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index entry count: %w", err)
+	}
+	if count > indexSize { // every entry takes at least 2 bytes
+		return nil, sqerr.New(sqerr.Corrupt, "invalid index entry count found")
+	}
+	idx := make(Index, 0, count)
+	for range count {
+		usize, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index entry: %w", err)
+		}
+		bsize, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index entry: %w", err)
+		}
+		if usize > MaxBlockSize || bsize > uint64(size) || offset > uint64(size)-bsize { // without overflowing
+			return nil, sqerr.New(sqerr.Corrupt, "invalid index entry found")
+		}
+		idx.add(offset, bsize, usize)
+		offset += bsize
+	}
+	return idx, nil
+}
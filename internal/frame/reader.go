@@ -6,14 +6,31 @@ import (
 	"squish/internal/sqerr"
 )
 
+type countingReader struct {
+	reader io.Reader // wrapped io.reader
+	n      uint64    // bytes read so far
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.n += uint64(n)
+	return n, err
+}
+
 type frameReader struct {
-	reader        io.Reader         // io.reader for reading a stream
+	reader        *countingReader   // io.reader for reading a stream
 	Header        Header            // header of the stream
 	activePayload *io.LimitedReader // active payload
 }
 
 func NewFrameReader(r io.Reader) *frameReader {
-	return &frameReader{reader: r}
+	return &frameReader{reader: &countingReader{reader: r}}
+}
+
+// Offset returns the number of stream bytes consumed so far, which is the
+// offset of the next block when no payload is active.
+func (fr *frameReader) Offset() uint64 {
+	return fr.reader.n
 }
 
 func (fr *frameReader) Ready() error {
@@ -47,6 +64,9 @@ func (fr *frameReader) Drop() error {
 		if err != nil {
 			return fmt.Errorf("failed to skip payload: %w", err)
 		}
+		if fr.activePayload.N > 0 { // the stream ended inside the payload
+			return fmt.Errorf("failed to skip payload: %w", io.ErrUnexpectedEOF)
+		}
 	}
 	fr.activePayload = nil
 	return nil
@@ -7,21 +7,49 @@ import (
 	"squish/internal/sqerr"
 )
 
+type countingWriter struct {
+	writer io.Writer // wrapped io.writer
+	n      uint64    // bytes written so far
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.writer.Write(p)
+	cw.n += uint64(n)
+	return n, err
+}
+
 type frameWriter struct {
-	writer io.Writer // io.writer for writing a stream
-	header Header    // header of the stream
+	writer  *countingWriter // io.writer for writing a stream
+	header  Header          // header of the stream
+	index   Index           // block index, only kept when the header asks for it
+	trailer Trailer         // totals of the blocks written so far, and the digest from SetDigest
 }
 
 func NewFrameWriter(w io.Writer, h Header) *frameWriter {
-	return &frameWriter{writer: w, header: h}
+	return &frameWriter{writer: &countingWriter{writer: w}, header: h}
 }
 
 func (fw *frameWriter) Ready() error {
 	return writeHeader(fw.writer, fw.header) // write the header bytes to the stream
 }
 
+// SetDigest sets the digest of the whole uncompressed content, written in the
+// trailer by Close when the header has TrailerFlag.
+func (fw *frameWriter) SetDigest(digest []byte) {
+	fw.trailer.Digest = digest
+}
+
 func (fw *frameWriter) Close() error {
-	return fw.WriteBlock(Block{BlockType: EOS, CSize: 0}, nil) // write EOS block to stream
+	eos := Block{BlockType: EOS, CSize: 0}
+	if fw.header.Flags&TrailerFlag != 0 {
+		trailer := fw.trailer
+		eos.Trailer = &trailer
+	}
+	err := fw.WriteBlock(eos, nil) // write EOS block to stream
+	if err != nil || fw.header.Flags&IndexFlag == 0 {
+		return err
+	}
+	return writeIndex(fw.writer, fw.index) // index trails the EOS block
 }
 
 func (fw *frameWriter) WriteBlock(b Block, payload io.Reader) error {
@@ -31,19 +59,26 @@ func (fw *frameWriter) WriteBlock(b Block, payload io.Reader) error {
 		}
 		payload = bytes.NewReader(nil)
 	}
+	start := fw.writer.n
 	err := writeBlock(fw, b) // build block header
 	if err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
-	if b.CSize == 0 { // check for zero length
-		return nil
+	if b.CSize > 0 { // check for zero length
+		n, err := io.CopyN(fw.writer, payload, int64(b.CSize)) // copy the payload to the writer
+		if err != nil {
+			return fmt.Errorf("failed when copying payload to frame writer: %w", err)
+		}
+		if n != int64(b.CSize) { // check to see if the payload is the correct size
+			return sqerr.New(sqerr.Corrupt, fmt.Sprintf("mismatched payload size: got %d - expected %d", n, b.CSize))
+		}
 	}
-	n, err := io.CopyN(fw.writer, payload, int64(b.CSize)) // copy the payload to the writer
-	if err != nil {
-		return fmt.Errorf("failed when copying payload to frame writer: %w", err)
+	if b.BlockType != EOS {
+		fw.trailer.USize += b.USize
+		fw.trailer.Blocks++
 	}
-	if n != int64(b.CSize) { // check to see if the payload is the correct size
-		return sqerr.New(sqerr.Corrupt, fmt.Sprintf("mismatched payload size: got %d - expected %d", n, b.CSize))
+	if b.BlockType != EOS && fw.header.Flags&IndexFlag != 0 {
+		fw.index.add(start, fw.writer.n-start, b.USize)
 	}
-	return err
+	return nil
 }
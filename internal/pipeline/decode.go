@@ -1,77 +1,173 @@
 package pipeline
 
 import (
+	"bytes"
 	"fmt"
-	"hash/crc32"
 	"io"
+	"squish/internal/checksum"
 	"squish/internal/codec"
 	"squish/internal/frame"
 	"squish/internal/sqerr"
 )
 
+// DecodeOptions controls how Decode decompresses a stream.
+type DecodeOptions struct {
+	Threads int           // blocks decoded concurrently, <= 1 decodes sequentially
+	Header  *frame.Header // receives the stream header once it is read, if not nil
+}
+
+// BlockError reports which block of a stream failed to read or decode.
+type BlockError struct {
+	Block  int    // index of the failing block in the stream
+	Offset uint64 // byte offset of the failing block in the stream
+	Err    error  // underlying error
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("block %d at offset %d: %v", e.Block, e.Offset, e.Err)
+}
+
+func (e *BlockError) Unwrap() error {
+	return e.Err
+}
+
+type payloadBlock struct {
+	index   int         // position of the block in the stream
+	offset  uint64      // byte offset of the block in the stream
+	block   frame.Block // block header
+	payload []byte      // compressed payload
+}
+
 func Decode(src io.Reader, dst io.Writer) error {
+	return DecodeWithOptions(src, dst, DecodeOptions{Threads: 1})
+}
+
+// DecodeWithOptions decompresses src into dst. With more than one thread the
+// payloads of upcoming blocks are read ahead and decoded concurrently while
+// the output is still written in order.
+func DecodeWithOptions(src io.Reader, dst io.Writer, opts DecodeOptions) error {
 	fr := frame.NewFrameReader(src) // instantiate a FrameReader
 	err := fr.Ready()               // read in the header of the stream
 	if err != nil {
 		return sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read input header")
 	}
-	for {
+	if opts.Header != nil {
+		*opts.Header = fr.Header
+	}
+	eos := false
+	var eosBlock frame.Block
+	index := 0
+	trailer := NewTrailerCheck(fr.Header)
+	next := func() (payloadBlock, bool, error) {
+		if eos {
+			return payloadBlock{}, false, nil
+		}
+		offset := fr.Offset()
 		block, payload, err := fr.Next()
 		if err != nil {
-			return sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read input block")
+			err = sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read input block")
+			return payloadBlock{}, false, &BlockError{Block: index, Offset: offset, Err: err}
 		}
-		if block.BlockType == frame.EOS { // break if you reached the EOS
-			break
+		if block.BlockType == frame.EOS { // stop if you reached the EOS
+			eos = true
+			eosBlock = block
+			return payloadBlock{}, false, nil
 		}
-		data := make([]byte, block.CSize)
-		n, err := io.ReadFull(payload, data)
+		data, err := ReadPayload(block, payload)
 		if err != nil {
-			return sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read input block")
+			return payloadBlock{}, false, &BlockError{Block: index, Offset: offset, Err: err}
 		}
-		if n != int(block.CSize) {
-			return sqerr.CodedError(err, sqerr.Corrupt, fmt.Sprintf("mismatched compressed payload size: got %d - expected %d", len(data), block.CSize))
+		index++
+		return payloadBlock{index: index - 1, offset: offset, block: block, payload: data}, true, nil
+	}
+	work := func(pb payloadBlock) (payloadBlock, error) {
+		data, err := DecodeBlock(fr.Header, pb.block, pb.payload)
+		if err != nil {
+			return pb, &BlockError{Block: pb.index, Offset: pb.offset, Err: err}
 		}
-		blockCS := block.Checksum
-		if fr.Header.ChecksumMode&frame.CompressedChecksum > 0 {
-			csm := uint64(crc32.ChecksumIEEE(data))
-			exp := (1<<(8*crc32.Size) - 1) & blockCS
-			if csm != exp {
-				return sqerr.New(sqerr.Corrupt, fmt.Sprintf("mismatched compressed payload checksum: got %08x - expected %08x", csm, exp))
-			}
-			blockCS = blockCS >> (8 * crc32.Size)
+		pb.payload = data // decoded in place of the compressed payload
+		return pb, nil
+	}
+	emit := func(pb payloadBlock) error {
+		trailer.Add(pb.block, pb.payload)
+		_, err := dst.Write(pb.payload) // write it out
+		if err != nil {
+			return sqerr.CodedError(err, sqerr.IO, "failed to write output")
 		}
-		codecList := fr.Header.Codec
-		if block.BlockType == frame.BlockCodec {
-			codecList = block.Codec
+		return nil
+	}
+	err = runOrdered(opts.Threads, next, work, emit)
+	if err != nil {
+		return err
+	}
+	return trailer.Verify(eosBlock) // whole blocks may be missing even when each one checks out
+}
+
+// ReadPayload reads the full compressed payload of a block from the payload
+// reader handed out by the frame reader.
+func ReadPayload(block frame.Block, payload io.Reader) ([]byte, error) {
+	data := make([]byte, block.CSize)
+	n, err := io.ReadFull(payload, data)
+	if err != nil {
+		return nil, sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read input block")
+	}
+	if n != int(block.CSize) {
+		return nil, sqerr.New(sqerr.Corrupt, fmt.Sprintf("mismatched compressed payload size: got %d - expected %d", n, block.CSize))
+	}
+	return data, nil
+}
+
+// DecodeBlock verifies and decodes a single compressed payload, returning the
+// original bytes of the block.
+func DecodeBlock(header frame.Header, block frame.Block, data []byte) ([]byte, error) {
+	var err error
+	sums := block.Checksum // uncompressed digest first, compressed digest last
+	size := checksum.Size(header.ChecksumAlg)
+	if header.ChecksumMode&frame.CompressedChecksum > 0 {
+		if len(sums) < size {
+			return nil, sqerr.New(sqerr.Corrupt, "missing compressed payload checksum")
 		}
-		lossless := true
-		for i := range len(codecList) {
-			currentCodec, ok := codec.CodecMap[codecList[len(codecList)-1-i]] // determine the codec to use
-			if !ok {
-				return sqerr.New(sqerr.Unsupported, "unsupported codec ID")
-			}
-			data, err = currentCodec.DecodeBlock(data) // decode it
-			if err != nil {
-				return sqerr.CodedError(err, sqerr.Corrupt, "failed to decode block")
-			}
-			if currentCodec.IsLossless() == false {
-				lossless = false
-			}
+		csm, exp := checksum.Sum(header.ChecksumAlg, nil, data), sums[len(sums)-size:]
+		if !bytes.Equal(csm, exp) {
+			return nil, sqerr.New(sqerr.Corrupt, fmt.Sprintf("mismatched compressed payload checksum: got %x - expected %x", csm, exp))
 		}
-		if fr.Header.ChecksumMode&frame.UncompressedChecksum > 0 && lossless {
-			csm := uint64(crc32.ChecksumIEEE(data))
-			exp := (1<<(8*crc32.Size) - 1) & blockCS
-			if csm != exp {
-				return sqerr.New(sqerr.Corrupt, fmt.Sprintf("mismatched uncompressed payload checksum: got %08x - expected %08x", csm, exp))
-			}
+		sums = sums[:len(sums)-size]
+	}
+	codecList, codecParams := header.Codec, header.CodecParams
+	if block.BlockType == frame.BlockCodec {
+		codecList, codecParams = block.Codec, block.CodecParams
+	}
+	lossless := true
+	for i := range len(codecList) {
+		idx := len(codecList) - 1 - i
+		currentCodec, ok := codec.Lookup(codecList[idx]) // determine the codec to use
+		if !ok {
+			return nil, sqerr.New(sqerr.Unsupported, "unsupported codec ID")
 		}
-		out, err := dst.Write(data)              // write it out
-		if out != int(block.USize) && lossless { // verify the uncompressed payload size
-			return sqerr.New(sqerr.Corrupt, fmt.Sprintf("mismatched uncompressed payload size: got %d - expected %d", out, block.USize))
+		var configured codec.Codec
+		configured, err = codec.Configure(currentCodec.New(), codec.ParamsAt(codecParams, idx)) // with its stored parameters
+		if err != nil {
+			return nil, err
 		}
+		data, err = configured.DecodeBlock(data) // decode it
 		if err != nil {
-			return sqerr.CodedError(err, sqerr.IO, "failed to write output")
+			return nil, sqerr.CodedError(err, sqerr.Corrupt, "failed to decode block")
+		}
+		if currentCodec.Lossless == false {
+			lossless = false
 		}
 	}
-	return nil
+	if header.ChecksumMode&frame.UncompressedChecksum > 0 && lossless {
+		if len(sums) < size {
+			return nil, sqerr.New(sqerr.Corrupt, "missing uncompressed payload checksum")
+		}
+		csm, exp := checksum.Sum(header.ChecksumAlg, nil, data), sums[:size]
+		if !bytes.Equal(csm, exp) {
+			return nil, sqerr.New(sqerr.Corrupt, fmt.Sprintf("mismatched uncompressed payload checksum: got %x - expected %x", csm, exp))
+		}
+	}
+	if len(data) != int(block.USize) && lossless { // verify the uncompressed payload size
+		return nil, sqerr.New(sqerr.Corrupt, fmt.Sprintf("mismatched uncompressed payload size: got %d - expected %d", len(data), block.USize))
+	}
+	return data, nil
 }
@@ -3,82 +3,176 @@ package pipeline
 import (
 	"bytes"
 	"fmt"
-	"hash/crc32"
+	"hash"
 	"io"
+	"squish/internal/checksum"
 	"squish/internal/codec"
 	"squish/internal/frame"
 	"squish/internal/sqerr"
 )
 
+// EncodeOptions controls how Encode compresses a stream.
+type EncodeOptions struct {
+	Codec        []uint8  // codec pipeline applied to every block
+	CodecParams  [][]byte // serialized parameters of each codec in the pipeline, nil for none
+	BlockSize    int      // uncompressed bytes per block
+	ChecksumMode uint8    // per block checksum mode
+	ChecksumAlg  uint8    // per block checksum algorithm, zero is CRC32
+	Threads      int      // blocks encoded concurrently, <= 1 encodes sequentially
+	Index        bool     // append a block index for random access
+	Trailer      bool     // close the stream with its totals and a digest of the whole content
+	TrailerAlg   uint8    // algorithm of the trailer's content digest, zero is CRC32
+	Level        int      // compression level (codec.MinLevel..codec.MaxLevel), zero uses the default
+}
+
+type encodedBlock struct {
+	block   frame.Block // block header
+	payload []byte      // encoded payload
+}
+
 func Encode(src io.Reader, dst io.Writer, codecIDs []uint8, blockSize int, checksumMode uint8) error {
-	header := frame.Header{ // build your header
-		Key:          frame.MagicKey,
-		Flags:        0x00,
+	return EncodeWithOptions(src, dst, EncodeOptions{
 		Codec:        codecIDs,
+		BlockSize:    blockSize,
 		ChecksumMode: checksumMode,
+		Threads:      1,
+	})
+}
+
+// EncodeWithOptions compresses src into dst. With more than one thread blocks
+// are encoded concurrently and written in their original order, producing the
+// same bytes as a sequential encode.
+func EncodeWithOptions(src io.Reader, dst io.Writer, opts EncodeOptions) error {
+	flags := uint8(0x00)
+	if opts.Index {
+		flags |= frame.IndexFlag
+	}
+	if len(opts.CodecParams) > 0 {
+		flags |= frame.CodecParamsFlag
+	}
+	if opts.Trailer {
+		flags |= frame.TrailerFlag
+	}
+	if (opts.ChecksumMode != frame.NoChecksum || opts.Trailer) && opts.ChecksumAlg != checksum.CRC32 {
+		flags |= frame.ChecksumAlgFlag
+	}
+	if opts.Trailer && opts.TrailerAlg != opts.ChecksumAlg {
+		flags |= frame.TrailerAlgFlag // the trailer otherwise shares the checksum algorithm
+	}
+	var content hash.Hash // digest of the whole content for the trailer
+	if opts.Trailer {
+		if content = checksum.New(opts.TrailerAlg); content == nil {
+			return sqerr.New(sqerr.Usage, fmt.Sprintf("unknown trailer algorithm %d", opts.TrailerAlg))
+		}
+	}
+	header := frame.Header{ // build your header
+		Key:          frame.MagicKey,
+		Version:      frame.FormatVersion,
+		Flags:        flags,
+		Codec:        opts.Codec,
+		CodecParams:  opts.CodecParams,
+		ChecksumMode: opts.ChecksumMode,
+		ChecksumAlg:  opts.ChecksumAlg,
+		TrailerAlg:   opts.TrailerAlg,
 	}
 	fw := frame.NewFrameWriter(dst, header) // make a framewriter
 	err := fw.Ready()                       // write the header
 	if err != nil {
 		return sqerr.CodedError(err, sqerr.IO, "failed to ready frame writer")
 	}
-	defer fw.Close()                               // defer the close to write EOS block
-	blockSize = min(blockSize, frame.MaxBlockSize) // validate blockSize first
-	buffer := make([]byte, blockSize)
-	for {
-		n, err := src.Read(buffer)
-		if n == 0 {
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return sqerr.CodedError(err, sqerr.IO, "failed to read from source")
-			}
+	blockSize := max(min(opts.BlockSize, frame.MaxBlockSize), 1) // validate blockSize first
+	done := false
+	next := func() ([]byte, bool, error) {
+		if done {
+			return nil, false, nil
 		}
-		data := buffer[:n]
-		checksum := uint64(0) // determine the checksum values
-		if checksumMode&frame.UncompressedChecksum > 0 {
-			checksum = uint64(crc32.ChecksumIEEE(data))
+		buffer := make([]byte, blockSize)
+		n, err := io.ReadFull(src, buffer) // fill the whole block, even from short-reading pipes
+		if err == io.EOF {
+			return nil, false, nil
 		}
-		autoCodecIDs := make([]uint8, 0, codec.AutoDepth)
-		for _, codecID := range codecIDs {
-			currentCodec, ok := codec.CodecMap[codecID]
-			if !ok {
-				return sqerr.New(sqerr.Unsupported, "unsupported codec ID")
-			}
-			data, err = currentCodec.EncodeBlock(data) // encode it
-			if err != nil {
-				return sqerr.CodedError(err, sqerr.Internal, fmt.Sprintf("failed to encode block of data with codec %d", codecID))
-			}
-			if codecID == codec.AUTO { // grab the codecs used if in auto mode
-				autoCodecIDs = append(autoCodecIDs, currentCodec.(*codec.AUTOCodec).CodecIDs...)
-				break
-			}
+		if err == io.ErrUnexpectedEOF {
+			done = true // partial final block
+		} else if err != nil {
+			return nil, false, sqerr.CodedError(err, sqerr.IO, "failed to read from source")
 		}
-		if checksumMode&frame.CompressedChecksum > 0 {
-			checksum = checksum << (8 * crc32.Size)
-			checksum += uint64(crc32.ChecksumIEEE(data))
+		if content != nil {
+			content.Write(buffer[:n])
 		}
-		bType := frame.DefaultCodec
-		bCodecsID := codecIDs
-		if codecIDs[0] == codec.AUTO {
-			bType = frame.BlockCodec // set the block type if in AUTO mode
-			bCodecsID = autoCodecIDs // set the codec IDs if in AUTO mode
+		return buffer[:n], true, nil
+	}
+	work := func(data []byte) (encodedBlock, error) {
+		block, payload, err := EncodeBlock(data, opts)
+		return encodedBlock{block: block, payload: payload}, err
+	}
+	emit := func(eb encodedBlock) error {
+		err := fw.WriteBlock(eb.block, bytes.NewReader(eb.payload)) // write the block
+		if err != nil {
+			return sqerr.CodedError(err, sqerr.IO, "failed to write encoded block")
 		}
-		block := frame.Block{ // build the block
-			BlockType: uint8(bType),
-			USize:     uint64(n),
-			CSize:     uint64(len(data)),
-			Checksum:  checksum,
-			Codec:     bCodecsID,
+		return nil
+	}
+	err = runOrdered(opts.Threads, next, work, emit)
+	if err != nil {
+		return err // no EOS block, so the stream reads as truncated
+	}
+	if content != nil {
+		fw.SetDigest(content.Sum(nil))
+	}
+	err = fw.Close() // write the EOS block, trailer and index
+	if err != nil {
+		return sqerr.CodedError(err, sqerr.IO, "failed to write end of stream")
+	}
+	return nil
+}
+
+// EncodeBlock runs a single block of raw data through the codec pipeline, at
+// the checksum mode, checksum algorithm and level of opts, and returns the
+// block header to write along with the encoded payload. It is safe to call
+// from multiple goroutines at once.
+func EncodeBlock(data []byte, opts EncodeOptions) (frame.Block, []byte, error) {
+	var (
+		codecIDs     = opts.Codec
+		checksumMode = opts.ChecksumMode
+		n            = len(data)
+	)
+	if checksumMode != frame.NoChecksum && !checksum.Valid(opts.ChecksumAlg) {
+		return frame.Block{}, nil, sqerr.New(sqerr.Usage, fmt.Sprintf("unknown checksum algorithm %d", opts.ChecksumAlg))
+	}
+	var sum []byte // determine the checksum values
+	if checksumMode&frame.UncompressedChecksum > 0 {
+		sum = checksum.Sum(opts.ChecksumAlg, sum, data)
+	}
+	var autoCodecIDs []uint8
+	for i, codecID := range codecIDs {
+		currentCodec, err := codec.NewEncoder(codecID, codec.ParamsAt(opts.CodecParams, i), opts.Level)
+		if err != nil {
+			return frame.Block{}, nil, err
 		}
-		err = fw.WriteBlock(block, bytes.NewReader(data)) // write the block
+		data, err = currentCodec.EncodeBlock(data) // encode it
 		if err != nil {
-			return sqerr.CodedError(err, sqerr.IO, "failed to write encoded block")
+			return frame.Block{}, nil, sqerr.CodedError(err, sqerr.Internal, fmt.Sprintf("failed to encode block of data with codec %d", codecID))
 		}
-		if n < blockSize { // break if the last block was not full (partial final block)
+		if codecID == codec.AUTO { // grab the codecs used if in auto mode
+			autoCodecIDs = append(autoCodecIDs, currentCodec.(*codec.AUTOCodec).CodecIDs...)
 			break
 		}
 	}
-	return nil
+	if checksumMode&frame.CompressedChecksum > 0 {
+		sum = checksum.Sum(opts.ChecksumAlg, sum, data)
+	}
+	bType := frame.DefaultCodec
+	bCodecsID := codecIDs
+	if codecIDs[0] == codec.AUTO {
+		bType = frame.BlockCodec // set the block type if in AUTO mode
+		bCodecsID = autoCodecIDs // set the codec IDs if in AUTO mode
+	}
+	block := frame.Block{ // build the block
+		BlockType: uint8(bType),
+		USize:     uint64(n),
+		CSize:     uint64(len(data)),
+		Checksum:  sum,
+		Codec:     bCodecsID,
+	}
+	return block, data, nil
 }
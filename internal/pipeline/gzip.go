@@ -0,0 +1,140 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"squish/internal/bitio"
+	"squish/internal/codec"
+	"squish/internal/sqerr"
+)
+
+// gzip (RFC 1952) member header fields
+const (
+	gzipDeflate  = 8    // compression method, deflate is the only one defined
+	gzipFHCRC    = 0x02 // header carries a CRC16
+	gzipFExtra   = 0x04 // header carries an extra field
+	gzipFName    = 0x08 // header carries a zero terminated file name
+	gzipFComment = 0x10 // header carries a zero terminated comment
+	gzipReserved = 0xE0 // flags that must be zero
+	gzipOSAny    = 255  // unknown operating system
+)
+
+// GzipMagic starts every gzip member.
+var GzipMagic = [2]byte{0x1F, 0x8B}
+
+// EncodeGzip compresses src into a single member gzip stream readable by gzip,
+// zlib and compress/gzip, using squish's own deflate encoder at the given level.
+func EncodeGzip(src io.Reader, dst io.Writer, level int) error {
+	var xfl byte // hints at how hard the encoder tried
+	switch level {
+	case codec.MinLevel:
+		xfl = 4
+	case codec.MaxLevel:
+		xfl = 2
+	}
+	header := []byte{GzipMagic[0], GzipMagic[1], gzipDeflate, 0, 0, 0, 0, 0, xfl, gzipOSAny} // no flags or modification time
+	if _, err := dst.Write(header); err != nil {
+		return sqerr.CodedError(err, sqerr.IO, "failed to write gzip header")
+	}
+	var (
+		dw  = codec.NewDeflateWriter(dst, level)
+		crc = crc32.NewIEEE()
+	)
+	n, err := io.Copy(io.MultiWriter(dw, crc), src)
+	if err != nil {
+		return sqerr.CodedError(err, sqerr.IO, "failed to compress gzip data")
+	}
+	if err = dw.Close(); err != nil {
+		return sqerr.CodedError(err, sqerr.IO, "failed to finish deflate stream")
+	}
+	trailer := binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, crc.Sum32()), uint32(n)) // size mod 2^32
+	if _, err = dst.Write(trailer); err != nil {
+		return sqerr.CodedError(err, sqerr.IO, "failed to write gzip trailer")
+	}
+	return nil
+}
+
+// DecodeGzip decompresses a gzip stream into dst, checking each member's CRC32
+// and size. Concatenated members decode one after another, as gunzip does.
+// Headers, deflate data and trailers are all read through one bit reader,
+// which the deflate decoder may have read a little ahead in.
+func DecodeGzip(src io.Reader, dst io.Writer) error {
+	br := bitio.NewLSBBitReader(bufio.NewReader(src))
+	for member := 0; ; member++ {
+		if _, err := br.PeekBits(8); member > 0 && errors.Is(err, io.EOF) {
+			return nil // no more members
+		}
+		if err := readGzipHeader(br); err != nil {
+			return err
+		}
+		crc := crc32.NewIEEE()
+		n, err := io.Copy(io.MultiWriter(dst, crc), codec.NewDeflateReaderBits(br))
+		if err != nil {
+			return sqerr.CodedError(err, sqerr.IO, "failed to write decoded gzip data")
+		}
+		br.AlignToByte()
+		trailer, err := readGzipBytes(br, 8)
+		if err != nil {
+			return sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read gzip trailer")
+		}
+		if binary.LittleEndian.Uint32(trailer[:4]) != crc.Sum32() {
+			return sqerr.New(sqerr.Corrupt, "gzip checksum mismatch")
+		}
+		if binary.LittleEndian.Uint32(trailer[4:]) != uint32(n) {
+			return sqerr.New(sqerr.Corrupt, "gzip size mismatch")
+		}
+	}
+}
+
+func readGzipBytes(br *bitio.LSBBitReader, n int) ([]byte, error) {
+	out := make([]byte, n)
+	for i := range out {
+		b, err := br.ReadBits(8)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = byte(b)
+	}
+	return out, nil
+}
+
+// readGzipHeader reads a member header up to the deflate stream, skipping the
+// optional fields.
+func readGzipHeader(br *bitio.LSBBitReader) error {
+	header, err := readGzipBytes(br, 10)
+	if err != nil {
+		return sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read gzip header")
+	}
+	if header[0] != GzipMagic[0] || header[1] != GzipMagic[1] {
+		return sqerr.New(sqerr.Corrupt, "invalid gzip magic")
+	}
+	if header[2] != gzipDeflate || header[3]&gzipReserved != 0 {
+		return sqerr.New(sqerr.Unsupported, "unsupported gzip compression method or flags")
+	}
+	flags := header[3]
+	if flags&gzipFExtra != 0 {
+		xlen, err := br.ReadBits(16)
+		if err == nil {
+			err = br.SkipBits(8 * int(xlen))
+		}
+		if err != nil {
+			return sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read gzip extra field")
+		}
+	}
+	for _, flag := range []byte{gzipFName, gzipFComment} {
+		for b := uint64(flags & flag); b != 0; { // read up to the terminating zero
+			if b, err = br.ReadBits(8); err != nil {
+				return sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read gzip header string")
+			}
+		}
+	}
+	if flags&gzipFHCRC != 0 {
+		if err = br.SkipBits(16); err != nil {
+			return sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read gzip header checksum")
+		}
+	}
+	return nil
+}
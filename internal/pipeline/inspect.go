@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"squish/internal/checksum"
+	"squish/internal/codec"
+	"squish/internal/frame"
+	"squish/internal/sqerr"
+)
+
+// BlockInfo describes a single data block of a stream.
+type BlockInfo struct {
+	Index  int    `json:"index"`  // position of the block in the stream
+	Offset uint64 `json:"offset"` // byte offset of the block header in the stream
+	Type   string `json:"type"`   // "frame" for header pipeline blocks, "block" for per-block pipelines
+	Codec  string `json:"codec"`  // codec pipeline used to encode the block
+	USize  uint64 `json:"usize"`  // uncompressed size
+	CSize  uint64 `json:"csize"`  // compressed payload size
+}
+
+// TrailerInfo reports the trailer closing a stream.
+type TrailerInfo struct {
+	USize  uint64 `json:"usize"`  // total uncompressed size the trailer vouches for
+	Blocks uint64 `json:"blocks"` // block count the trailer vouches for
+	Alg    string `json:"alg"`    // algorithm of the content digest
+	Digest string `json:"digest"` // hex digest of the whole content
+}
+
+// StreamInfo summarizes a stream without decoding any payloads.
+type StreamInfo struct {
+	Version     uint8        `json:"version"`                // format version
+	Codec       string       `json:"codec"`                  // header codec pipeline
+	Checksum    string       `json:"checksum"`               // checksum mode in CLI syntax
+	ChecksumAlg string       `json:"checksum_alg,omitempty"` // checksum algorithm, when there are checksums
+	Index       bool         `json:"index"`                  // whether a block index trails the stream
+	Blocks      []BlockInfo  `json:"blocks"`                 // every data block in stream order
+	USize       uint64       `json:"usize"`                  // total uncompressed size
+	CSize       uint64       `json:"csize"`                  // total compressed payload size
+	Trailer     *TrailerInfo `json:"trailer,omitempty"`      // stream totals, when the stream has a trailer
+	StreamSize  uint64       `json:"stream_size"`            // bytes up to and including the EOS block
+	Ratio       float64      `json:"ratio"`                  // uncompressed size over stream size
+}
+
+// ChecksumModeString formats a checksum mode the way `squish enc -checksum`
+// accepts it, or "none" when checksums are disabled.
+func ChecksumModeString(mode uint8) string {
+	s := ""
+	if mode&frame.UncompressedChecksum != 0 {
+		s += "u"
+	}
+	if mode&frame.CompressedChecksum != 0 {
+		s += "c"
+	}
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// Inspect walks the frame of a stream, skipping over payloads, and reports
+// the header settings along with the size and pipeline of every block.
+func Inspect(src io.Reader) (StreamInfo, error) {
+	var info StreamInfo
+	fr := frame.NewFrameReader(src)
+	err := fr.Ready()
+	if err != nil {
+		return info, sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read input header")
+	}
+	info.Version = fr.Header.Version
+	info.Codec = codec.PipelineString(fr.Header.Codec, fr.Header.CodecParams)
+	info.Checksum = ChecksumModeString(fr.Header.ChecksumMode)
+	if fr.Header.ChecksumMode != frame.NoChecksum {
+		info.ChecksumAlg = checksum.Name(fr.Header.ChecksumAlg)
+	}
+	info.Index = fr.Header.Flags&frame.IndexFlag != 0
+	info.Blocks = []BlockInfo{}
+	for {
+		offset := fr.Offset()
+		block, _, err := fr.Next()
+		if err != nil {
+			return info, sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read input block")
+		}
+		if block.BlockType == frame.EOS {
+			if t := block.Trailer; t != nil {
+				info.Trailer = &TrailerInfo{USize: t.USize, Blocks: t.Blocks, Alg: checksum.Name(fr.Header.DigestAlg()), Digest: hex.EncodeToString(t.Digest)}
+				if t.Blocks != uint64(len(info.Blocks)) || t.USize != info.USize {
+					return info, sqerr.New(sqerr.Corrupt, fmt.Sprintf("stream has %d blocks of %d bytes, the trailer expects %d blocks of %d bytes", len(info.Blocks), info.USize, t.Blocks, t.USize))
+				}
+			}
+			break
+		}
+		bi := BlockInfo{
+			Index:  len(info.Blocks),
+			Offset: offset,
+			Type:   "frame",
+			Codec:  info.Codec,
+			USize:  block.USize,
+			CSize:  block.CSize,
+		}
+		if block.BlockType == frame.BlockCodec {
+			bi.Type = "block"
+			bi.Codec = codec.PipelineString(block.Codec, block.CodecParams)
+		}
+		err = fr.Drop()
+		if err != nil {
+			return info, sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to skip block payload")
+		}
+		info.Blocks = append(info.Blocks, bi)
+		info.USize += block.USize
+		info.CSize += block.CSize
+	}
+	info.StreamSize = fr.Offset()
+	if info.StreamSize > 0 {
+		info.Ratio = float64(info.USize) / float64(info.StreamSize)
+	}
+	return info, nil
+}
@@ -0,0 +1,102 @@
+package pipeline
+
+import "sync"
+
+type outcome[R any] struct {
+	res R     // result of the work
+	err error // error of the work
+}
+
+type task[J, R any] struct {
+	job  J               // job to work on
+	done chan outcome[R] // where the worker reports back
+}
+
+// runOrdered pulls jobs from next until it reports no more, runs work on them
+// using up to threads goroutines, and hands each result to emit in the order
+// the jobs were pulled. At most 2*threads jobs are in flight at once, which
+// bounds the memory held by results waiting on a slow predecessor. The first
+// error stops new jobs from being pulled and is returned once in-flight work
+// has drained.
+func runOrdered[J, R any](threads int, next func() (J, bool, error), work func(J) (R, error), emit func(R) error) error {
+	if threads <= 1 { // plain loop when there is nothing to parallelize
+		for {
+			job, ok, err := next()
+			if err != nil || !ok {
+				return err
+			}
+			res, err := work(job)
+			if err != nil {
+				return err
+			}
+			if err = emit(res); err != nil {
+				return err
+			}
+		}
+	}
+	var (
+		tasks   = make(chan task[J, R])                 // jobs waiting for a worker
+		pending = make(chan chan outcome[R], 2*threads) // reorder window of results in job order
+		quit    = make(chan struct{})                   // closed to stop pulling jobs
+		nextErr = make(chan error, 1)                   // error from pulling a job
+		wg      sync.WaitGroup
+	)
+	for range threads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				res, err := work(t.job)
+				t.done <- outcome[R]{res: res, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(pending)
+		defer close(tasks)
+		for {
+			select {
+			case <-quit: // read no more input once an error is recorded
+				return
+			default:
+			}
+			job, ok, err := next()
+			if err != nil {
+				nextErr <- err
+				return
+			}
+			if !ok {
+				return
+			}
+			done := make(chan outcome[R], 1) // buffered so workers never wait on emit
+			select {
+			case pending <- done: // blocks while the reorder window is full
+			case <-quit:
+				return
+			}
+			tasks <- task[J, R]{job: job, done: done}
+		}
+	}()
+	var err error
+	for done := range pending { // drain every result, even after an error
+		o := <-done
+		if err != nil {
+			continue
+		}
+		err = o.err
+		if err == nil {
+			err = emit(o.res)
+		}
+		if err != nil {
+			close(quit)
+		}
+	}
+	wg.Wait()
+	if err == nil {
+		select {
+		case err = <-nextErr:
+		default:
+		}
+	}
+	return err
+}
@@ -1,12 +1,88 @@
 package pipeline
 
 import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"squish/internal/checksum"
 	"squish/internal/codec"
 	"squish/internal/frame"
+	"squish/internal/sqerr"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
 )
 
+var update = flag.Bool("update", false, "rewrite the golden streams of the current format in testdata")
+
+// TestGoldenStreams decodes streams written in every format version, and pins
+// the current one, codec output included, byte for byte. A change to either
+// needs a new format version so older squish rejects the new streams instead
+// of misreading them. Features added within a version are pinned in streams of
+// their own, next to the ones written before them.
+func TestGoldenStreams(t *testing.T) {
+	expected, err := os.ReadFile("testdata/golden.txt")
+	if err != nil {
+		t.Fatalf("Failed to read golden text: %v", err)
+	}
+	codecIDs, codecParams, _ := codec.ParsePipeline("RLE(stride=2)-LZH")
+	base := EncodeOptions{Codec: codecIDs, CodecParams: codecParams, BlockSize: 1 << 10, ChecksumMode: frame.UncompressedChecksum | frame.CompressedChecksum, Index: true}
+	sha256 := base
+	sha256.ChecksumAlg = checksum.SHA256
+	trailer := sha256
+	trailer.Trailer, trailer.TrailerAlg = true, checksum.SHA256
+	trailerAlg := trailer
+	trailerAlg.ChecksumAlg = checksum.XXH64 // fast block checksums, the trailer digest for audit
+	current := map[string]EncodeOptions{
+		fmt.Sprintf("golden_v%d.sqz", frame.FormatVersion):             base,
+		fmt.Sprintf("golden_v%d_sha256.sqz", frame.FormatVersion):      sha256,
+		fmt.Sprintf("golden_v%d_trailer.sqz", frame.FormatVersion):     trailer,
+		fmt.Sprintf("golden_v%d_trailer_alg.sqz", frame.FormatVersion): trailerAlg,
+	}
+	for name, opts := range current {
+		encoded := new(bytes.Buffer)
+		if err = EncodeWithOptions(bytes.NewReader(expected), encoded, opts); err != nil {
+			t.Fatalf("Pipeline error during encoding: %v", err)
+		}
+		if *update {
+			if err = os.WriteFile("testdata/"+name, encoded.Bytes(), 0o644); err != nil {
+				t.Fatalf("Failed to update %s: %v", name, err)
+			}
+		}
+		golden, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if !bytes.Equal(encoded.Bytes(), golden) {
+			t.Fatalf("Encoding changed from %s", name)
+		}
+	}
+	names := []string{"golden_v0.sqz", "golden_v0_auto.sqz"}
+	for _, name := range slices.Sorted(maps.Keys(current)) {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		stream, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		decoded := new(bytes.Buffer)
+		if err = Decode(bytes.NewReader(stream), decoded); err != nil {
+			t.Fatalf("Failed to decode %s: %v", name, err)
+		}
+		if !bytes.Equal(decoded.Bytes(), expected) {
+			t.Fatalf("%s decoded to other bytes", name)
+		}
+	}
+}
+
 func testHelper(t *testing.T, str string, codecIDs []uint8, blockSize int, checksumMode uint8) {
 	encodeReader := strings.NewReader(str)
 	encodeWriter := new(strings.Builder)
@@ -54,3 +130,362 @@ func TestPartialLastBlock(t *testing.T) {
 	message := "Hello World!"
 	testHelper(t, message, []uint8{codec.HUFFMAN}, 10, frame.NoChecksum)
 }
+
+func parallelMessage() string {
+	var sb strings.Builder
+	a, b := 1, 1
+	for i := range 2000 {
+		a, b = b, (a+b)%251
+		sb.WriteString(fmt.Sprintf("line %d: the mellow yellow fellow says %d%s\n", i, b, strings.Repeat("z", b%17)))
+	}
+	return sb.String()
+}
+
+func TestParallelEncodeMatchesSequential(t *testing.T) {
+	message := parallelMessage()
+	pipelines := [][]uint8{{codec.RAW}, {codec.LZSS, codec.HUFFMAN}, {codec.BWT, codec.MTF, codec.ZRLE}, {codec.AUTO}}
+	for _, codecIDs := range pipelines {
+		sequential := new(bytes.Buffer)
+		err := Encode(strings.NewReader(message), sequential, codecIDs, 4096, frame.UncompressedChecksum|frame.CompressedChecksum)
+		if err != nil {
+			t.Fatalf("Sequential encoding failed for %d: %v", codecIDs, err)
+		}
+		for _, threads := range []int{2, 3, 8} {
+			parallel := new(bytes.Buffer)
+			opts := EncodeOptions{
+				Codec:        codecIDs,
+				BlockSize:    4096,
+				ChecksumMode: frame.UncompressedChecksum | frame.CompressedChecksum,
+				Threads:      threads,
+			}
+			err = EncodeWithOptions(strings.NewReader(message), parallel, opts)
+			if err != nil {
+				t.Fatalf("Parallel encoding failed for %d with %d threads: %v", codecIDs, threads, err)
+			}
+			if !bytes.Equal(sequential.Bytes(), parallel.Bytes()) {
+				t.Fatalf("Parallel output differs from sequential for %d with %d threads", codecIDs, threads)
+			}
+		}
+	}
+}
+
+func TestParallelEncodeError(t *testing.T) {
+	opts := EncodeOptions{Codec: []uint8{255}, BlockSize: 16, Threads: 4}
+	err := EncodeWithOptions(strings.NewReader(parallelMessage()), io.Discard, opts)
+	if sqerr.ErrorCode(err) != sqerr.Unsupported {
+		t.Fatalf("Expected unsupported codec error, got %v", err)
+	}
+}
+
+func TestParallelStopsPulling(t *testing.T) {
+	const threads = 2
+	for range 100 {
+		var pulled atomic.Int64
+		next := func() (int, bool, error) {
+			return int(pulled.Add(1)) - 1, true, nil // endless input
+		}
+		work := func(job int) (int, error) {
+			if job == 0 {
+				return 0, sqerr.New(sqerr.Corrupt, "first job fails")
+			}
+			return job, nil
+		}
+		err := runOrdered(threads, next, work, func(int) error { return nil })
+		if sqerr.ErrorCode(err) != sqerr.Corrupt {
+			t.Fatalf("Expected corrupt error, got %v", err)
+		}
+		// the reorder window, one job waiting on it and one pulled as the error lands
+		if n := pulled.Load(); n > 2*threads+2 {
+			t.Fatalf("Pulled %d jobs after the first one failed", n)
+		}
+	}
+}
+
+func TestShortReads(t *testing.T) {
+	message := parallelMessage()
+	encodeWriter := new(bytes.Buffer)
+	err := Encode(iotest.HalfReader(strings.NewReader(message)), encodeWriter, []uint8{codec.RAW}, 1024, frame.NoChecksum)
+	if err != nil {
+		t.Fatalf("Pipeline error during encoding: %v", err)
+	}
+	decodeWriter := new(strings.Builder)
+	err = Decode(bytes.NewReader(encodeWriter.Bytes()), decodeWriter)
+	if err != nil {
+		t.Fatalf("Pipeline error during decoding: %v", err)
+	}
+	if decodeWriter.String() != message {
+		t.Fatalf("Short reads lost data: got %d bytes - expected %d", decodeWriter.Len(), len(message))
+	}
+}
+
+func TestParallelDecode(t *testing.T) {
+	message := parallelMessage()
+	encoded := new(bytes.Buffer)
+	err := Encode(strings.NewReader(message), encoded, []uint8{codec.BWT, codec.MTF, codec.ZRLE, codec.HUFFMAN}, 2048, frame.UncompressedChecksum|frame.CompressedChecksum)
+	if err != nil {
+		t.Fatalf("Pipeline error during encoding: %v", err)
+	}
+	for _, threads := range []int{0, 1, 2, 7} {
+		decoded := new(strings.Builder)
+		err = DecodeWithOptions(bytes.NewReader(encoded.Bytes()), decoded, DecodeOptions{Threads: threads})
+		if err != nil {
+			t.Fatalf("Pipeline error during decoding with %d threads: %v", threads, err)
+		}
+		if decoded.String() != message {
+			t.Fatalf("Parallel decoding with %d threads did not match", threads)
+		}
+	}
+}
+
+func TestParallelDecodeCorrupt(t *testing.T) {
+	encoded := new(bytes.Buffer)
+	err := Encode(strings.NewReader(parallelMessage()), encoded, []uint8{codec.RAW}, 2048, frame.CompressedChecksum)
+	if err != nil {
+		t.Fatalf("Pipeline error during encoding: %v", err)
+	}
+	corrupt := encoded.Bytes()
+	corrupt[len(corrupt)/2] ^= 0xFF // flip a payload byte somewhere in the middle
+	err = DecodeWithOptions(bytes.NewReader(corrupt), io.Discard, DecodeOptions{Threads: 4})
+	if sqerr.ErrorCode(err) != sqerr.Corrupt {
+		t.Fatalf("Expected corrupt error, got %v", err)
+	}
+	err = DecodeWithOptions(bytes.NewReader(corrupt[:len(corrupt)-100]), io.Discard, DecodeOptions{Threads: 4})
+	if sqerr.ErrorCode(err) != sqerr.Corrupt {
+		t.Fatalf("Expected corrupt error on truncated stream, got %v", err)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	message := parallelMessage()
+	encoded := new(bytes.Buffer)
+	opts := EncodeOptions{Codec: []uint8{codec.AUTO}, BlockSize: 20000, ChecksumMode: frame.UncompressedChecksum, Index: true}
+	err := EncodeWithOptions(strings.NewReader(message), encoded, opts)
+	if err != nil {
+		t.Fatalf("Pipeline error during encoding: %v", err)
+	}
+	info, err := Inspect(bytes.NewReader(encoded.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to inspect stream: %v", err)
+	}
+	if info.Codec != "AUTO" || info.Checksum != "u" || !info.Index {
+		t.Fatalf("Unexpected stream header info %+v", info)
+	}
+	if len(info.Blocks) != (len(message)+19999)/20000 || info.USize != uint64(len(message)) {
+		t.Fatalf("Unexpected block info: %d blocks, %d bytes", len(info.Blocks), info.USize)
+	}
+	for _, b := range info.Blocks {
+		if b.Type != "block" || b.Codec == "" || b.Codec == "AUTO" {
+			t.Fatalf("Block %d does not report its own pipeline: %+v", b.Index, b)
+		}
+	}
+	_, err = Inspect(bytes.NewReader(encoded.Bytes()[:encoded.Len()/2]))
+	if sqerr.ErrorCode(err) != sqerr.Corrupt {
+		t.Fatalf("Expected corrupt error on truncated stream, got %v", err)
+	}
+}
+
+func TestCodecParams(t *testing.T) {
+	message := parallelMessage()
+	codecIDs, codecParams, err := codec.ParsePipeline("rle(stride=3)-lz77(windowlog=12)-huffman")
+	if err != nil {
+		t.Fatalf("Failed to parse pipeline: %v", err)
+	}
+	encoded := new(bytes.Buffer)
+	opts := EncodeOptions{Codec: codecIDs, CodecParams: codecParams, BlockSize: 20000, ChecksumMode: frame.UncompressedChecksum, Threads: 4}
+	if err = EncodeWithOptions(strings.NewReader(message), encoded, opts); err != nil {
+		t.Fatalf("Pipeline error during encoding: %v", err)
+	}
+	info, err := Inspect(bytes.NewReader(encoded.Bytes()))
+	if err != nil || info.Codec != "RLE(stride=3)-LZ77(windowlog=12)-HUFFMAN" {
+		t.Fatalf("Stream reports pipeline %q: %v", info.Codec, err)
+	}
+	decoded := new(strings.Builder)
+	if err = Decode(bytes.NewReader(encoded.Bytes()), decoded); err != nil {
+		t.Fatalf("Pipeline error during decoding: %v", err)
+	}
+	if decoded.String() != message {
+		t.Fatalf("Pipeline messages did not match")
+	}
+	// the parameters reach the codec, a stride 3 RLE block decoded with stride 1 gives other bytes
+	opts.Codec, opts.CodecParams = []uint8{codec.RLE}, codecParams[:1]
+	block, data, err := EncodeBlock([]byte(message[:1000]), opts)
+	if err != nil {
+		t.Fatalf("Failed to encode block: %v", err)
+	}
+	header := frame.Header{Codec: opts.Codec, CodecParams: opts.CodecParams, ChecksumMode: frame.UncompressedChecksum}
+	if _, err = DecodeBlock(header, block, data); err != nil {
+		t.Fatalf("Failed to decode block: %v", err)
+	}
+	header.CodecParams = nil
+	if _, err = DecodeBlock(header, block, data); sqerr.ErrorCode(err) != sqerr.Corrupt {
+		t.Fatalf("Expected corrupt error without the stride, got %v", err)
+	}
+}
+
+func TestChecksumAlgorithms(t *testing.T) {
+	message := parallelMessage()
+	for _, name := range checksum.Names() {
+		alg, _ := checksum.ID(name)
+		encoded := new(bytes.Buffer)
+		opts := EncodeOptions{Codec: []uint8{codec.LZSS}, BlockSize: 20000, ChecksumMode: frame.UncompressedChecksum | frame.CompressedChecksum, ChecksumAlg: alg}
+		if err := EncodeWithOptions(strings.NewReader(message), encoded, opts); err != nil {
+			t.Fatalf("Pipeline error during %s encoding: %v", name, err)
+		}
+		info, err := Inspect(bytes.NewReader(encoded.Bytes()))
+		if err != nil || info.ChecksumAlg != name {
+			t.Fatalf("Stream reports checksum algorithm %q, expected %s: %v", info.ChecksumAlg, name, err)
+		}
+		decoded := new(strings.Builder)
+		if err = Decode(bytes.NewReader(encoded.Bytes()), decoded); err != nil || decoded.String() != message {
+			t.Fatalf("Pipeline messages did not match with %s: %v", name, err)
+		}
+		corrupt := encoded.Bytes()
+		corrupt[len(corrupt)/2] ^= 0x01 // flip a bit somewhere in the middle
+		if err = Decode(bytes.NewReader(corrupt), io.Discard); sqerr.ErrorCode(err) != sqerr.Corrupt {
+			t.Fatalf("Expected corrupt error with %s, got %v", name, err)
+		}
+	}
+	// streams checksummed with CRC32 don't spend a byte on the algorithm
+	opts := EncodeOptions{Codec: []uint8{codec.RAW}, BlockSize: len(message), ChecksumMode: frame.UncompressedChecksum, ChecksumAlg: checksum.CRC32}
+	crc32Stream, sha256Stream := new(bytes.Buffer), new(bytes.Buffer)
+	EncodeWithOptions(strings.NewReader(message), crc32Stream, opts)
+	opts.ChecksumAlg = checksum.SHA256
+	EncodeWithOptions(strings.NewReader(message), sha256Stream, opts)
+	if sha256Stream.Len()-crc32Stream.Len() != 1+checksum.Size(checksum.SHA256)-checksum.Size(checksum.CRC32) {
+		t.Fatalf("SHA256 stream is %d bytes, CRC32 stream %d", sha256Stream.Len(), crc32Stream.Len())
+	}
+}
+
+func TestTrailer(t *testing.T) {
+	message := parallelMessage()
+	encoded := new(bytes.Buffer)
+	opts := EncodeOptions{Codec: []uint8{codec.LZSS}, BlockSize: 20000, ChecksumAlg: checksum.SHA256, Threads: 4, Trailer: true, TrailerAlg: checksum.SHA256}
+	if err := EncodeWithOptions(strings.NewReader(message), encoded, opts); err != nil {
+		t.Fatalf("Pipeline error during encoding: %v", err)
+	}
+	stream := encoded.Bytes()
+	info, err := Inspect(bytes.NewReader(stream))
+	if err != nil || info.Trailer == nil || info.Trailer.Blocks != uint64(len(info.Blocks)) || info.Trailer.USize != uint64(len(message)) {
+		t.Fatalf("Stream reports trailer %+v: %v", info.Trailer, err)
+	}
+	for _, threads := range []int{1, 4} {
+		decoded := new(strings.Builder)
+		if err = DecodeWithOptions(bytes.NewReader(stream), decoded, DecodeOptions{Threads: threads}); err != nil || decoded.String() != message {
+			t.Fatalf("Pipeline messages did not match with a trailer: %v", err)
+		}
+	}
+	// every block checks out on its own, only the trailer catches a dropped or swapped block
+	b := info.Blocks
+	dropped := slices.Concat(stream[:b[1].Offset], stream[b[2].Offset:])
+	swapped := slices.Concat(stream[:b[1].Offset], stream[b[2].Offset:b[3].Offset], stream[b[1].Offset:b[2].Offset], stream[b[3].Offset:])
+	for name, corrupt := range map[string][]byte{"dropped": dropped, "swapped": swapped} {
+		for _, threads := range []int{1, 4} {
+			err = DecodeWithOptions(bytes.NewReader(corrupt), io.Discard, DecodeOptions{Threads: threads})
+			if sqerr.ErrorCode(err) != sqerr.Corrupt {
+				t.Fatalf("Expected corrupt error with a %s block, got %v", name, err)
+			}
+		}
+	}
+	if _, err = Inspect(bytes.NewReader(dropped)); sqerr.ErrorCode(err) != sqerr.Corrupt {
+		t.Fatalf("Expected corrupt error inspecting a dropped block, got %v", err)
+	}
+	// lossy content can't match the digest, the size and block count still have to
+	encoded.Reset()
+	opts = EncodeOptions{Codec: []uint8{codec.LRLE}, BlockSize: 20000, Index: true, Trailer: true}
+	if err = EncodeWithOptions(strings.NewReader(message), encoded, opts); err != nil {
+		t.Fatalf("Pipeline error during encoding: %v", err)
+	}
+	stream = encoded.Bytes()
+	if err = Decode(bytes.NewReader(stream), io.Discard); err != nil {
+		t.Fatalf("Pipeline error decoding lossy stream with a trailer: %v", err)
+	}
+	idx, err := frame.ReadIndex(bytes.NewReader(stream), int64(len(stream)))
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	last := idx[len(idx)-1]
+	replaced := slices.Concat(stream[:idx[1].Offset], stream[last.Offset:last.Offset+last.Size], stream[idx[2].Offset:]) // the short last block in place of block 1
+	if err = Decode(bytes.NewReader(replaced), io.Discard); sqerr.ErrorCode(err) != sqerr.Corrupt {
+		t.Fatalf("Expected corrupt error with a replaced lossy block, got %v", err)
+	}
+}
+
+func TestDecodeBlockError(t *testing.T) {
+	encoded := new(bytes.Buffer)
+	opts := EncodeOptions{Codec: []uint8{codec.RAW}, BlockSize: 1000, ChecksumMode: frame.UncompressedChecksum, Index: true}
+	err := EncodeWithOptions(strings.NewReader(parallelMessage()), encoded, opts)
+	if err != nil {
+		t.Fatalf("Pipeline error during encoding: %v", err)
+	}
+	idx, err := frame.ReadIndex(bytes.NewReader(encoded.Bytes()), int64(encoded.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	corrupt := bytes.Clone(encoded.Bytes())
+	corrupt[idx[5].Offset+idx[5].Size-1] ^= 0x01 // flip the last payload byte of block 5
+	var header frame.Header
+	for _, threads := range []int{1, 4} {
+		err = DecodeWithOptions(bytes.NewReader(corrupt), io.Discard, DecodeOptions{Threads: threads, Header: &header})
+		var blockErr *BlockError
+		if !errors.As(err, &blockErr) {
+			t.Fatalf("Expected a block error, got %v", err)
+		}
+		if blockErr.Block != 5 || blockErr.Offset != idx[5].Offset || sqerr.ErrorCode(err) != sqerr.Corrupt {
+			t.Fatalf("Block error points at the wrong block: %v", err)
+		}
+		if header.ChecksumMode != frame.UncompressedChecksum {
+			t.Fatalf("Decode did not report the stream header")
+		}
+	}
+}
+
+func TestGzipStdlibReads(t *testing.T) {
+	message := strings.Repeat("The mellow yellow fellow says hello world! ", 5000)
+	var coded bytes.Buffer
+	if err := EncodeGzip(strings.NewReader(message), &coded, codec.DefaultLevel); err != nil {
+		t.Fatalf("Gzip encoding failed: %v", err)
+	}
+	gr, err := gzip.NewReader(&coded)
+	if err != nil {
+		t.Fatalf("compress/gzip rejected the header: %v", err)
+	}
+	decoded, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatalf("compress/gzip failed to read the stream: %v", err)
+	}
+	if string(decoded) != message {
+		t.Fatalf("compress/gzip decoded the stream differently")
+	}
+}
+
+func TestGzipReadsStdlib(t *testing.T) {
+	var coded bytes.Buffer
+	for i, message := range []string{"Hello World!", strings.Repeat("squish ", 10000), ""} {
+		gw := gzip.NewWriter(&coded) // concatenated members with every optional header field
+		gw.Name = fmt.Sprintf("member%d.txt", i)
+		gw.Comment = "squish test"
+		gw.Extra = []byte{'S', 'Q', 0, 0}
+		gw.Write([]byte(message))
+		gw.Close()
+	}
+	var decoded strings.Builder
+	if err := DecodeGzip(&coded, &decoded); err != nil {
+		t.Fatalf("Gzip decoding failed: %v", err)
+	}
+	if decoded.String() != "Hello World!"+strings.Repeat("squish ", 10000) {
+		t.Fatalf("Gzip members decoded incorrectly")
+	}
+}
+
+func TestGzipChecksumMismatch(t *testing.T) {
+	var coded bytes.Buffer
+	if err := EncodeGzip(strings.NewReader("Hello World!"), &coded, codec.DefaultLevel); err != nil {
+		t.Fatalf("Gzip encoding failed: %v", err)
+	}
+	corrupt := coded.Bytes()
+	corrupt[len(corrupt)-8] ^= 0xFF // flip the stored CRC32
+	err := DecodeGzip(bytes.NewReader(corrupt), io.Discard)
+	if sqerr.ErrorCode(err) != sqerr.Corrupt {
+		t.Fatalf("Expected a corrupt error for a bad gzip checksum, got %v", err)
+	}
+}
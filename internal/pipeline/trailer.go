@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"squish/internal/checksum"
+	"squish/internal/codec"
+	"squish/internal/frame"
+	"squish/internal/sqerr"
+)
+
+// TrailerCheck totals the blocks of a stream as they are decoded, in stream
+// order, to be checked against the trailer at its end.
+type TrailerCheck struct {
+	header  frame.Header // header of the stream
+	content hash.Hash    // digest of the decoded content, nil without a trailer
+	usize   uint64       // uncompressed bytes so far, as recorded in the block headers
+	blocks  uint64       // decoded blocks so far
+	lossy   bool         // whether a block went through a lossy codec, so its content can't match
+}
+
+// NewTrailerCheck starts checking a stream with the given header. Streams
+// without TrailerFlag always pass.
+func NewTrailerCheck(header frame.Header) *TrailerCheck {
+	tc := &TrailerCheck{header: header}
+	if header.Flags&frame.TrailerFlag != 0 {
+		tc.content = checksum.New(header.DigestAlg())
+	}
+	return tc
+}
+
+// Add counts a decoded data block. The size is taken from the block header,
+// which lossy codecs don't change, so dropped blocks still show up.
+func (tc *TrailerCheck) Add(block frame.Block, data []byte) {
+	if tc.content == nil {
+		return
+	}
+	codecList := tc.header.Codec
+	if block.BlockType == frame.BlockCodec {
+		codecList = block.Codec
+	}
+	for _, id := range codecList {
+		if r, ok := codec.Lookup(id); ok && !r.Lossless {
+			tc.lossy = true
+		}
+	}
+	tc.content.Write(data)
+	tc.usize += block.USize
+	tc.blocks++
+}
+
+// Verify checks the totals against the trailer of the EOS block. The digest is
+// skipped once a lossy codec changed the content.
+func (tc *TrailerCheck) Verify(eos frame.Block) error {
+	if tc.content == nil {
+		return nil
+	}
+	t := eos.Trailer
+	if t == nil {
+		return sqerr.New(sqerr.Corrupt, "missing stream trailer")
+	}
+	if tc.blocks != t.Blocks {
+		return sqerr.New(sqerr.Corrupt, fmt.Sprintf("mismatched stream block count: got %d - expected %d", tc.blocks, t.Blocks))
+	}
+	if tc.usize != t.USize {
+		return sqerr.New(sqerr.Corrupt, fmt.Sprintf("mismatched stream size: got %d - expected %d", tc.usize, t.USize))
+	}
+	if tc.lossy {
+		return nil
+	}
+	if sum := tc.content.Sum(nil); !bytes.Equal(sum, t.Digest) {
+		return sqerr.New(sqerr.Corrupt, fmt.Sprintf("mismatched stream content digest: got %x - expected %x", sum, t.Digest))
+	}
+	return nil
+}
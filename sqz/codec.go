@@ -0,0 +1,26 @@
+package sqz
+
+import "squish/internal/codec"
+
+// Codec encodes and decodes one block at a time. Codecs registered with
+// RegisterCodec can be named in WithCodec pipelines like the built-in ones.
+type Codec = codec.Codec
+
+// CodecProperties describe a codec passed to RegisterCodec.
+type CodecProperties = codec.Properties
+
+// Codec IDs from FirstUserCodec to LastUserCodec are reserved for
+// RegisterCodec, built-in codecs never take them.
+const (
+	FirstUserCodec = codec.FirstUserCodec
+	LastUserCodec  = codec.LastUserCodec
+)
+
+// RegisterCodec makes a codec available to Writers and Readers under an ID
+// from FirstUserCodec to LastUserCodec and a pipeline name. The factory is
+// called for every block. Streams record codecs by ID, so readers must
+// register the same codec under the same ID. Taken IDs and names are
+// rejected, and registering is usually done once from an init function.
+func RegisterCodec(id uint8, name string, factory func() Codec, props CodecProperties) error {
+	return codec.Register(id, name, factory, props)
+}
@@ -0,0 +1,94 @@
+package sqz
+
+import (
+	"io"
+	"squish/internal/frame"
+	"squish/internal/pipeline"
+	"squish/internal/sqerr"
+)
+
+type frameReader interface {
+	Ready() error
+	Next() (frame.Block, io.Reader, error)
+}
+
+// A Reader is an io.Reader that decompresses a .sqz stream. Blocks are read
+// and decoded lazily, one at a time, as the caller asks for more data.
+type Reader struct {
+	fr      frameReader            // frame reader wrapping the source
+	header  frame.Header           // header of the stream being read
+	trailer *pipeline.TrailerCheck // totals of the blocks read, checked at the end-of-stream block
+	buf     []byte                 // decoded bytes not yet handed out
+	eos     bool                   // whether the end-of-stream block was read
+	err     error                  // sticky error
+}
+
+// NewReader creates a Reader reading the given .sqz stream. The frame header
+// is read immediately, so an invalid stream is reported here.
+func NewReader(r io.Reader) (*Reader, error) {
+	z := new(Reader)
+	if err := z.Reset(r); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// Reset discards the Reader's state and makes it equivalent to the result of
+// NewReader on r, reading the new frame header.
+func (z *Reader) Reset(r io.Reader) error {
+	fr := frame.NewFrameReader(r)
+	*z = Reader{fr: fr}
+	if err := fr.Ready(); err != nil {
+		z.err = sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read input header")
+		return z.err
+	}
+	z.header = fr.Header
+	z.trailer = pipeline.NewTrailerCheck(fr.Header)
+	return nil
+}
+
+func (z *Reader) nextBlock() error {
+	block, payload, err := z.fr.Next()
+	if err != nil {
+		return sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read input block")
+	}
+	if block.BlockType == frame.EOS {
+		z.eos = true
+		return z.trailer.Verify(block)
+	}
+	data, err := pipeline.ReadPayload(block, payload)
+	if err != nil {
+		return err
+	}
+	z.buf, err = pipeline.DecodeBlock(z.header, block, data)
+	if err != nil {
+		return err
+	}
+	z.trailer.Add(block, z.buf)
+	return nil
+}
+
+// Read decompresses into p, decoding the next block whenever the previous one
+// has been fully consumed. It returns io.EOF at the end-of-stream block.
+func (z *Reader) Read(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	for len(z.buf) == 0 {
+		if z.eos {
+			return 0, io.EOF
+		}
+		if z.err = z.nextBlock(); z.err != nil {
+			return 0, z.err
+		}
+	}
+	n := copy(p, z.buf)
+	z.buf = z.buf[n:]
+	return n, nil
+}
+
+// Close does not close the underlying io.Reader. It exists so a Reader can be
+// used as an io.ReadCloser, like gzip.Reader.
+func (z *Reader) Close() error {
+	return nil
+}
@@ -0,0 +1,128 @@
+package sqz
+
+import (
+	"io"
+	"squish/internal/frame"
+	"squish/internal/pipeline"
+	"squish/internal/sqerr"
+	"sync"
+)
+
+// A ReaderAt gives random access to the uncompressed contents of an indexed
+// .sqz stream (see WithIndex). Only the blocks covering a requested range are
+// read and decoded; the most recently decoded block is cached so that small
+// sequential reads do not decode the same block twice.
+//
+// ReadAt may be called concurrently. Read and Seek share a single offset and
+// follow the usual io.ReadSeeker rules.
+type ReaderAt struct {
+	r      io.ReaderAt  // compressed stream
+	header frame.Header // header of the stream
+	index  frame.Index  // block index read from the end of the stream
+	offset int64        // offset used by Read and Seek
+
+	mu        sync.Mutex // guards the cached block
+	cacheIdx  int        // position in index of the cached block, -1 if none
+	cacheData []byte     // decoded bytes of the cached block
+}
+
+// NewReaderAt opens an indexed .sqz stream of the given size.
+func NewReaderAt(r io.ReaderAt, size int64) (*ReaderAt, error) {
+	fr := frame.NewFrameReader(io.NewSectionReader(r, 0, size))
+	if err := fr.Ready(); err != nil {
+		return nil, sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read input header")
+	}
+	if fr.Header.Flags&frame.IndexFlag == 0 {
+		return nil, sqerr.New(sqerr.Unsupported, "stream has no block index")
+	}
+	index, err := frame.ReadIndex(r, size)
+	if err != nil {
+		return nil, sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read block index")
+	}
+	return &ReaderAt{r: r, header: fr.Header, index: index, cacheIdx: -1}, nil
+}
+
+// Size returns the uncompressed size of the stream.
+func (z *ReaderAt) Size() int64 {
+	return int64(z.index.USize())
+}
+
+func (z *ReaderAt) block(i int) ([]byte, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.cacheIdx == i {
+		return z.cacheData, nil
+	}
+	entry := z.index[i]
+	fr := frame.NewFrameReader(io.NewSectionReader(z.r, int64(entry.Offset), int64(entry.Size)))
+	fr.Header = z.header // blocks are read without going through the header
+	block, payload, err := fr.Next()
+	if err != nil {
+		return nil, sqerr.CodedError(err, sqerr.ReadErrorCode(err), "failed to read input block")
+	}
+	if block.BlockType == frame.EOS || block.USize != entry.USize {
+		return nil, sqerr.New(sqerr.Corrupt, "block does not match index entry")
+	}
+	data, err := pipeline.ReadPayload(block, payload)
+	if err != nil {
+		return nil, err
+	}
+	data, err = pipeline.DecodeBlock(z.header, block, data)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != entry.USize {
+		return nil, sqerr.New(sqerr.Corrupt, "decoded block does not match index entry")
+	}
+	z.cacheIdx, z.cacheData = i, data
+	return data, nil
+}
+
+// ReadAt reads len(p) uncompressed bytes starting at offset off.
+func (z *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, sqerr.New(sqerr.Usage, "negative offset")
+	}
+	n := 0
+	for n < len(p) {
+		pos := uint64(off) + uint64(n)
+		i := z.index.Find(pos)
+		if i == len(z.index) {
+			return n, io.EOF
+		}
+		data, err := z.block(i)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[pos-z.index[i].UOffset:])
+	}
+	return n, nil
+}
+
+// Read reads from the current offset and advances it.
+func (z *ReaderAt) Read(p []byte) (int, error) {
+	n, err := z.ReadAt(p, z.offset)
+	z.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset for the next Read, interpreted according to whence.
+func (z *ReaderAt) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += z.offset
+	case io.SeekEnd:
+		offset += z.Size()
+	default:
+		return 0, sqerr.New(sqerr.Usage, "invalid whence")
+	}
+	if offset < 0 {
+		return 0, sqerr.New(sqerr.Usage, "negative position")
+	}
+	z.offset = offset
+	return offset, nil
+}
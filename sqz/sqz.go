@@ -0,0 +1,139 @@
+// Package sqz reads and writes .sqz compressed streams.
+//
+// It mirrors the ergonomics of compress/gzip: wrap an io.Writer with
+// NewWriter to compress into it, and wrap an io.Reader with NewReader to
+// decompress from it. Data is split into blocks which are encoded with the
+// configured codec pipeline and framed as described in docs/format.md.
+package sqz
+
+import (
+	"squish/internal/checksum"
+	"squish/internal/codec"
+	"squish/internal/frame"
+	"squish/internal/sqerr"
+)
+
+// Checksum modes that can be passed to WithChecksum. They may be or'ed
+// together to checksum both the uncompressed and compressed data.
+const (
+	NoChecksum           = frame.NoChecksum
+	UncompressedChecksum = frame.UncompressedChecksum
+	CompressedChecksum   = frame.CompressedChecksum
+)
+
+// Checksum algorithms that can be passed to WithChecksumAlgorithm.
+const (
+	CRC32  = checksum.CRC32  // CRC-32 IEEE, the default and the only one older versions read
+	CRC64  = checksum.CRC64  // CRC-64 ECMA-182 as used by xz
+	XXH64  = checksum.XXH64  // xxHash64, fast with a low collision rate
+	SHA256 = checksum.SHA256 // SHA-256, for audit
+)
+
+const (
+	DefaultPipeline  = "DEFLATE"          // default codec pipeline, same as the CLI
+	DefaultBlockSize = 128 << 10          // default block size, same as the CLI
+	MaxBlockSize     = frame.MaxBlockSize // largest block size a stream can hold
+)
+
+// Compression levels accepted by WithLevel.
+const (
+	BestSpeed          = codec.MinLevel
+	BestCompression    = codec.MaxLevel
+	DefaultCompression = codec.DefaultLevel
+)
+
+// Option configures a Writer.
+type Option func(*Writer) error
+
+// WithCodec sets the codec pipeline used to encode blocks, using the same
+// syntax as the CLI (e.g. "RLE-HUFFMAN" or "AUTO").
+func WithCodec(pipeline string) Option {
+	return func(z *Writer) error {
+		codecIDs, codecParams, err := codec.ParsePipeline(pipeline)
+		if err != nil {
+			return err
+		}
+		z.codecIDs, z.codecParams = codecIDs, codecParams
+		return nil
+	}
+}
+
+// WithBlockSize sets the number of uncompressed bytes held in each block.
+func WithBlockSize(n int) Option {
+	return func(z *Writer) error {
+		if n <= 0 || n > MaxBlockSize {
+			return sqerr.New(sqerr.Usage, "block size out of range")
+		}
+		z.blockSize = n
+		return nil
+	}
+}
+
+// WithChecksum sets the per-block checksum mode.
+func WithChecksum(mode uint8) Option {
+	return func(z *Writer) error {
+		if mode > UncompressedChecksum|CompressedChecksum {
+			return sqerr.New(sqerr.Usage, "invalid checksum mode")
+		}
+		z.checksumMode = mode
+		return nil
+	}
+}
+
+// WithChecksumAlgorithm sets the algorithm of the per-block checksums chosen
+// with WithChecksum.
+func WithChecksumAlgorithm(alg uint8) Option {
+	return func(z *Writer) error {
+		if !checksum.Valid(alg) {
+			return sqerr.New(sqerr.Usage, "invalid checksum algorithm")
+		}
+		z.checksumAlg = alg
+		return nil
+	}
+}
+
+// WithIndex appends a block index to the stream so it can be opened with
+// NewReaderAt for random access.
+func WithIndex() Option {
+	return func(z *Writer) error {
+		z.flags |= frame.IndexFlag
+		return nil
+	}
+}
+
+// WithTrailer closes the stream with its total size, block count and a digest
+// of the whole content, so readers detect dropped, duplicated or reordered
+// blocks. The digest uses the checksum algorithm unless WithTrailerAlgorithm
+// picks another.
+func WithTrailer() Option {
+	return func(z *Writer) error {
+		z.flags |= frame.TrailerFlag
+		return nil
+	}
+}
+
+// WithTrailerAlgorithm sets the algorithm of the content digest in the
+// trailer chosen with WithTrailer, e.g. SHA256 for audit next to fast XXH64
+// block checksums.
+func WithTrailerAlgorithm(alg uint8) Option {
+	return func(z *Writer) error {
+		if !checksum.Valid(alg) {
+			return sqerr.New(sqerr.Usage, "invalid trailer algorithm")
+		}
+		z.trailerAlg = alg
+		z.ownDigest = true
+		return nil
+	}
+}
+
+// WithLevel sets how much effort the encoder spends searching for matches and
+// pipelines, from BestSpeed to BestCompression.
+func WithLevel(level int) Option {
+	return func(z *Writer) error {
+		if level < BestSpeed || level > BestCompression {
+			return sqerr.New(sqerr.Usage, "compression level out of range")
+		}
+		z.level = level
+		return nil
+	}
+}
@@ -0,0 +1,292 @@
+package sqz
+
+import (
+	"bytes"
+	"io"
+	"squish/internal/pipeline"
+	"squish/internal/sqerr"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var message = strings.Repeat("The mellow yellow fellow says hello world! ", 200)
+
+func roundTrip(t *testing.T, str string, opts ...Option) {
+	var compressed bytes.Buffer
+	zw, err := NewWriter(&compressed, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	for i := 0; i < len(str); i += 97 { // write in awkward chunks to cross block borders
+		_, err = zw.Write([]byte(str[i:min(i+97, len(str))]))
+		if err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	zr, err := NewReader(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if string(decoded) != str {
+		t.Fatalf("Round trip mismatch: got %d bytes - expected %d bytes", len(decoded), len(str))
+	}
+}
+
+func TestRoundTripDefaults(t *testing.T) {
+	roundTrip(t, message)
+}
+
+func TestRoundTripOptions(t *testing.T) {
+	roundTrip(t, message, WithCodec("rle-huffman"), WithBlockSize(1000), WithChecksum(UncompressedChecksum|CompressedChecksum))
+}
+
+func TestRoundTripChecksumAlgorithm(t *testing.T) {
+	roundTrip(t, message, WithBlockSize(1000), WithChecksum(UncompressedChecksum), WithChecksumAlgorithm(XXH64))
+}
+
+func TestRoundTripTrailer(t *testing.T) {
+	roundTrip(t, message, WithBlockSize(1000), WithTrailer(), WithChecksumAlgorithm(SHA256))
+}
+
+func TestTrailerAlgorithm(t *testing.T) {
+	opts := []Option{WithBlockSize(1000), WithChecksum(UncompressedChecksum | CompressedChecksum), WithChecksumAlgorithm(XXH64), WithTrailer(), WithTrailerAlgorithm(SHA256)}
+	roundTrip(t, message, opts...)
+	var compressed bytes.Buffer
+	zw, _ := NewWriter(&compressed, opts...)
+	zw.Write([]byte(message))
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	stream := compressed.Bytes()
+	info, err := pipeline.Inspect(bytes.NewReader(stream))
+	if err != nil || info.ChecksumAlg != "xxh64" || info.Trailer == nil || info.Trailer.Alg != "sha256" || len(info.Trailer.Digest) != 64 {
+		t.Fatalf("Stream reports checksums in %s and trailer %+v: %v", info.ChecksumAlg, info.Trailer, err)
+	}
+	stream[len(stream)-1] ^= 0xFF // last byte of the sha256 digest
+	if err = pipeline.Decode(bytes.NewReader(stream), io.Discard); sqerr.ErrorCode(err) != sqerr.Corrupt {
+		t.Fatalf("Expected corrupt error with a damaged trailer digest, got %v", err)
+	}
+}
+
+func TestReaderTrailer(t *testing.T) {
+	var compressed bytes.Buffer
+	zw, _ := NewWriter(&compressed, WithBlockSize(1000), WithTrailer())
+	zw.Write([]byte(message))
+	zw.Flush() // a short block in the middle
+	zw.Write([]byte(message))
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	stream := compressed.Bytes()
+	stream[len(stream)-1] ^= 0xFF // last byte of the trailer digest
+	zr, err := NewReader(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if sqerr.ErrorCode(err) != sqerr.Corrupt || string(decoded) != message+message {
+		t.Fatalf("Expected corrupt error after the content, got %v", err)
+	}
+}
+
+func TestRoundTripCodecParams(t *testing.T) {
+	roundTrip(t, message, WithCodec("rle(stride=2)-lz77(windowlog=10)-huffman"), WithBlockSize(1000))
+	roundTrip(t, message, WithCodec("lzss(windowlog=14)-huffman"), WithBlockSize(5000), WithLevel(BestCompression))
+}
+
+func TestRoundTripAuto(t *testing.T) {
+	roundTrip(t, message, WithCodec("AUTO"), WithBlockSize(4096))
+}
+
+// xorCodec flips every bit, standing in for an application's own codec
+type xorCodec struct{}
+
+func (xorCodec) EncodeBlock(src []byte) ([]byte, error) {
+	dst := make([]byte, len(src))
+	for i, b := range src {
+		dst[i] = ^b
+	}
+	return dst, nil
+}
+
+func (c xorCodec) DecodeBlock(src []byte) ([]byte, error) {
+	return c.EncodeBlock(src)
+}
+
+func (xorCodec) IsLossless() bool {
+	return true
+}
+
+var registerXOR = sync.OnceValue(func() error {
+	return RegisterCodec(FirstUserCodec+0x10, "XOR", func() Codec { return xorCodec{} }, CodecProperties{Lossless: true})
+})
+
+func TestRoundTripRegisteredCodec(t *testing.T) {
+	if err := registerXOR(); err != nil {
+		t.Fatalf("Failed to register codec: %v", err)
+	}
+	roundTrip(t, message, WithCodec("xor-huffman"), WithChecksum(UncompressedChecksum))
+	if err := RegisterCodec(FirstUserCodec+0x10, "XOR2", func() Codec { return xorCodec{} }, CodecProperties{Lossless: true}); err == nil {
+		t.Fatalf("Missed taken codec ID")
+	}
+}
+
+func TestRoundTripEmpty(t *testing.T) {
+	roundTrip(t, "")
+}
+
+func TestBadOptions(t *testing.T) {
+	_, err := NewWriter(io.Discard, WithCodec("NOPE"))
+	if err == nil {
+		t.Fatalf("Missed unknown codec")
+	}
+	_, err = NewWriter(io.Discard, WithBlockSize(0))
+	if err == nil {
+		t.Fatalf("Missed invalid block size")
+	}
+	_, err = NewWriter(io.Discard, WithChecksumAlgorithm(SHA256+1))
+	if err == nil {
+		t.Fatalf("Missed invalid checksum algorithm")
+	}
+	_, err = NewWriter(io.Discard, WithChecksum(4))
+	if err == nil {
+		t.Fatalf("Missed invalid checksum mode")
+	}
+}
+
+func TestWriterMatchesPipeline(t *testing.T) {
+	var fromWriter, fromPipeline bytes.Buffer
+	zw, err := NewWriter(&fromWriter, WithBlockSize(512))
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	_, err = zw.Write([]byte(message))
+	if err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	err = pipeline.Encode(strings.NewReader(message), &fromPipeline, zw.codecIDs, 512, NoChecksum)
+	if err != nil {
+		t.Fatalf("Failed to encode with pipeline: %v", err)
+	}
+	if !bytes.Equal(fromWriter.Bytes(), fromPipeline.Bytes()) {
+		t.Fatalf("Writer output differs from pipeline.Encode output")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	var compressed bytes.Buffer
+	zw, err := NewWriter(&compressed)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	_, err = zw.Write([]byte("Hello World!"))
+	if err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	err = zw.Flush()
+	if err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	zr, err := NewReader(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	buf := make([]byte, 12)
+	_, err = io.ReadFull(zr, buf)
+	if err != nil || string(buf) != "Hello World!" {
+		t.Fatalf("Failed to read flushed data before close: %v", err)
+	}
+}
+
+func TestReaderBadHeader(t *testing.T) {
+	_, err := NewReader(strings.NewReader("NOPE"))
+	if err == nil {
+		t.Fatalf("Missed invalid header")
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	var compressed bytes.Buffer
+	zw, _ := NewWriter(&compressed)
+	zw.Write([]byte(message))
+	zw.Close()
+	truncated := compressed.Bytes()[:compressed.Len()/2]
+	zr, err := NewReader(bytes.NewReader(truncated))
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	_, err = io.ReadAll(zr)
+	if err == nil {
+		t.Fatalf("Missed truncated stream")
+	}
+}
+
+func TestReaderAt(t *testing.T) {
+	var compressed bytes.Buffer
+	zw, err := NewWriter(&compressed, WithIndex(), WithBlockSize(1000), WithChecksum(UncompressedChecksum))
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	zw.Write([]byte(message))
+	err = zw.Close()
+	if err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	zr, err := NewReaderAt(bytes.NewReader(compressed.Bytes()), int64(compressed.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	if zr.Size() != int64(len(message)) {
+		t.Fatalf("Size mismatch: got %d - expected %d", zr.Size(), len(message))
+	}
+	for _, off := range []int{0, 999, 1000, 4321, len(message) - 10} {
+		buf := make([]byte, 2500)
+		n, err := zr.ReadAt(buf, int64(off))
+		if err != nil && err != io.EOF {
+			t.Fatalf("Failed to read at %d: %v", off, err)
+		}
+		if string(buf[:n]) != message[off:min(off+2500, len(message))] {
+			t.Fatalf("Mismatch reading at %d", off)
+		}
+	}
+	_, err = zr.Seek(-50, io.SeekEnd)
+	if err != nil {
+		t.Fatalf("Failed to seek: %v", err)
+	}
+	tail, err := io.ReadAll(zr)
+	if err != nil || string(tail) != message[len(message)-50:] {
+		t.Fatalf("Mismatch reading after seek: %v", err)
+	}
+	streamed, err := NewReader(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create streaming reader: %v", err)
+	}
+	decoded, err := io.ReadAll(streamed)
+	if err != nil || string(decoded) != message {
+		t.Fatalf("Streaming reader failed on indexed stream: %v", err)
+	}
+}
+
+func TestReaderAtNoIndex(t *testing.T) {
+	var compressed bytes.Buffer
+	zw, _ := NewWriter(&compressed)
+	zw.Write([]byte(message))
+	zw.Close()
+	_, err := NewReaderAt(bytes.NewReader(compressed.Bytes()), int64(compressed.Len()))
+	if err == nil {
+		t.Fatalf("Missed stream without an index")
+	}
+}
@@ -0,0 +1,203 @@
+package sqz
+
+import (
+	"bytes"
+	"hash"
+	"io"
+	"squish/internal/checksum"
+	"squish/internal/codec"
+	"squish/internal/frame"
+	"squish/internal/pipeline"
+	"squish/internal/sqerr"
+)
+
+type frameWriter interface {
+	Ready() error
+	WriteBlock(b frame.Block, payload io.Reader) error
+	SetDigest(digest []byte)
+	Close() error
+}
+
+// A Writer is an io.WriteCloser that compresses everything written to it into
+// a .sqz stream. Writes are buffered into blocks; the final partial block and
+// the end-of-stream marker are only written once Close is called.
+type Writer struct {
+	w            io.Writer   // underlying destination
+	fw           frameWriter // frame writer wrapping w
+	codecIDs     []uint8     // codec pipeline for every block
+	codecParams  [][]byte    // serialized parameters of each codec in the pipeline
+	blockSize    int         // uncompressed bytes per block
+	checksumMode uint8       // per block checksum mode
+	checksumAlg  uint8       // per block checksum algorithm
+	trailerAlg   uint8       // trailer digest algorithm, only with ownDigest
+	ownDigest    bool        // whether the trailer has its own algorithm rather than the checksum one
+	flags        uint8       // header flags
+	content      hash.Hash   // digest of everything written, only with a trailer
+	level        int         // compression level
+	buf          []byte      // bytes waiting to fill a block
+	wroteHeader  bool        // whether the frame header is out
+	closed       bool        // whether Close has been called
+	err          error       // sticky error
+}
+
+// NewWriter returns a Writer that compresses into w. Without options it uses
+// the DEFLATE pipeline, 128KiB blocks, the default level and no checksums. It is the caller's
+// responsibility to call Close on the Writer when done.
+func NewWriter(w io.Writer, opts ...Option) (*Writer, error) {
+	codecIDs, codecParams, err := codec.ParsePipeline(DefaultPipeline)
+	if err != nil {
+		return nil, err
+	}
+	z := &Writer{
+		codecIDs:     codecIDs,
+		codecParams:  codecParams,
+		blockSize:    DefaultBlockSize,
+		checksumMode: NoChecksum,
+	}
+	for _, opt := range opts {
+		if err := opt(z); err != nil {
+			return nil, err
+		}
+	}
+	z.Reset(w)
+	return z, nil
+}
+
+// Reset discards the Writer's state and makes it equivalent to the result of
+// its original state from NewWriter, but writing to w instead. The options
+// originally passed to NewWriter are kept.
+func (z *Writer) Reset(w io.Writer) {
+	flags := z.flags
+	if len(z.codecParams) > 0 {
+		flags |= frame.CodecParamsFlag
+	}
+	if (z.checksumMode != NoChecksum || flags&frame.TrailerFlag != 0) && z.checksumAlg != CRC32 {
+		flags |= frame.ChecksumAlgFlag
+	}
+	trailerAlg := z.checksumAlg
+	if z.ownDigest {
+		trailerAlg = z.trailerAlg
+	}
+	if flags&frame.TrailerFlag != 0 && trailerAlg != z.checksumAlg {
+		flags |= frame.TrailerAlgFlag
+	}
+	header := frame.Header{
+		Key:          frame.MagicKey,
+		Version:      frame.FormatVersion,
+		Flags:        flags,
+		Codec:        z.codecIDs,
+		CodecParams:  z.codecParams,
+		ChecksumMode: z.checksumMode,
+		ChecksumAlg:  z.checksumAlg,
+		TrailerAlg:   trailerAlg,
+	}
+	z.w = w
+	z.fw = frame.NewFrameWriter(w, header)
+	if cap(z.buf) < z.blockSize {
+		z.buf = make([]byte, 0, z.blockSize)
+	}
+	z.buf = z.buf[:0]
+	z.content = nil
+	if flags&frame.TrailerFlag != 0 {
+		z.content = checksum.New(trailerAlg)
+	}
+	z.wroteHeader = false
+	z.closed = false
+	z.err = nil
+}
+
+func (z *Writer) writeHeader() error {
+	if z.wroteHeader {
+		return nil
+	}
+	z.wroteHeader = true
+	if err := z.fw.Ready(); err != nil {
+		return sqerr.CodedError(err, sqerr.IO, "failed to ready frame writer")
+	}
+	return nil
+}
+
+func (z *Writer) writeBlock() error {
+	if len(z.buf) == 0 {
+		return nil
+	}
+	if z.content != nil {
+		z.content.Write(z.buf)
+	}
+	opts := pipeline.EncodeOptions{Codec: z.codecIDs, CodecParams: z.codecParams, ChecksumMode: z.checksumMode, ChecksumAlg: z.checksumAlg, Level: z.level}
+	block, data, err := pipeline.EncodeBlock(z.buf, opts)
+	if err != nil {
+		return err
+	}
+	err = z.fw.WriteBlock(block, bytes.NewReader(data))
+	if err != nil {
+		return sqerr.CodedError(err, sqerr.IO, "failed to write encoded block")
+	}
+	z.buf = z.buf[:0]
+	return nil
+}
+
+// Write compresses p, emitting a block every time the block buffer fills.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, sqerr.New(sqerr.Usage, "write to closed sqz writer")
+	}
+	if z.err = z.writeHeader(); z.err != nil {
+		return 0, z.err
+	}
+	written := 0
+	for len(p) > 0 {
+		n := copy(z.buf[len(z.buf):z.blockSize], p) // top up the block buffer
+		z.buf = z.buf[:len(z.buf)+n]
+		p = p[n:]
+		written += n
+		if len(z.buf) == z.blockSize {
+			if z.err = z.writeBlock(); z.err != nil {
+				return written, z.err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Flush encodes any buffered data as a (possibly short) block so that a reader
+// can decode everything written so far. Flushing often hurts the compression
+// ratio, as every block is compressed on its own.
+func (z *Writer) Flush() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return nil
+	}
+	if z.err = z.writeHeader(); z.err != nil {
+		return z.err
+	}
+	z.err = z.writeBlock()
+	return z.err
+}
+
+// Close flushes any buffered data and writes the end-of-stream marker. It does
+// not close the underlying io.Writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return nil
+	}
+	if z.err = z.Flush(); z.err != nil {
+		return z.err
+	}
+	z.closed = true
+	if z.content != nil {
+		z.fw.SetDigest(z.content.Sum(nil))
+	}
+	if err := z.fw.Close(); err != nil {
+		z.err = sqerr.CodedError(err, sqerr.IO, "failed to write end of stream")
+	}
+	return z.err
+}